@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
@@ -20,11 +21,24 @@ type ServerConfig struct {
 	} `yaml:"mysql"`
 
 	Redis struct {
-		Addr         string `yaml:"addr"`         // 服务器地址:端口
-		Username     string `yaml:"username"`     // 用户名
-		Password     string `yaml:"password"`     // 密码
-		DB           int    `yaml:"db"`           // redis数据库
-		TlsProtocols bool   `yaml:"tlsProtocols"` // tls是否启动
+		Mode             string        `yaml:"mode"`             // 部署模式: standalone(默认)/sentinel/cluster
+		Addr             string        `yaml:"addr"`             // 服务器地址:端口
+		Addrs            []string      `yaml:"addrs"`            // 哨兵或集群节点地址, 为空时使用 addr
+		MasterName       string        `yaml:"masterName"`       // 哨兵模式的 master 名称
+		SentinelUsername string        `yaml:"sentinelUsername"` // 哨兵用户名
+		SentinelPassword string        `yaml:"sentinelPassword"` // 哨兵密码
+		Username         string        `yaml:"username"`         // 用户名
+		Password         string        `yaml:"password"`         // 密码
+		DB               int           `yaml:"db"`               // redis数据库, 集群模式不支持
+		PoolSize         int           `yaml:"poolSize"`         // 每个节点的最大连接数, 0 使用默认值
+		MinIdleConns     int           `yaml:"minIdleConns"`     // 最小空闲连接数
+		DialTimeout      time.Duration `yaml:"dialTimeout"`      // 建立连接超时, 例如 5s
+		ReadTimeout      time.Duration `yaml:"readTimeout"`      // 读超时
+		WriteTimeout     time.Duration `yaml:"writeTimeout"`     // 写超时
+		PoolTimeout      time.Duration `yaml:"poolTimeout"`      // 等待连接池可用连接的超时
+		TlsProtocols     bool          `yaml:"tlsProtocols"`     // tls是否启动
+		TlsCaFile        string        `yaml:"tlsCaFile"`        // tls CA 证书文件, 为空时使用系统证书
+		TlsSkipVerify    bool          `yaml:"tlsSkipVerify"`    // tls 是否跳过证书校验
 	} `yaml:"redis"`
 
 	Rabbitmq struct {
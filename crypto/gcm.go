@@ -0,0 +1,145 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrUnknownKey        = errors.New("crypto: unknown key id")     // 密文使用的 key 不在 Keyring 中
+	ErrInvalidCiphertext = errors.New("crypto: invalid ciphertext") // 密文格式错误或校验失败
+)
+
+// AesGcmEncrypt AES-GCM 加密, 返回 nonce + 密文; additionalData 参与认证但不加密, 解密时必须一致
+func AesGcmEncrypt(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// AesGcmDecrypt AES-GCM 解密 AesGcmEncrypt 的结果
+func AesGcmDecrypt(key, ciphertext, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrInvalidCiphertext
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Keyring 带 key ID 的 AES-GCM 密钥集合, 使用当前 key 加密, 按密文中的 key ID 解密, 用于密钥轮换
+type Keyring struct {
+	current string
+	keys    map[string][]byte
+}
+
+/**
+ * NewKeyring 创建 Keyring, key 长度为 16、24 或 32 字节, key ID 不能包含 ":"
+ * 密文格式为 <keyId>:<base64url(nonce + 密文)>
+ *
+ * Example:
+ *
+ * kr, err := crypto.NewKeyring("2024-03", map[string][]byte{
+ * 	"2023-01": oldKey,
+ * 	"2024-03": newKey,
+ * })
+ * s, err := kr.Encrypt([]byte("secret"), []byte("user:1"))
+ * plaintext, err := kr.Decrypt(s, []byte("user:1"))
+ * if kr.NeedsRotation(s) {
+ * 	s, err = kr.Reencrypt(s, []byte("user:1"))
+ * }
+ */
+func NewKeyring(current string, keys map[string][]byte) (*Keyring, error) {
+	k := &Keyring{current: current, keys: make(map[string][]byte, len(keys))}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("crypto: invalid key id %q", id)
+		}
+		if n := len(key); n != 16 && n != 24 && n != 32 {
+			return nil, fmt.Errorf("crypto: invalid key size %d for key id %s", n, id)
+		}
+		k.keys[id] = append([]byte(nil), key...)
+	}
+	if _, ok := k.keys[current]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, current)
+	}
+	return k, nil
+}
+
+// CurrentKeyId 返回加密使用的 key ID
+func (k *Keyring) CurrentKeyId() string {
+	return k.current
+}
+
+// Encrypt 使用当前 key 加密
+func (k *Keyring) Encrypt(plaintext, additionalData []byte) (string, error) {
+	b, err := AesGcmEncrypt(k.keys[k.current], plaintext, additionalData)
+	if err != nil {
+		return "", err
+	}
+	return k.current + ":" + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Decrypt 按密文中的 key ID 解密
+func (k *Keyring) Decrypt(ciphertext string, additionalData []byte) ([]byte, error) {
+	id, data, ok := strings.Cut(ciphertext, ":")
+	if !ok {
+		return nil, ErrInvalidCiphertext
+	}
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+	b, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	return AesGcmDecrypt(key, b, additionalData)
+}
+
+// KeyId 返回密文使用的 key ID, 不是 Keyring 格式的密文返回 false
+func (k *Keyring) KeyId(ciphertext string) (string, bool) {
+	id, _, ok := strings.Cut(ciphertext, ":")
+	return id, ok
+}
+
+// NeedsRotation 密文是否不是由当前 key 加密
+func (k *Keyring) NeedsRotation(ciphertext string) bool {
+	id, ok := k.KeyId(ciphertext)
+	return !ok || id != k.current
+}
+
+// Reencrypt 解密后使用当前 key 重新加密
+func (k *Keyring) Reencrypt(ciphertext string, additionalData []byte) (string, error) {
+	plaintext, err := k.Decrypt(ciphertext, additionalData)
+	if err != nil {
+		return "", err
+	}
+	return k.Encrypt(plaintext, additionalData)
+}
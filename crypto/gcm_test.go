@@ -0,0 +1,36 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyring(t *testing.T) {
+	oldKey := []byte("examplekey123456")
+	newKey := []byte("examplekey1234567890123456789012")
+	old, err := NewKeyring("k1", map[string][]byte{"k1": oldKey})
+	require.NoError(t, err)
+	s, err := old.Encrypt([]byte("hello"), []byte("user:1"))
+	require.NoError(t, err)
+
+	kr, err := NewKeyring("k2", map[string][]byte{"k1": oldKey, "k2": newKey})
+	require.NoError(t, err)
+	b, err := kr.Decrypt(s, []byte("user:1"))
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(b))
+	_, err = kr.Decrypt(s, []byte("user:2"))
+	require.ErrorIs(t, err, ErrInvalidCiphertext)
+
+	require.True(t, kr.NeedsRotation(s))
+	s, err = kr.Reencrypt(s, []byte("user:1"))
+	require.NoError(t, err)
+	require.False(t, kr.NeedsRotation(s))
+	_, err = old.Decrypt(s, []byte("user:1"))
+	require.ErrorIs(t, err, ErrUnknownKey)
+
+	_, err = NewKeyring("k3", map[string][]byte{"k1": oldKey})
+	require.ErrorIs(t, err, ErrUnknownKey)
+	_, err = NewKeyring("k1", map[string][]byte{"k1": []byte("short")})
+	require.Error(t, err)
+}
@@ -1,6 +1,7 @@
 package ginx
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -46,6 +47,9 @@ type Context struct {
  * 	ctx.Log.Infof("userId %s", p.UserId)
  * 	ctx.Log.Errorf("userId %s", p.UserId)
  *
+ * 	// 请求取消或超时会传递到 redis 命令
+ * 	name, err := redis.New().WithContext(ctx.Context()).WithTimeout(time.Second).Get("name")
+ *
  * 	// ...
  * 	if err != nil {
  * 		ctx.RenderServerError(fmt.Errorf("search user report error: %s", err))
@@ -88,6 +92,11 @@ func (c *Context) ShouldBind(obj interface{}) error {
 	return translateValidationError(c.ctx.ShouldBind(obj))
 }
 
+// Context 返回请求的 context, 客户端断开或请求超时后会被取消, 用于传递给 redis、数据库等下游调用
+func (c *Context) Context() context.Context {
+	return c.ctx.Request.Context()
+}
+
 func (c *Context) ClientIP() string {
 	return c.ctx.ClientIP()
 }
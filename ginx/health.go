@@ -0,0 +1,33 @@
+package ginx
+
+import (
+	"net/http"
+
+	"github.com/scrawld/library/safe_stop"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LivenessHandler 存活检查, 有组件运行失败时返回 503
+func LivenessHandler(r *safe_stop.Runner) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		h := r.Health()
+		code := http.StatusOK
+		if !h.Live {
+			code = http.StatusServiceUnavailable
+		}
+		ctx.JSON(code, h)
+	}
+}
+
+// ReadinessHandler 就绪检查, 组件未全部就绪或已开始退出时返回 503, 退出时先于连接排空生效
+func ReadinessHandler(r *safe_stop.Runner) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		h := r.Health()
+		code := http.StatusOK
+		if !h.Ready {
+			code = http.StatusServiceUnavailable
+		}
+		ctx.JSON(code, h)
+	}
+}
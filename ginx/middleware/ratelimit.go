@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/scrawld/library/ginx"
+	"github.com/scrawld/library/redis"
+	"github.com/scrawld/library/util"
+	"github.com/scrawld/zaplog"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitKeyFunc 返回限流使用的 key, 返回空字符串时不限流
+type RateLimitKeyFunc func(ctx *gin.Context) string
+
+// RateLimitByIP 按客户端 IP 限流, IPv6 地址按 /64 前缀视为同一客户端
+func RateLimitByIP(ctx *gin.Context) string {
+	ip := ctx.ClientIP()
+	if prefix, err := util.ParseIPPrefix(ip); err == nil {
+		ip = prefix
+	}
+	return "ip:" + ip
+}
+
+// RateLimitByRoute 按路由限流, 所有客户端共享同一额度
+func RateLimitByRoute(ctx *gin.Context) string {
+	path := ctx.FullPath()
+	if path == "" {
+		path = ctx.Request.URL.Path
+	}
+	return "route:" + ctx.Request.Method + ":" + path
+}
+
+// RateLimitByUser 按用户限流, getUserId 返回空字符串(未登录)时不限流
+func RateLimitByUser(getUserId func(ctx *gin.Context) string) RateLimitKeyFunc {
+	return func(ctx *gin.Context) string {
+		userId := getUserId(ctx)
+		if userId == "" {
+			return ""
+		}
+		return "user:" + userId
+	}
+}
+
+/**
+ * RateLimit 限流中间件, 设置 X-RateLimit-* 响应头, 超出限制时返回 HttpStatusRetryWith 并设置 Retry-After
+ * redis 出错时放行请求
+ *
+ * Example:
+ *
+ * limiter := redis.NewRateLimiter(redis.TokenBucket, 20, time.Second)
+ * router.Use(ginxMiddleware.RateLimit(limiter, ginxMiddleware.RateLimitByIP))
+ *
+ * // 按用户和路由组合限流
+ * router.POST("/order", ginxMiddleware.RateLimit(limiter, func(ctx *gin.Context) string {
+ * 	return ctx.GetString("userId") + ":" + ginxMiddleware.RateLimitByRoute(ctx)
+ * }), handler)
+ */
+func RateLimit(limiter *redis.RateLimiter, keyFunc RateLimitKeyFunc) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := keyFunc(ctx)
+		if key == "" {
+			ctx.Next()
+			return
+		}
+		res, err := limiter.WithContext(ctx.Request.Context()).Allow(key)
+		if err != nil {
+			zaplog.New(ctx.GetHeader("X-Request-Id")).Named("RateLimit").Warnf("rate limit %s error: %s", key, err)
+			ctx.Next()
+			return
+		}
+		ctx.Header("X-RateLimit-Limit", strconv.FormatInt(res.Limit, 10))
+		ctx.Header("X-RateLimit-Remaining", strconv.FormatInt(res.Remaining, 10))
+		ctx.Header("X-RateLimit-Reset", strconv.FormatInt(ceilSeconds(res.ResetAfter), 10))
+
+		if !res.Allowed {
+			ctx.Header("Retry-After", strconv.FormatInt(ceilSeconds(res.RetryAfter), 10))
+			ctx.AbortWithStatusJSON(http.StatusOK, ginx.RenderStruct{
+				Code:    ginx.HttpStatusRetryWith,
+				Message: "Too many requests, please try again later",
+				Data:    []string{},
+			})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// ceilSeconds 向上取整为秒
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
@@ -1,24 +1,84 @@
 package gpool
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
 	"sync"
 )
 
+// PanicError 任务 panic 时转换的错误, 包含堆栈
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("gpool: panic: %v\n%s", e.Value, e.Stack)
+}
+
+/**
+ * Pool 限制并发数的协程池
+ * 可以手动配对 Add/Done, 也可以通过 Submit 提交任务, Wait 等待全部完成并返回任务的错误
+ *
+ * Example:
+ *
+ * p := gpool.New(10).WithContext(ctx).StopOnError()
+ * for _, v := range items {
+ * 	v := v
+ * 	p.Submit(func(ctx context.Context) error {
+ * 		return handle(ctx, v)
+ * 	})
+ * }
+ * if err := p.Wait(); err != nil {
+ * 	return err // errors.Join 聚合的错误, panic 转为 *gpool.PanicError
+ * }
+ */
 type Pool struct {
 	queue chan int
 	wg    *sync.WaitGroup
+
+	ctx         context.Context
+	cancel      context.CancelCauseFunc
+	stopOnError bool
+	mu          sync.Mutex
+	errs        []error
+	skipped     bool
 }
 
 func New(size int) *Pool {
 	if size <= 0 {
 		size = 1
 	}
+	ctx, cancel := context.WithCancelCause(context.Background())
 	return &Pool{
-		queue: make(chan int, size),
-		wg:    &sync.WaitGroup{},
+		queue:  make(chan int, size),
+		wg:     &sync.WaitGroup{},
+		ctx:    ctx,
+		cancel: cancel,
 	}
 }
 
+// WithContext 设置任务使用的 context, ctx 结束后尚未开始的任务不再执行, 需在 Submit 之前调用
+// 任务使用的是 ctx 派生的子 context, 在 ctx 结束或调用 Close 之前一直挂在 ctx 上, ctx 长期存在时用完后需调用 Close
+func (p *Pool) WithContext(ctx context.Context) *Pool {
+	p.cancel(nil)
+	p.ctx, p.cancel = context.WithCancelCause(ctx)
+	return p
+}
+
+// StopOnError 任一任务返回错误后取消 context, 尚未开始的任务不再执行, 需在 Submit 之前调用
+func (p *Pool) StopOnError() *Pool {
+	p.stopOnError = true
+	return p
+}
+
+// Context 返回任务使用的 context
+func (p *Pool) Context() context.Context {
+	return p.ctx
+}
+
 func (p *Pool) Add(delta int) {
 	for i := 0; i < delta; i++ {
 		p.queue <- 1
@@ -34,6 +94,71 @@ func (p *Pool) Done() {
 	p.wg.Done()
 }
 
-func (p *Pool) Wait() {
+// Submit 等待空闲位置后在新协程中执行 fn, context 已结束时直接跳过
+func (p *Pool) Submit(fn func(ctx context.Context) error) {
+	select {
+	case p.queue <- 1:
+	case <-p.ctx.Done():
+		p.mu.Lock()
+		p.skipped = true
+		p.mu.Unlock()
+		return
+	}
+	p.wg.Add(1)
+	go func() {
+		defer p.Done()
+		if p.ctx.Err() != nil {
+			p.mu.Lock()
+			p.skipped = true
+			p.mu.Unlock()
+			return
+		}
+		if err := call(p.ctx, fn); err != nil {
+			p.mu.Lock()
+			p.errs = append(p.errs, err)
+			p.mu.Unlock()
+			if p.stopOnError {
+				p.cancel(err)
+			}
+		}
+	}()
+}
+
+// Close 取消任务使用的 context, 释放 WithContext 派生的子 context, 在 Wait 之后调用, 之后提交的任务不再执行
+func (p *Pool) Close() {
+	p.cancel(nil)
+}
+
+// Wait 等待全部任务完成, 返回任务错误的聚合; 因 context 结束跳过了任务时, 同时返回 context 结束的原因
+func (p *Pool) Wait() error {
 	p.wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	errs := append([]error{}, p.errs...)
+	if p.skipped {
+		if cause := context.Cause(p.ctx); cause != nil && !containsError(errs, cause) {
+			errs = append(errs, cause)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// call 执行 fn 并将 panic 转为 *PanicError
+func call(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return fn(ctx)
+}
+
+func containsError(errs []error, target error) bool {
+	for _, err := range errs {
+		if err == target {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,98 @@
+package gpool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolSubmit(t *testing.T) {
+	var (
+		p       = New(3)
+		running int32
+		peak    int32
+		errA    = errors.New("a")
+	)
+	for i := 0; i < 20; i++ {
+		i := i
+		p.Submit(func(ctx context.Context) error {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				old := atomic.LoadInt32(&peak)
+				if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			switch i {
+			case 5:
+				return errA
+			case 7:
+				panic("boom")
+			}
+			return nil
+		})
+	}
+	err := p.Wait()
+	require.ErrorIs(t, err, errA)
+	var pe *PanicError
+	require.ErrorAs(t, err, &pe)
+	require.Equal(t, "boom", pe.Value)
+	require.NotEmpty(t, pe.Stack)
+	require.LessOrEqual(t, peak, int32(3))
+}
+
+func TestPoolStopOnError(t *testing.T) {
+	var (
+		p    = New(1).StopOnError()
+		errA = errors.New("a")
+		ran  int32
+	)
+	for i := 0; i < 10; i++ {
+		i := i
+		p.Submit(func(ctx context.Context) error {
+			atomic.AddInt32(&ran, 1)
+			if i == 2 {
+				return errA
+			}
+			return nil
+		})
+	}
+	require.ErrorIs(t, p.Wait(), errA)
+	require.Less(t, atomic.LoadInt32(&ran), int32(10))
+}
+
+func TestPoolContextAndAdd(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p := New(2).WithContext(ctx)
+	p.Submit(func(ctx context.Context) error { return nil })
+	require.ErrorIs(t, p.Wait(), context.Canceled)
+
+	// Close 释放派生的子 context
+	parent, cancelParent := context.WithCancel(context.Background())
+	defer cancelParent()
+	p = New(2).WithContext(parent)
+	p.Submit(func(ctx context.Context) error { return nil })
+	require.NoError(t, p.Wait())
+	p.Close()
+	require.ErrorIs(t, p.Context().Err(), context.Canceled)
+	require.NoError(t, parent.Err())
+
+	p = New(2)
+	var n int32
+	for i := 0; i < 5; i++ {
+		p.Add(1)
+		go func() {
+			defer p.Done()
+			atomic.AddInt32(&n, 1)
+		}()
+	}
+	require.NoError(t, p.Wait())
+	require.Equal(t, int32(5), n)
+}
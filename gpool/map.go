@@ -0,0 +1,146 @@
+package gpool
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/scrawld/library/util"
+)
+
+// ItemError 单个元素处理失败的错误
+type ItemError struct {
+	Index int // 元素在输入中的下标, MapChunks 中为分块的下标
+	Err   error
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("gpool: item %d: %s", e.Index, e.Err)
+}
+
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
+
+type mapOptions struct {
+	failFast bool
+	rate     int
+	progress func(done, total int)
+}
+
+// MapOption Map/ForEach/MapChunks 的选项
+type MapOption func(o *mapOptions)
+
+// FailFast 任一元素失败后不再处理剩余元素, 只返回第一个错误; 默认处理全部元素并返回所有 *ItemError 的聚合
+func FailFast() MapOption {
+	return func(o *mapOptions) { o.failFast = true }
+}
+
+// RateLimit 限制每秒开始处理的元素数量, n <= 0 表示不限制, 超过 1e9 时按 1e9 处理
+func RateLimit(n int) MapOption {
+	return func(o *mapOptions) { o.rate = n }
+}
+
+// Progress 每处理完一个元素(无论成功失败)回调一次, 回调串行执行, done 单调递增
+func Progress(fn func(done, total int)) MapOption {
+	return func(o *mapOptions) { o.progress = fn }
+}
+
+/**
+ * Map 使用 concurrency 个协程并发处理 items, 结果与 items 顺序一致, 失败元素对应零值
+ * panic 会转为 *PanicError
+ *
+ * Example:
+ *
+ * users, err := gpool.Map(ctx, ids, 10, func(ctx context.Context, id int64) (*User, error) {
+ * 	return getUser(ctx, id)
+ * }, gpool.RateLimit(100), gpool.Progress(func(done, total int) {
+ * 	log.Printf("%d/%d", done, total)
+ * }))
+ */
+func Map[T, R any](ctx context.Context, items []T, concurrency int, fn func(ctx context.Context, item T) (R, error), opts ...MapOption) ([]R, error) {
+	var o mapOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	var (
+		results = make([]R, len(items))
+		p       = New(concurrency).WithContext(ctx)
+		mu      sync.Mutex
+		done    int
+		limiter <-chan time.Time
+	)
+	defer p.Close()
+	if o.failFast {
+		p.StopOnError()
+	}
+	if o.rate > 0 {
+		ticker := time.NewTicker(max(time.Second/time.Duration(o.rate), time.Nanosecond))
+		defer ticker.Stop()
+		limiter = ticker.C
+	}
+	for i, item := range items {
+		if limiter != nil && i > 0 {
+			select {
+			case <-limiter:
+			case <-p.Context().Done():
+			}
+		}
+		p.Submit(func(ctx context.Context) error {
+			defer func() {
+				if o.progress == nil {
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				done++
+				o.progress(done, len(items))
+			}()
+			r, err := fn(ctx, item)
+			if err != nil {
+				return &ItemError{Index: i, Err: err}
+			}
+			results[i] = r
+			return nil
+		})
+	}
+	err := p.Wait()
+	if err != nil && o.failFast {
+		// 第一个错误即 context 取消的原因, 其余多为取消引起的错误
+		if cause := context.Cause(p.Context()); cause != nil {
+			err = cause
+		}
+	}
+	return results, err
+}
+
+// ForEach 使用 concurrency 个协程并发处理 items, 选项同 Map
+func ForEach[T any](ctx context.Context, items []T, concurrency int, fn func(ctx context.Context, item T) error, opts ...MapOption) error {
+	_, err := Map(ctx, items, concurrency, func(ctx context.Context, item T) (struct{}, error) {
+		return struct{}{}, fn(ctx, item)
+	}, opts...)
+	return err
+}
+
+/**
+ * MapChunks 将 items 按 size 分块后并发处理, 适用于批量查询等场景, 返回按顺序拼接的结果
+ * 选项同 Map, 但限速和进度以分块为单位, 失败分块的结果被跳过; size <= 0 时返回错误
+ *
+ * Example:
+ *
+ * users, err := gpool.MapChunks(ctx, ids, 500, 4, func(ctx context.Context, ids []int64) ([]*User, error) {
+ * 	return findUsers(ctx, ids)
+ * })
+ */
+func MapChunks[T, R any](ctx context.Context, items []T, size, concurrency int, fn func(ctx context.Context, chunk []T) ([]R, error), opts ...MapOption) ([]R, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("gpool: invalid chunk size %d", size)
+	}
+	chunks, err := Map(ctx, util.SliceChunk(items, size), concurrency, fn, opts...)
+	var r []R
+	for _, chunk := range chunks {
+		r = append(r, chunk...)
+	}
+	return r, err
+}
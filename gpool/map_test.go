@@ -0,0 +1,89 @@
+package gpool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMap(t *testing.T) {
+	var (
+		items = []int{1, 2, 3, 4, 5, 6, 7, 8}
+		errA  = errors.New("a")
+		last  int
+	)
+	r, err := Map(context.Background(), items, 3, func(ctx context.Context, v int) (int, error) {
+		time.Sleep(time.Duration(8-v) * time.Millisecond)
+		if v == 4 {
+			return 0, errA
+		}
+		return v * v, nil
+	}, Progress(func(done, total int) {
+		require.Equal(t, last+1, done)
+		require.Equal(t, 8, total)
+		last = done
+	}))
+	require.Equal(t, []int{1, 4, 9, 0, 25, 36, 49, 64}, r)
+	require.ErrorIs(t, err, errA)
+	var ie *ItemError
+	require.ErrorAs(t, err, &ie)
+	require.Equal(t, 3, ie.Index)
+	require.Equal(t, 8, last)
+
+	err = ForEach(context.Background(), items, 1, func(ctx context.Context, v int) error {
+		if v >= 2 {
+			return errA
+		}
+		return nil
+	}, FailFast())
+	require.ErrorAs(t, err, &ie)
+	require.Equal(t, 1, ie.Index)
+}
+
+func TestMapRateLimitAndChunks(t *testing.T) {
+	start := time.Now()
+	require.NoError(t, ForEach(context.Background(), []int{1, 2, 3, 4, 5}, 5, func(ctx context.Context, v int) error {
+		return nil
+	}, RateLimit(100)))
+	require.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+
+	r, err := MapChunks(context.Background(), []int{1, 2, 3, 4, 5, 6, 7}, 3, 2, func(ctx context.Context, chunk []int) ([]int, error) {
+		out := make([]int, 0, len(chunk))
+		for _, v := range chunk {
+			out = append(out, v*10)
+		}
+		return out, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []int{10, 20, 30, 40, 50, 60, 70}, r)
+	// 超过 1e9 的速率不会使 ticker 间隔为 0
+	require.NoError(t, ForEach(context.Background(), []int{1, 2, 3}, 3, func(ctx context.Context, v int) error {
+		return nil
+	}, RateLimit(2e9)))
+
+	_, err = MapChunks(context.Background(), []int{1, 2}, 0, 2, func(ctx context.Context, chunk []int) ([]int, error) {
+		return chunk, nil
+	})
+	require.Error(t, err)
+}
+
+func TestMapReleasesContext(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 返回后派生的子 context 被取消, 不会一直挂在 parent 上
+	ctxs := make(chan context.Context, 2)
+	_, err := Map(parent, []int{1, 2}, 2, func(ctx context.Context, v int) (int, error) {
+		ctxs <- ctx
+		return v, nil
+	})
+	require.NoError(t, err)
+	close(ctxs)
+	for ctx := range ctxs {
+		require.ErrorIs(t, ctx.Err(), context.Canceled)
+	}
+	require.NoError(t, parent.Err())
+}
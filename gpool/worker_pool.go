@@ -0,0 +1,385 @@
+package gpool
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/scrawld/zaplog"
+)
+
+var (
+	ErrQueueFull  = errors.New("gpool: queue is full")  // 队列已满, FullPolicy 为 FullReject 时返回
+	ErrPoolClosed = errors.New("gpool: pool is closed") // 已调用 Close
+)
+
+// FullPolicy 队列已满时的处理方式
+type FullPolicy int
+
+const (
+	FullBlock  FullPolicy = iota // 阻塞等待, 直到有空位、ctx 结束或关闭
+	FullDrop                     // 丢弃任务并计入 Stats.Dropped, Submit 返回 nil
+	FullReject                   // 返回 ErrQueueFull
+)
+
+// Priority 任务优先级, 空闲的 worker 总是先取高优先级的任务
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+	priorityLevels
+)
+
+// WorkerPoolOptions 常驻协程池配置
+type WorkerPoolOptions struct {
+	Workers     int             // worker 数量, 默认 runtime.NumCPU(), 可通过 Resize 调整
+	MinWorkers  int             // 空闲回收后至少保留的 worker 数量
+	QueueSize   int             // 每个优先级的队列长度, 默认 1024
+	FullPolicy  FullPolicy      // 队列已满时的处理方式, 默认 FullBlock
+	IdleTimeout time.Duration   // 空闲超过该时间的 worker 退出, 有新任务时重新创建, 0 表示不回收
+	OnError     func(err error) // 任务返回错误或 panic 时回调, 默认记录日志
+}
+
+// Stats 协程池统计
+type Stats struct {
+	Workers   int           // 当前 worker 数量
+	Idle      int           // 空闲 worker 数量
+	Queued    int64         // 排队中的任务数
+	Running   int64         // 执行中的任务数
+	Completed int64         // 执行成功的任务数
+	Failed    int64         // 返回错误或 panic 的任务数
+	Dropped   int64         // 队列已满被丢弃的任务数
+	AvgWait   time.Duration // 任务从提交到开始执行的平均等待时间
+	AvgRun    time.Duration // 任务的平均执行时间
+}
+
+type workerTask struct {
+	fn       func(ctx context.Context) error
+	enqueued time.Time
+}
+
+// WorkerPool 常驻 worker 从有界队列中读取任务执行的协程池
+type WorkerPool struct {
+	opts    WorkerPoolOptions
+	queues  [priorityLevels]chan *workerTask
+	ctx     context.Context // 任务使用的 context, Close 超时后取消
+	cancel  context.CancelFunc
+	closing chan struct{} // 开始关闭, 唤醒阻塞的 Submit
+	stopped chan struct{} // 不再有新任务, 通知 worker 排空后退出
+	once    sync.Once
+	submit  sync.RWMutex // Submit 持有读锁, Close 持有写锁等待进行中的 Submit 结束
+	wg      sync.WaitGroup
+
+	mu      sync.Mutex
+	size    int
+	workers int
+	idle    int
+	resized chan struct{} // Resize 缩容时关闭, 唤醒空闲的 worker
+
+	queued, running, completed, failed, dropped atomic.Int64
+	started, finished, waitNanos, runNanos      atomic.Int64
+}
+
+/**
+ * NewWorkerPool 创建常驻协程池, 立即启动 Workers 个 worker
+ *
+ * Example:
+ *
+ * p := gpool.NewWorkerPool(gpool.WorkerPoolOptions{Workers: 8, QueueSize: 1000, FullPolicy: gpool.FullReject, IdleTimeout: time.Minute})
+ * defer p.Close(context.Background())
+ *
+ * err := p.Submit(ctx, func(ctx context.Context) error {
+ * 	return handle(ctx, msg)
+ * })
+ * err = p.SubmitPriority(ctx, gpool.PriorityHigh, urgent)
+ *
+ * p.Resize(16) // 配置热更新
+ * stats := p.Stats()
+ */
+func NewWorkerPool(opts WorkerPoolOptions) *WorkerPool {
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1024
+	}
+	if opts.OnError == nil {
+		opts.OnError = func(err error) {
+			zaplog.New().Named("WorkerPool").Errorf("task error: %s", err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &WorkerPool{
+		opts:    opts,
+		ctx:     ctx,
+		cancel:  cancel,
+		closing: make(chan struct{}),
+		stopped: make(chan struct{}),
+		size:    opts.Workers,
+		resized: make(chan struct{}),
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan *workerTask, opts.QueueSize)
+	}
+	p.mu.Lock()
+	for i := 0; i < opts.Workers; i++ {
+		p.spawn()
+	}
+	p.mu.Unlock()
+	return p
+}
+
+// Submit 以 PriorityNormal 提交任务
+func (p *WorkerPool) Submit(ctx context.Context, fn func(ctx context.Context) error) error {
+	return p.SubmitPriority(ctx, PriorityNormal, fn)
+}
+
+// SubmitPriority 以指定优先级提交任务, ctx 只用于 FullBlock 时等待队列空位, 任务执行时使用协程池的 context
+func (p *WorkerPool) SubmitPriority(ctx context.Context, prio Priority, fn func(ctx context.Context) error) error {
+	if prio < PriorityLow {
+		prio = PriorityLow
+	} else if prio > PriorityHigh {
+		prio = PriorityHigh
+	}
+	p.submit.RLock()
+	defer p.submit.RUnlock()
+	select {
+	case <-p.closing:
+		return ErrPoolClosed
+	default:
+	}
+
+	t := &workerTask{fn: fn, enqueued: time.Now()}
+	q := p.queues[prio]
+	p.queued.Add(1)
+	select {
+	case q <- t:
+	default:
+		switch p.opts.FullPolicy {
+		case FullDrop:
+			p.queued.Add(-1)
+			p.dropped.Add(1)
+			return nil
+		case FullReject:
+			p.queued.Add(-1)
+			return ErrQueueFull
+		}
+		select {
+		case q <- t:
+		case <-ctx.Done():
+			p.queued.Add(-1)
+			return ctx.Err()
+		case <-p.closing:
+			p.queued.Add(-1)
+			return ErrPoolClosed
+		}
+	}
+
+	// 没有空闲的 worker 时补充, 与 worker 退出前的检查在同一把锁下, 不会遗漏任务
+	p.mu.Lock()
+	if p.idle == 0 && p.workers < p.size {
+		p.spawn()
+	}
+	p.mu.Unlock()
+	return nil
+}
+
+// Resize 调整 worker 数量, 缩容时执行中的任务完成后 worker 才退出
+func (p *WorkerPool) Resize(n int) {
+	if n <= 0 {
+		n = 1
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.size = n
+	for p.workers < n {
+		p.spawn()
+	}
+	if p.workers > n {
+		close(p.resized)
+		p.resized = make(chan struct{})
+	}
+}
+
+// Size 返回设定的 worker 数量
+func (p *WorkerPool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.size
+}
+
+// Stats 返回统计信息
+func (p *WorkerPool) Stats() Stats {
+	p.mu.Lock()
+	s := Stats{Workers: p.workers, Idle: p.idle}
+	p.mu.Unlock()
+	s.Queued = p.queued.Load()
+	s.Running = p.running.Load()
+	s.Completed = p.completed.Load()
+	s.Failed = p.failed.Load()
+	s.Dropped = p.dropped.Load()
+	if n := p.started.Load(); n > 0 {
+		s.AvgWait = time.Duration(p.waitNanos.Load() / n)
+	}
+	if n := p.finished.Load(); n > 0 {
+		s.AvgRun = time.Duration(p.runNanos.Load() / n)
+	}
+	return s
+}
+
+// Close 停止接收任务并等待排队和执行中的任务完成; ctx 结束时取消任务的 context 并返回 ctx.Err()
+func (p *WorkerPool) Close(ctx context.Context) error {
+	p.once.Do(func() {
+		close(p.closing)
+		p.submit.Lock()
+		close(p.stopped)
+		p.submit.Unlock()
+	})
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		return ctx.Err()
+	}
+}
+
+// spawn 启动 worker, 调用方需持有 p.mu
+func (p *WorkerPool) spawn() {
+	p.workers++
+	p.wg.Add(1)
+	go p.worker()
+}
+
+func (p *WorkerPool) worker() {
+	defer p.wg.Done()
+	for {
+		t := p.next()
+		if t == nil {
+			var ok bool
+			if t, ok = p.wait(); !ok {
+				return
+			}
+			if t == nil {
+				continue
+			}
+		}
+		p.run(t)
+
+		p.mu.Lock()
+		if p.workers > p.size {
+			p.workers--
+			p.mu.Unlock()
+			return
+		}
+		p.mu.Unlock()
+	}
+}
+
+// next 按优先级从高到低取出任务, 没有任务时返回 nil
+func (p *WorkerPool) next() *workerTask {
+	for i := len(p.queues) - 1; i >= 0; i-- {
+		select {
+		case t := <-p.queues[i]:
+			return t
+		default:
+		}
+	}
+	return nil
+}
+
+// pending 是否有排队中的任务
+func (p *WorkerPool) pending() bool {
+	for _, q := range p.queues {
+		if len(q) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// wait 等待任务, 返回 false 表示 worker 应当退出
+func (p *WorkerPool) wait() (*workerTask, bool) {
+	p.mu.Lock()
+	if p.workers > p.size {
+		p.workers--
+		p.mu.Unlock()
+		return nil, false
+	}
+	p.idle++
+	resized := p.resized
+	p.mu.Unlock()
+
+	var (
+		timeout <-chan time.Time
+		t       *workerTask
+		expired bool
+	)
+	if p.opts.IdleTimeout > 0 {
+		timer := time.NewTimer(p.opts.IdleTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case t = <-p.queues[PriorityHigh]:
+	case t = <-p.queues[PriorityNormal]:
+	case t = <-p.queues[PriorityLow]:
+	case <-resized:
+	case <-p.stopped:
+	case <-timeout:
+		expired = true
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.idle--
+	if t != nil {
+		return t, true
+	}
+	// 仍有排队的任务时不退出, 避免 Submit 认为有空闲 worker 而不补充
+	if p.pending() {
+		return nil, true
+	}
+	select {
+	case <-p.stopped:
+		p.workers--
+		return nil, false
+	default:
+	}
+	if expired && p.workers > min(p.opts.MinWorkers, p.size) {
+		p.workers--
+		return nil, false
+	}
+	return nil, true
+}
+
+func (p *WorkerPool) run(t *workerTask) {
+	start := time.Now()
+	p.queued.Add(-1)
+	p.running.Add(1)
+	p.started.Add(1)
+	p.waitNanos.Add(int64(start.Sub(t.enqueued)))
+
+	err := call(p.ctx, t.fn)
+
+	p.runNanos.Add(int64(time.Since(start)))
+	p.finished.Add(1)
+	p.running.Add(-1)
+	if err != nil {
+		p.failed.Add(1)
+		p.opts.OnError(err)
+		return
+	}
+	p.completed.Add(1)
+}
@@ -0,0 +1,84 @@
+package gpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerPool(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		errs  []error
+		order []int
+		block = make(chan struct{})
+		errA  = errors.New("a")
+		p     = NewWorkerPool(WorkerPoolOptions{Workers: 1, QueueSize: 2, FullPolicy: FullReject, OnError: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		}})
+		record = func(i int) func(ctx context.Context) error {
+			return func(ctx context.Context) error {
+				mu.Lock()
+				defer mu.Unlock()
+				order = append(order, i)
+				return nil
+			}
+		}
+	)
+	ctx := context.Background()
+	require.NoError(t, p.Submit(ctx, func(ctx context.Context) error {
+		<-block
+		return errA
+	}))
+	require.Eventually(t, func() bool { return p.Stats().Running == 1 }, time.Second, time.Millisecond)
+
+	require.NoError(t, p.SubmitPriority(ctx, PriorityLow, record(1)))
+	require.NoError(t, p.SubmitPriority(ctx, PriorityLow, record(2)))
+	require.ErrorIs(t, p.SubmitPriority(ctx, PriorityLow, record(3)), ErrQueueFull)
+	require.NoError(t, p.SubmitPriority(ctx, PriorityHigh, record(4)))
+	require.NoError(t, p.Submit(ctx, func(ctx context.Context) error { panic("boom") }))
+	require.Equal(t, int64(4), p.Stats().Queued)
+
+	close(block)
+	require.NoError(t, p.Close(ctx))
+	require.Equal(t, []int{4, 1, 2}, order)
+	require.Len(t, errs, 2)
+	require.ErrorIs(t, errs[0], errA)
+	var pe *PanicError
+	require.ErrorAs(t, errs[1], &pe)
+
+	s := p.Stats()
+	require.Equal(t, int64(3), s.Completed)
+	require.Equal(t, int64(2), s.Failed)
+	require.Equal(t, int64(0), s.Queued)
+	require.Equal(t, 0, s.Workers)
+	require.ErrorIs(t, p.Submit(ctx, record(5)), ErrPoolClosed)
+}
+
+func TestWorkerPoolResizeAndReap(t *testing.T) {
+	p := NewWorkerPool(WorkerPoolOptions{Workers: 4, MinWorkers: 1, IdleTimeout: 20 * time.Millisecond, FullPolicy: FullDrop, QueueSize: 1})
+	require.Equal(t, 4, p.Stats().Workers)
+	require.Eventually(t, func() bool { return p.Stats().Workers == 1 }, time.Second, 5*time.Millisecond)
+
+	p.Resize(3)
+	require.Equal(t, 3, p.Stats().Workers)
+	p.Resize(2)
+	require.Eventually(t, func() bool { return p.Stats().Workers <= 2 }, time.Second, time.Millisecond)
+
+	block := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		require.NoError(t, p.Submit(context.Background(), func(ctx context.Context) error {
+			<-block
+			return nil
+		}))
+	}
+	require.Positive(t, p.Stats().Dropped)
+	close(block)
+	require.NoError(t, p.Close(context.Background()))
+}
@@ -0,0 +1,125 @@
+package idgen
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/scrawld/library/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnowflake(t *testing.T) {
+	sf, err := NewSnowflake(7, nil)
+	require.NoError(t, err)
+
+	seen := map[int64]struct{}{}
+	var last int64
+	for i := 0; i < 10000; i++ {
+		id, err := sf.Next()
+		require.NoError(t, err)
+		require.Greater(t, id, last)
+		_, dup := seen[id]
+		require.False(t, dup)
+		seen[id], last = struct{}{}, id
+	}
+
+	parts := sf.Decompose(last)
+	require.Equal(t, int64(7), parts.WorkerId)
+	require.WithinDuration(t, time.Now(), parts.Time, time.Second)
+
+	_, err = NewSnowflake(MaxWorkerId+1, nil)
+	require.Error(t, err)
+}
+
+func TestSnowflakeClockRollback(t *testing.T) {
+	sf, err := NewSnowflake(1, &Options{MaxRollback: 5 * time.Millisecond})
+	require.NoError(t, err)
+	now := time.Now()
+	sf.now = func() time.Time { return now }
+
+	_, err = sf.Next()
+	require.NoError(t, err)
+	now = now.Add(-time.Second)
+	_, err = sf.Next()
+	require.ErrorIs(t, err, ErrClockRollback)
+}
+
+func TestLeasedSnowflake(t *testing.T) {
+	mc := redis.NewMemoryClient()
+	redis.SetDefaultClient(mc)
+	defer redis.SetDefaultClient(nil)
+
+	a, err := NewLeasedSnowflake(context.Background(), "order", time.Minute, nil)
+	require.NoError(t, err)
+	b, err := NewLeasedSnowflake(context.Background(), "order", time.Minute, nil)
+	require.NoError(t, err)
+	require.NotEqual(t, a.WorkerId(), b.WorkerId())
+
+	_, err = a.Next()
+	require.NoError(t, err)
+	require.NoError(t, a.Close())
+	_, err = a.Next()
+	require.ErrorIs(t, err, ErrLeaseLost)
+	require.NoError(t, b.Close())
+}
+
+func TestLeasedSnowflakeWaitsForPrevious(t *testing.T) {
+	mc := redis.NewMemoryClient()
+	redis.SetDefaultClient(mc)
+	defer redis.SetDefaultClient(nil)
+
+	// 上一个持有者记录的发号时间领先本机时钟
+	ahead := time.Now().Add(50 * time.Millisecond)
+	for id := 0; id <= MaxWorkerId; id++ {
+		key := fmt.Sprintf("{%s.worker.order.%d}.used", redis.KeyPrefix, id)
+		require.NoError(t, mc.Set(context.Background(), key, ahead.UnixMilli(), 0).Err())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := NewLeasedSnowflake(ctx, "order", time.Minute, nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	for id := 0; id <= MaxWorkerId; id++ {
+		key := fmt.Sprintf("{%s.worker.order.%d}.used", redis.KeyPrefix, id)
+		ms, err := mc.Get(context.Background(), key).Int64()
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, ms, ahead.UnixMilli()) // 放弃时不会降低记录
+	}
+
+	sf, err := NewLeasedSnowflake(context.Background(), "order", time.Minute, nil)
+	require.NoError(t, err)
+	id, err := sf.Next()
+	require.NoError(t, err)
+	require.Greater(t, sf.Decompose(id).Time.UnixMilli(), ahead.UnixMilli())
+
+	// Close 记录最后一次发号的时间
+	require.NoError(t, sf.Close())
+	key := fmt.Sprintf("{%s.worker.order.%d}.used", redis.KeyPrefix, sf.WorkerId())
+	ms, err := mc.Get(context.Background(), key).Int64()
+	require.NoError(t, err)
+	require.Equal(t, sf.Decompose(id).Time.UnixMilli(), ms)
+}
+
+func TestUUIDv7AndULID(t *testing.T) {
+	u, err := NewUUIDv7()
+	require.NoError(t, err)
+	require.Len(t, u, 36)
+	require.Equal(t, byte('7'), u[14])
+	tm, err := UUIDv7Time(u)
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now(), tm, time.Second)
+
+	id, err := NewULID()
+	require.NoError(t, err)
+	require.Len(t, id, 26)
+	tm, err = ULIDTime(id)
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now(), tm, time.Second)
+
+	time.Sleep(2 * time.Millisecond)
+	id2, err := NewULID()
+	require.NoError(t, err)
+	require.Less(t, id, id2)
+}
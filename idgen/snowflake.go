@@ -0,0 +1,215 @@
+package idgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/scrawld/library/redis"
+)
+
+const (
+	WorkerBits   = 10                  // worker ID 位数
+	SequenceBits = 12                  // 毫秒内序列号位数
+	MaxWorkerId  = 1<<WorkerBits - 1   // 最大 worker ID
+	maxSequence  = 1<<SequenceBits - 1 // 最大序列号
+	timeShift    = WorkerBits + SequenceBits
+)
+
+// DefaultEpoch 默认的起始时间, 41 位毫秒时间戳可使用约 69 年
+var DefaultEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var (
+	ErrClockRollback = errors.New("idgen: clock moved backwards") // 时钟回拨超过 MaxRollback
+	ErrLeaseLost     = errors.New("idgen: worker lease lost")     // worker ID 租约已失效
+	ErrTimeOverflow  = errors.New("idgen: timestamp overflow")    // 超出 41 位时间戳范围
+)
+
+// Options 生成器选项, 零值使用默认值
+type Options struct {
+	Epoch       time.Time     // 起始时间, 默认 DefaultEpoch, 同一业务的所有副本必须一致
+	MaxRollback time.Duration // 时钟回拨不超过该值时等待时钟追上, 否则返回 ErrClockRollback, 默认 10ms
+}
+
+// Parts 分解后的 ID
+type Parts struct {
+	Time     time.Time // 生成时间, 精确到毫秒
+	WorkerId int64
+	Sequence int64
+}
+
+// Snowflake 64 位趋势递增 ID 生成器, 结构为 1 位符号 + 41 位毫秒时间戳 + 10 位 worker ID + 12 位序列号
+type Snowflake struct {
+	mu          sync.Mutex
+	epoch       int64 // 毫秒
+	maxRollback time.Duration
+	workerId    int64
+	lease       *redis.WorkerLease
+	last        int64
+	seq         int64
+	now         func() time.Time
+}
+
+/**
+ * NewSnowflake 使用固定的 worker ID 创建生成器, workerId 范围 [0, MaxWorkerId]
+ *
+ * Example:
+ *
+ * sf, err := idgen.NewSnowflake(1, nil)
+ * id, err := sf.Next()
+ * parts := sf.Decompose(id)
+ */
+func NewSnowflake(workerId int64, opts *Options) (*Snowflake, error) {
+	if workerId < 0 || workerId > MaxWorkerId {
+		return nil, fmt.Errorf("idgen: worker id %d out of range [0, %d]", workerId, MaxWorkerId)
+	}
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.Epoch.IsZero() {
+		o.Epoch = DefaultEpoch
+	}
+	if o.MaxRollback <= 0 {
+		o.MaxRollback = 10 * time.Millisecond
+	}
+	return &Snowflake{
+		epoch:       o.Epoch.UnixMilli(),
+		maxRollback: o.MaxRollback,
+		workerId:    workerId,
+		last:        -1,
+		now:         time.Now,
+	}, nil
+}
+
+/**
+ * NewLeasedSnowflake 通过 redis 租用 worker ID 创建生成器, 副本之间不会冲突
+ * 上一个持有者在租约中记录了最后可能发号的时间, 本机时钟落后时等待追上后再返回, ctx 结束时返回错误
+ * 租约失效(例如长时间无法连接 redis)后 Next 返回 ErrLeaseLost, 需要重新创建生成器
+ * 进程退出时调用 Close 释放 worker ID, 并记录最后一次发号的时间
+ *
+ * Example:
+ *
+ * sf, err := idgen.NewLeasedSnowflake(ctx, "order", 30*time.Second, nil)
+ * if err != nil {
+ * 	return err
+ * }
+ * defer sf.Close()
+ *
+ * id, err := sf.Next()
+ */
+func NewLeasedSnowflake(ctx context.Context, name string, ttl time.Duration, opts *Options) (*Snowflake, error) {
+	s, err := NewSnowflake(0, opts)
+	if err != nil {
+		return nil, err
+	}
+	lease := redis.NewWorkerLease(name, MaxWorkerId+1).WithLastUsed(s.lastIssued)
+	if s.workerId, err = lease.Acquire(ctx, ttl); err != nil {
+		return nil, fmt.Errorf("acquire worker id error: %w", err)
+	}
+	if err = s.waitAfter(ctx, lease.PrevUsed()); err != nil {
+		lease.Release()
+		return nil, err
+	}
+	s.lease = lease
+	return s, nil
+}
+
+// lastIssued 返回最后一次发号的时间, 未发号时为零值
+func (s *Snowflake) lastIssued() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.last < 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(s.last + s.epoch)
+}
+
+// waitAfter 等待时钟超过 t, 之后生成的 ID 时间戳均大于 t
+func (s *Snowflake) waitAfter(ctx context.Context, t time.Time) error {
+	if t.IsZero() {
+		return nil
+	}
+	for {
+		d := t.Sub(s.now()) + time.Millisecond
+		if d <= 0 {
+			break
+		}
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("wait for clock to pass %s error: %w", t.Format(time.RFC3339Nano), ctx.Err())
+		case <-timer.C:
+		}
+	}
+	s.mu.Lock()
+	// 序列号置满, 即使时钟随后回拨到 t 所在的毫秒也会等待下一毫秒
+	s.last, s.seq = max(s.last, t.UnixMilli()-s.epoch), maxSequence
+	s.mu.Unlock()
+	return nil
+}
+
+// WorkerId 返回 worker ID
+func (s *Snowflake) WorkerId() int64 {
+	return s.workerId
+}
+
+// Next 生成下一个 ID
+func (s *Snowflake) Next() (int64, error) {
+	if s.lease != nil && !s.lease.Valid() {
+		return 0, ErrLeaseLost
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now().UnixMilli() - s.epoch
+	if now < s.last {
+		// 时钟回拨, 小范围内等待追上, 期间不释放锁以保证不重复
+		back := time.Duration(s.last-now) * time.Millisecond
+		if back > s.maxRollback {
+			return 0, fmt.Errorf("%w by %s", ErrClockRollback, back)
+		}
+		time.Sleep(back)
+		if now = s.now().UnixMilli() - s.epoch; now < s.last {
+			return 0, fmt.Errorf("%w by %s", ErrClockRollback, time.Duration(s.last-now)*time.Millisecond)
+		}
+	}
+	if now == s.last {
+		s.seq = (s.seq + 1) & maxSequence
+		if s.seq == 0 {
+			// 当前毫秒序列号用尽, 等待下一毫秒
+			for now <= s.last {
+				time.Sleep(100 * time.Microsecond)
+				now = s.now().UnixMilli() - s.epoch
+			}
+		}
+	} else {
+		s.seq = 0
+	}
+	if now < 0 || now >= 1<<41 {
+		return 0, ErrTimeOverflow
+	}
+	s.last = now
+	return now<<timeShift | s.workerId<<SequenceBits | s.seq, nil
+}
+
+// Decompose 分解 ID
+func (s *Snowflake) Decompose(id int64) Parts {
+	return Parts{
+		Time:     time.UnixMilli(id>>timeShift + s.epoch),
+		WorkerId: id >> SequenceBits & MaxWorkerId,
+		Sequence: id & maxSequence,
+	}
+}
+
+// Close 释放租用的 worker ID, 之后 Next 返回 ErrLeaseLost
+func (s *Snowflake) Close() error {
+	if s.lease == nil {
+		return nil
+	}
+	return s.lease.Release()
+}
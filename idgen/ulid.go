@@ -0,0 +1,107 @@
+package idgen
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// crockford Crockford Base32 字母表, ULID 使用
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+/**
+ * NewUUIDv7 生成 UUIDv7(RFC 9562), 前 48 位为毫秒时间戳, 字符串按时间排序, 适合对外暴露的 ID
+ * 同一毫秒内的顺序不保证
+ *
+ * Example:
+ *
+ * id, err := idgen.NewUUIDv7() // 018e1b6c-3a2f-7c4e-9b1a-2f6d8e0c4a1b
+ */
+func NewUUIDv7() (string, error) {
+	var u uuid.UUID
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", err
+	}
+	putMillis(u[:6], time.Now().UnixMilli())
+	u[6] = u[6]&0x0f | 0x70 // version 7
+	u[8] = u[8]&0x3f | 0x80 // variant RFC 4122
+	return u.String(), nil
+}
+
+// UUIDv7Time 解析 UUIDv7 中的时间
+func UUIDv7Time(s string) (time.Time, error) {
+	u, err := uuid.Parse(s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if u.Version() != 7 {
+		return time.Time{}, fmt.Errorf("idgen: %s is not a uuid v7", s)
+	}
+	return time.UnixMilli(millis(u[:6])), nil
+}
+
+/**
+ * NewULID 生成 ULID, 26 位 Crockford Base32 字符串, 前 10 位为毫秒时间戳, 按时间排序
+ * 同一毫秒内的顺序不保证
+ *
+ * Example:
+ *
+ * id, err := idgen.NewULID() // 01HQ3C7W9S5N0V8K2J4M6P8R0T
+ */
+func NewULID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", err
+	}
+	putMillis(b[:6], time.Now().UnixMilli())
+	return encodeULID(b), nil
+}
+
+// ULIDTime 解析 ULID 中的时间
+func ULIDTime(s string) (time.Time, error) {
+	if len(s) != 26 {
+		return time.Time{}, errors.New("idgen: invalid ulid length")
+	}
+	var ms int64
+	for _, c := range strings.ToUpper(s[:10]) {
+		i := strings.IndexRune(crockford, c)
+		if i < 0 {
+			return time.Time{}, fmt.Errorf("idgen: invalid ulid character %q", c)
+		}
+		ms = ms<<5 | int64(i)
+	}
+	return time.UnixMilli(ms), nil
+}
+
+// encodeULID 将 128 位编码为 26 位 Base32, 首字符只使用 3 位
+func encodeULID(b [16]byte) string {
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out)
+}
+
+func putMillis(b []byte, ms int64) {
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+}
+
+func millis(b []byte) int64 {
+	var ms int64
+	for _, c := range b {
+		ms = ms<<8 | int64(c)
+	}
+	return ms
+}
@@ -0,0 +1,650 @@
+package jobqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scrawld/library/gpool"
+	"github.com/scrawld/library/redis"
+	"github.com/scrawld/library/safe_stop"
+	"github.com/scrawld/zaplog"
+
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+var (
+	// promoteScript 将到期的延迟任务移入 stream, 返回移动数量
+	promoteScript = goredis.NewScript(`
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local items = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", now, "LIMIT", 0, tonumber(ARGV[1]))
+for _, item in ipairs(items) do
+	local job = cjson.decode(item)
+	redis.call("XADD", KEYS[2], "*", "id", job.id, "type", job.type, "payload", job.payload, "attempt", job.attempt, "enqueued_at", job.enqueued_at)
+	redis.call("ZREM", KEYS[1], item)
+end
+return #items`)
+
+	// delayScript 以服务端时间为基准加入延迟队列
+	delayScript = goredis.NewScript(`
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+return redis.call("ZADD", KEYS[1], now + tonumber(ARGV[1]), ARGV[2])`)
+
+	// autoclaimScript 执行 XAUTOCLAIM, 返回下次起始 ID、消息及各消息的投递次数, 兼容 Redis 7 新增的第三项
+	autoclaimScript = goredis.NewScript(`
+local r = redis.call("XAUTOCLAIM", KEYS[1], ARGV[1], ARGV[2], ARGV[3], ARGV[4], "COUNT", ARGV[5])
+local counts = {}
+for i, e in ipairs(r[2]) do
+	counts[i] = 0
+	if e then
+		local p = redis.call("XPENDING", KEYS[1], ARGV[1], e[1], e[1], 1)
+		if p[1] then
+			counts[i] = p[1][4]
+		end
+	end
+end
+return {r[1], r[2], counts}`)
+
+	// ackScript 确认并删除消息
+	ackScript = goredis.NewScript(`
+redis.call("XACK", KEYS[1], ARGV[1], ARGV[2])
+return redis.call("XDEL", KEYS[1], ARGV[2])`)
+
+	// retryScript 确认消息并将任务放入延迟队列等待重试
+	retryScript = goredis.NewScript(`
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+redis.call("ZADD", KEYS[2], now + tonumber(ARGV[3]), ARGV[4])
+redis.call("XACK", KEYS[1], ARGV[1], ARGV[2])
+return redis.call("XDEL", KEYS[1], ARGV[2])`)
+
+	// deadScript 确认消息并将任务写入死信 stream
+	deadScript = goredis.NewScript(`
+local args = {KEYS[2]}
+if tonumber(ARGV[3]) > 0 then
+	table.insert(args, "MAXLEN")
+	table.insert(args, "~")
+	table.insert(args, ARGV[3])
+end
+table.insert(args, "*")
+for i = 4, #ARGV, 2 do
+	table.insert(args, ARGV[i])
+	table.insert(args, ARGV[i + 1])
+end
+redis.call("XADD", unpack(args))
+redis.call("XACK", KEYS[1], ARGV[1], ARGV[2])
+return redis.call("XDEL", KEYS[1], ARGV[2])`)
+)
+
+// Job 任务
+type Job struct {
+	ID         string    // 任务 ID, 重试时保持不变
+	MessageID  string    // stream 消息 ID
+	Type       string    // 任务类型
+	Payload    []byte    // JSON 格式的任务参数
+	Attempt    int       // 第几次执行, 从 1 开始
+	EnqueuedAt time.Time // 入队时间
+}
+
+// Handler 任务处理函数, 返回错误时按配置重试
+type Handler func(ctx context.Context, job *Job) error
+
+// Cmdable 队列使用到的命令集合, *redis.Client、*redis.ClusterClient 等 go-redis 客户端均已实现
+type Cmdable interface {
+	goredis.Scripter
+
+	XAdd(ctx context.Context, a *goredis.XAddArgs) *goredis.StringCmd
+	XLen(ctx context.Context, stream string) *goredis.IntCmd
+	XRangeN(ctx context.Context, stream, start, stop string, count int64) *goredis.XMessageSliceCmd
+	XGroupCreateMkStream(ctx context.Context, stream, group, start string) *goredis.StatusCmd
+	XReadGroup(ctx context.Context, a *goredis.XReadGroupArgs) *goredis.XStreamSliceCmd
+	XClaimJustID(ctx context.Context, a *goredis.XClaimArgs) *goredis.StringSliceCmd
+	ZCard(ctx context.Context, key string) *goredis.IntCmd
+}
+
+var (
+	_ Cmdable = (*goredis.Client)(nil)
+	_ Cmdable = (*goredis.ClusterClient)(nil)
+	_ Cmdable = (goredis.UniversalClient)(nil)
+)
+
+// Options 队列配置
+type Options struct {
+	Client        Cmdable                         // 使用的客户端, 默认 redis.GetClient()
+	Group         string                          // 消费组, 默认 default
+	Consumer      string                          // 消费者名称, 默认 <hostname>-<pid>
+	Concurrency   int                             // 并发处理数, 默认 10
+	MaxRetry      int                             // 失败后最大重试次数, 默认 3, 小于 0 表示不重试
+	Backoff       func(attempt int) time.Duration // 第 attempt 次失败后的重试间隔, 默认从 1s 开始指数增长, 最大 10 分钟
+	JobTimeout    time.Duration                   // 单个任务的执行超时, 0 表示不限制
+	Block         time.Duration                   // XREADGROUP 阻塞时间, 默认 2s
+	ClaimIdle     time.Duration                   // 超过该时间未确认的消息会被重新认领, 默认 5 分钟; 执行中的任务会定期刷新空闲时间, 不会被认领
+	PromotePeriod time.Duration                   // 检查到期延迟任务的间隔, 默认 1s
+	DeadMaxLen    int64                           // 死信 stream 的近似最大长度, 0 表示不限制
+}
+
+// Queue 基于 Redis Streams 消费组的可靠任务队列
+type Queue struct {
+	name     string
+	opts     Options
+	stream   string
+	delayed  string
+	dead     string
+	mu       sync.RWMutex
+	handlers map[string]Handler
+	inflight sync.Map // 本消费者执行中的消息 ID
+}
+
+type jobCtxKey struct{}
+
+/**
+ * New 创建任务队列, 使用的 key:
+ * 	<KeyPrefix>.queue.{name}         任务 stream
+ * 	<KeyPrefix>.queue.{name}.delayed 延迟及等待重试的任务(sorted set)
+ * 	<KeyPrefix>.queue.{name}.dead    超过重试次数的任务 stream
+ * 使用 hash tag 保证集群模式下位于同一 slot
+ *
+ * Example:
+ *
+ * type SendMail struct {
+ * 	To string `json:"to"`
+ * }
+ *
+ * q := jobqueue.New("mail", jobqueue.Options{Concurrency: 20})
+ * jobqueue.Register(q, "send", func(ctx context.Context, p SendMail) error {
+ * 	return mailer.Send(ctx, p.To)
+ * })
+ * go q.Run(ctx) // ctx 取消后停止读取, 等待执行中的任务完成
+ *
+ * q.Enqueue(ctx, "send", SendMail{To: "a@b.com"})
+ * q.EnqueueIn(ctx, "send", SendMail{To: "a@b.com"}, time.Hour)
+ */
+func New(name string, opts Options) *Queue {
+	if opts.Group == "" {
+		opts.Group = "default"
+	}
+	if opts.Consumer == "" {
+		hostname, _ := os.Hostname()
+		opts.Consumer = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 10
+	}
+	if opts.MaxRetry == 0 {
+		opts.MaxRetry = 3
+	}
+	if opts.Backoff == nil {
+		opts.Backoff = DefaultBackoff
+	}
+	if opts.Block <= 0 {
+		opts.Block = 2 * time.Second
+	}
+	if opts.ClaimIdle <= 0 {
+		opts.ClaimIdle = 5 * time.Minute
+	}
+	if opts.PromotePeriod <= 0 {
+		opts.PromotePeriod = time.Second
+	}
+	base := fmt.Sprintf("%s.queue.{%s}", redis.KeyPrefix, name)
+	return &Queue{
+		name:     name,
+		opts:     opts,
+		stream:   base,
+		delayed:  base + ".delayed",
+		dead:     base + ".dead",
+		handlers: map[string]Handler{},
+	}
+}
+
+// DefaultBackoff 默认重试间隔, 1s、2s、4s... 最大 10 分钟
+func DefaultBackoff(attempt int) time.Duration {
+	if attempt > 10 {
+		return 10 * time.Minute
+	}
+	d := time.Second << uint(attempt-1)
+	if d > 10*time.Minute || d <= 0 {
+		d = 10 * time.Minute
+	}
+	return d
+}
+
+// client 返回使用的客户端
+func (q *Queue) client() Cmdable {
+	if q.opts.Client != nil {
+		return q.opts.Client
+	}
+	return redis.GetClient()
+}
+
+// Name 返回队列名称
+func (q *Queue) Name() string {
+	return q.name
+}
+
+// Handle 注册任务处理函数
+func (q *Queue) Handle(jobType string, h Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[jobType] = h
+}
+
+// Register 注册类型化的任务处理函数, 任务参数从 JSON 解析为 T, 可通过 JobFromContext 获取任务信息
+func Register[T any](q *Queue, jobType string, fn func(ctx context.Context, payload T) error) {
+	q.Handle(jobType, func(ctx context.Context, job *Job) error {
+		var payload T
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return fmt.Errorf("unmarshal payload error: %s", err)
+		}
+		return fn(ctx, payload)
+	})
+}
+
+// JobFromContext 返回处理函数中当前执行的任务
+func JobFromContext(ctx context.Context) (*Job, bool) {
+	job, ok := ctx.Value(jobCtxKey{}).(*Job)
+	return job, ok
+}
+
+// Enqueue 立即入队, 返回任务 ID
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload interface{}) (string, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("marshal payload error: %s", err)
+	}
+	id := newJobId()
+	err = q.client().XAdd(ctx, &goredis.XAddArgs{
+		Stream: q.stream,
+		Values: []interface{}{
+			"id", id,
+			"type", jobType,
+			"payload", string(body),
+			"attempt", "1",
+			"enqueued_at", strconv.FormatInt(time.Now().UnixMilli(), 10),
+		},
+	}).Err()
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// EnqueueIn 延迟 delay 后入队, 返回任务 ID
+func (q *Queue) EnqueueIn(ctx context.Context, jobType string, payload interface{}, delay time.Duration) (string, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("marshal payload error: %s", err)
+	}
+	job := &Job{ID: newJobId(), Type: jobType, Payload: body, Attempt: 1, EnqueuedAt: time.Now()}
+	member, err := delayedMember(job)
+	if err != nil {
+		return "", err
+	}
+	if err = delayScript.Run(ctx, q.client(), []string{q.delayed}, delay.Milliseconds(), member).Err(); err != nil {
+		return "", err
+	}
+	return job.ID, nil
+}
+
+// EnqueueAt 在指定时间入队, 返回任务 ID
+func (q *Queue) EnqueueAt(ctx context.Context, jobType string, payload interface{}, at time.Time) (string, error) {
+	return q.EnqueueIn(ctx, jobType, payload, time.Until(at))
+}
+
+// Run 启动消费, 阻塞直到 ctx 结束, 返回前停止读取新任务并等待执行中的任务完成
+// 运行期间计入 safe_stop, 进程退出时可通过 safe_stop.Wait 等待排空
+func (q *Queue) Run(ctx context.Context) error {
+	safe_stop.Add(1)
+	defer safe_stop.Done()
+
+	if err := q.createGroup(ctx); err != nil {
+		return err
+	}
+	var (
+		log    = zaplog.New().Named("JobQueue")
+		pool   = gpool.New(q.opts.Concurrency)
+		jobCtx = context.WithoutCancel(ctx) // 停止时不中断执行中的任务
+		wg     = &sync.WaitGroup{}
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		q.loop(ctx, q.opts.PromotePeriod, func() { q.promote(ctx, log) })
+	}()
+	go func() {
+		defer wg.Done()
+		q.loop(ctx, q.opts.ClaimIdle/2, func() { q.reclaim(ctx, jobCtx, pool, log) })
+	}()
+	// 执行中的任务持续刷新空闲时间, 直到全部完成
+	hbCtx, stopHeartbeat := context.WithCancel(jobCtx)
+	hbDone := make(chan struct{})
+	go func() {
+		defer close(hbDone)
+		q.loop(hbCtx, q.opts.ClaimIdle/4, func() { q.heartbeat(hbCtx, log) })
+	}()
+
+	for ctx.Err() == nil {
+		streams, err := q.client().XReadGroup(ctx, &goredis.XReadGroupArgs{
+			Group:    q.opts.Group,
+			Consumer: q.opts.Consumer,
+			Streams:  []string{q.stream, ">"},
+			Count:    int64(q.opts.Concurrency),
+			Block:    q.opts.Block,
+		}).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Warnf("queue %s read error: %s", q.name, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				q.dispatch(jobCtx, pool, msg, 1)
+			}
+		}
+	}
+	wg.Wait()
+	pool.Wait()
+	stopHeartbeat()
+	<-hbDone
+	return nil
+}
+
+// Pending 返回 stream 中等待处理与已读取未确认的任务数量
+func (q *Queue) Pending(ctx context.Context) (int64, error) {
+	return q.client().XLen(ctx, q.stream).Result()
+}
+
+// Delayed 返回延迟及等待重试的任务数量
+func (q *Queue) Delayed(ctx context.Context) (int64, error) {
+	return q.client().ZCard(ctx, q.delayed).Result()
+}
+
+// DeadLetters 返回死信 stream 中最早的 count 条记录
+func (q *Queue) DeadLetters(ctx context.Context, count int64) ([]goredis.XMessage, error) {
+	return q.client().XRangeN(ctx, q.dead, "-", "+", count).Result()
+}
+
+func (q *Queue) createGroup(ctx context.Context) error {
+	err := q.client().XGroupCreateMkStream(ctx, q.stream, q.opts.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("create group %s error: %s", q.opts.Group, err)
+	}
+	return nil
+}
+
+// loop 每隔 period 执行一次 fn 直到 ctx 结束
+func (q *Queue) loop(ctx context.Context, period time.Duration, fn func()) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fn()
+		}
+	}
+}
+
+// promote 将到期的延迟任务移入 stream
+func (q *Queue) promote(ctx context.Context, log *zaplog.TracingLogger) {
+	for {
+		n, err := promoteScript.Run(ctx, q.client(), []string{q.delayed, q.stream}, 100).Int64()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Warnf("queue %s promote error: %s", q.name, err)
+			}
+			return
+		}
+		if n < 100 {
+			return
+		}
+	}
+}
+
+// reclaim 认领长时间未确认的消息(例如消费者崩溃)
+func (q *Queue) reclaim(ctx, jobCtx context.Context, pool *gpool.Pool, log *zaplog.TracingLogger) {
+	start := "0-0"
+	for {
+		msgs, next, err := q.autoclaim(ctx, start)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Warnf("queue %s reclaim error: %s", q.name, err)
+			}
+			return
+		}
+		for _, msg := range msgs {
+			q.dispatch(jobCtx, pool, msg.XMessage, msg.deliveries)
+		}
+		if next == "0-0" || len(msgs) == 0 {
+			return
+		}
+		start = next
+	}
+}
+
+// claimedMessage 认领的消息及其投递次数
+type claimedMessage struct {
+	goredis.XMessage
+	deliveries int64
+}
+
+// autoclaim 从 start 开始认领空闲超过 ClaimIdle 的消息, 返回消息及下次起始 ID
+func (q *Queue) autoclaim(ctx context.Context, start string) ([]claimedMessage, string, error) {
+	res, err := autoclaimScript.Run(ctx, q.client(), []string{q.stream},
+		q.opts.Group, q.opts.Consumer, q.opts.ClaimIdle.Milliseconds(), start, q.opts.Concurrency).Slice()
+	if err != nil {
+		return nil, "", err
+	}
+	if len(res) != 3 {
+		return nil, "", fmt.Errorf("unexpected xautoclaim reply length %d", len(res))
+	}
+	next, _ := res[0].(string)
+	entries, _ := res[1].([]interface{})
+	counts, _ := res[2].([]interface{})
+	msgs := make([]claimedMessage, 0, len(entries))
+	for i, e := range entries {
+		entry, _ := e.([]interface{})
+		if len(entry) != 2 {
+			continue
+		}
+		id, _ := entry[0].(string)
+		fields, _ := entry[1].([]interface{})
+		// Redis 6.2 中已删除的消息字段为 nil
+		if id == "" || fields == nil {
+			continue
+		}
+		values := make(map[string]interface{}, len(fields)/2)
+		for i := 0; i+1 < len(fields); i += 2 {
+			k, _ := fields[i].(string)
+			values[k] = fields[i+1]
+		}
+		var deliveries int64
+		if i < len(counts) {
+			deliveries, _ = counts[i].(int64)
+		}
+		msgs = append(msgs, claimedMessage{XMessage: goredis.XMessage{ID: id, Values: values}, deliveries: deliveries})
+	}
+	return msgs, next, nil
+}
+
+// heartbeat 以 XCLAIM 刷新本消费者执行中消息的空闲时间, 避免执行时间超过 ClaimIdle 的任务被其他消费者认领
+func (q *Queue) heartbeat(ctx context.Context, log *zaplog.TracingLogger) {
+	var ids []string
+	q.inflight.Range(func(k, _ interface{}) bool {
+		ids = append(ids, k.(string))
+		return true
+	})
+	if len(ids) == 0 {
+		return
+	}
+	err := q.client().XClaimJustID(ctx, &goredis.XClaimArgs{
+		Stream:   q.stream,
+		Group:    q.opts.Group,
+		Consumer: q.opts.Consumer,
+		Messages: ids,
+	}).Err()
+	if err != nil && ctx.Err() == nil {
+		log.Warnf("queue %s heartbeat error: %s", q.name, err)
+	}
+}
+
+// dispatch 执行消息, 同一消息在本消费者中同时只执行一次, deliveries 为消息的投递次数
+func (q *Queue) dispatch(ctx context.Context, pool *gpool.Pool, msg goredis.XMessage, deliveries int64) {
+	if _, loaded := q.inflight.LoadOrStore(msg.ID, struct{}{}); loaded {
+		return
+	}
+	pool.Add(1)
+	go func() {
+		defer pool.Done()
+		defer q.inflight.Delete(msg.ID)
+		q.process(ctx, msg, deliveries)
+	}()
+}
+
+// process 执行任务, 成功后确认, 失败后重试或写入死信
+// 消息被重新认领时每次投递都计为一次执行, 使导致消费者崩溃的任务在超过重试次数后写入死信
+func (q *Queue) process(ctx context.Context, msg goredis.XMessage, deliveries int64) {
+	log := zaplog.New(msg.ID).Named("JobQueue")
+
+	job, err := parseJob(msg)
+	if err != nil {
+		q.bury(ctx, log, msg, job, err)
+		return
+	}
+	if deliveries > 1 {
+		job.Attempt += int(deliveries - 1)
+		if job.Attempt > max(q.opts.MaxRetry, 0)+1 {
+			q.bury(ctx, log, msg, job, fmt.Errorf("job abandoned after %d deliveries", deliveries))
+			return
+		}
+	}
+	q.mu.RLock()
+	h, ok := q.handlers[job.Type]
+	q.mu.RUnlock()
+	if !ok {
+		q.bury(ctx, log, msg, job, fmt.Errorf("no handler for job type %s", job.Type))
+		return
+	}
+
+	start := time.Now()
+	err = q.call(ctx, h, job)
+	if err == nil {
+		if err = ackScript.Run(ctx, q.client(), []string{q.stream}, q.opts.Group, msg.ID).Err(); err != nil {
+			log.Warnf("queue %s ack %s error: %s", q.name, job.ID, err)
+		}
+		return
+	}
+	log.Warnf("queue %s job %s(%s) attempt %d failed, take: %s, error: %s", q.name, job.ID, job.Type, job.Attempt, time.Since(start), err)
+
+	if job.Attempt > q.opts.MaxRetry {
+		q.bury(ctx, log, msg, job, err)
+		return
+	}
+	delay := q.opts.Backoff(job.Attempt)
+	job.Attempt++
+	member, merr := delayedMember(job)
+	if merr != nil {
+		q.bury(ctx, log, msg, job, merr)
+		return
+	}
+	if err = retryScript.Run(ctx, q.client(), []string{q.stream, q.delayed}, q.opts.Group, msg.ID, delay.Milliseconds(), member).Err(); err != nil {
+		log.Errorf("queue %s retry %s error: %s", q.name, job.ID, err)
+	}
+}
+
+// call 执行处理函数并将 panic 转为错误
+func (q *Queue) call(ctx context.Context, h Handler, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	ctx = context.WithValue(ctx, jobCtxKey{}, job)
+	if q.opts.JobTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, q.opts.JobTimeout)
+		defer cancel()
+	}
+	return h(ctx, job)
+}
+
+// bury 将任务写入死信 stream
+func (q *Queue) bury(ctx context.Context, log *zaplog.TracingLogger, msg goredis.XMessage, job *Job, cause error) {
+	args := []interface{}{q.opts.Group, msg.ID, q.opts.DeadMaxLen}
+	for k, v := range msg.Values {
+		args = append(args, k, v)
+	}
+	args = append(args, "error", cause.Error(), "failed_at", strconv.FormatInt(time.Now().UnixMilli(), 10))
+	if err := deadScript.Run(ctx, q.client(), []string{q.stream, q.dead}, args...).Err(); err != nil {
+		log.Errorf("queue %s bury %s error: %s", q.name, msg.ID, err)
+		return
+	}
+	if job != nil {
+		log.Errorf("queue %s job %s(%s) moved to dead letter: %s", q.name, job.ID, job.Type, cause)
+	}
+}
+
+// parseJob 解析 stream 消息
+func parseJob(msg goredis.XMessage) (*Job, error) {
+	get := func(k string) string {
+		v, _ := msg.Values[k].(string)
+		return v
+	}
+	job := &Job{
+		ID:        get("id"),
+		MessageID: msg.ID,
+		Type:      get("type"),
+		Payload:   []byte(get("payload")),
+	}
+	if job.Type == "" {
+		return nil, errors.New("job type is empty")
+	}
+	attempt, err := strconv.Atoi(get("attempt"))
+	if err != nil {
+		return nil, fmt.Errorf("parse attempt error: %s", err)
+	}
+	job.Attempt = attempt
+	if ms, err := strconv.ParseInt(get("enqueued_at"), 10, 64); err == nil {
+		job.EnqueuedAt = time.UnixMilli(ms)
+	}
+	return job, nil
+}
+
+// delayedMember 将任务编码为延迟队列成员, 字段与 stream 消息一致
+func delayedMember(job *Job) (string, error) {
+	b, err := json.Marshal(map[string]string{
+		"id":          job.ID,
+		"type":        job.Type,
+		"payload":     string(job.Payload),
+		"attempt":     strconv.Itoa(job.Attempt),
+		"enqueued_at": strconv.FormatInt(job.EnqueuedAt.UnixMilli(), 10),
+	})
+	if err != nil {
+		return "", fmt.Errorf("marshal job error: %s", err)
+	}
+	return string(b), nil
+}
+
+func newJobId() string {
+	uid, _ := uuid.NewRandom()
+	return uid.String()
+}
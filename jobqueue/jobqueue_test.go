@@ -0,0 +1,302 @@
+package jobqueue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/scrawld/zaplog"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	zaplog.Logger = zap.NewNop()
+	os.Exit(m.Run())
+}
+
+type testPayload struct {
+	N int `json:"n"`
+}
+
+func newTestClient(t *testing.T) *goredis.Client {
+	mr := miniredis.RunT(t)
+	c := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func newTestQueue(c Cmdable, consumer string, opts Options) *Queue {
+	opts.Client = c
+	opts.Consumer = consumer
+	if opts.Block == 0 {
+		opts.Block = 20 * time.Millisecond
+	}
+	if opts.PromotePeriod == 0 {
+		opts.PromotePeriod = 10 * time.Millisecond
+	}
+	if opts.Backoff == nil {
+		opts.Backoff = func(int) time.Duration { return 10 * time.Millisecond }
+	}
+	return New("test", opts)
+}
+
+// run 启动消费并在测试结束时停止
+func run(t *testing.T, q *Queue) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- q.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		require.NoError(t, <-done)
+	})
+}
+
+func TestEnqueue(t *testing.T) {
+	c := newTestClient(t)
+	q := newTestQueue(c, "c1", Options{})
+	ctx := context.Background()
+
+	// 处理函数只记录结果, 断言在测试协程中进行
+	type result struct {
+		n   int
+		job *Job
+	}
+	got := make(chan result, 1)
+	Register(q, "add", func(ctx context.Context, p testPayload) error {
+		job, _ := JobFromContext(ctx)
+		got <- result{n: p.N, job: job}
+		return nil
+	})
+	_, err := q.Enqueue(ctx, "add", testPayload{N: 7})
+	require.NoError(t, err)
+	run(t, q)
+
+	select {
+	case r := <-got:
+		require.Equal(t, 7, r.n)
+		require.NotNil(t, r.job)
+		require.Equal(t, 1, r.job.Attempt)
+	case <-time.After(time.Second):
+		t.Fatal("job not processed")
+	}
+	require.Eventually(t, func() bool {
+		n, err := q.Pending(ctx)
+		return err == nil && n == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestEnqueueIn(t *testing.T) {
+	c := newTestClient(t)
+	q := newTestQueue(c, "c1", Options{})
+	ctx := context.Background()
+
+	var done atomic.Int64
+	q.Handle("delay", func(ctx context.Context, job *Job) error {
+		done.Store(time.Now().UnixMilli())
+		return nil
+	})
+	start := time.Now()
+	_, err := q.EnqueueIn(ctx, "delay", nil, 200*time.Millisecond)
+	require.NoError(t, err)
+	n, err := q.Delayed(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+	run(t, q)
+
+	require.Eventually(t, func() bool { return done.Load() > 0 }, time.Second, 10*time.Millisecond)
+	require.GreaterOrEqual(t, done.Load()-start.UnixMilli(), int64(200))
+	n, err = q.Delayed(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), n)
+}
+
+func TestRetry(t *testing.T) {
+	c := newTestClient(t)
+	q := newTestQueue(c, "c1", Options{MaxRetry: 2})
+	ctx := context.Background()
+
+	var (
+		mu       sync.Mutex
+		attempts []int
+		ids      = map[string]struct{}{}
+	)
+	q.Handle("flaky", func(ctx context.Context, job *Job) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, job.Attempt)
+		ids[job.ID] = struct{}{}
+		if job.Attempt < 3 {
+			return errors.New("temporary")
+		}
+		return nil
+	})
+	_, err := q.Enqueue(ctx, "flaky", nil)
+	require.NoError(t, err)
+	run(t, q)
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(attempts) == 3
+	}, 2*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	require.Equal(t, []int{1, 2, 3}, attempts)
+	require.Len(t, ids, 1) // 重试时任务 ID 不变
+	mu.Unlock()
+
+	dead, err := q.DeadLetters(ctx, 10)
+	require.NoError(t, err)
+	require.Empty(t, dead)
+}
+
+func TestBury(t *testing.T) {
+	c := newTestClient(t)
+	q := newTestQueue(c, "c1", Options{MaxRetry: 1})
+	ctx := context.Background()
+
+	var calls atomic.Int64
+	q.Handle("fail", func(ctx context.Context, job *Job) error {
+		calls.Add(1)
+		return errors.New("boom")
+	})
+	_, err := q.Enqueue(ctx, "fail", nil)
+	require.NoError(t, err)
+	_, err = q.Enqueue(ctx, "unknown", nil)
+	require.NoError(t, err)
+	run(t, q)
+
+	var dead []goredis.XMessage
+	require.Eventually(t, func() bool {
+		dead, err = q.DeadLetters(ctx, 10)
+		return err == nil && len(dead) == 2
+	}, 2*time.Second, 10*time.Millisecond)
+	require.Equal(t, int64(2), calls.Load())
+
+	causes := map[string]string{}
+	for _, msg := range dead {
+		causes[msg.Values["type"].(string)] = msg.Values["error"].(string)
+	}
+	require.Equal(t, map[string]string{
+		"fail":    "boom",
+		"unknown": "no handler for job type unknown",
+	}, causes)
+	require.Eventually(t, func() bool {
+		n, err := q.Pending(ctx)
+		return err == nil && n == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestReclaim(t *testing.T) {
+	c := newTestClient(t)
+	opts := Options{ClaimIdle: 100 * time.Millisecond}
+	crashed := newTestQueue(c, "crashed", opts)
+	ctx := context.Background()
+
+	// crashed 读取后未确认即退出
+	require.NoError(t, crashed.createGroup(ctx))
+	_, err := crashed.Enqueue(ctx, "job", testPayload{N: 1})
+	require.NoError(t, err)
+	streams, err := c.XReadGroup(ctx, &goredis.XReadGroupArgs{
+		Group:    crashed.opts.Group,
+		Consumer: "crashed",
+		Streams:  []string{crashed.stream, ">"},
+		Count:    1,
+	}).Result()
+	require.NoError(t, err)
+	require.Len(t, streams[0].Messages, 1)
+
+	q := newTestQueue(c, "live", opts)
+	got := make(chan *Job, 1)
+	q.Handle("job", func(ctx context.Context, job *Job) error {
+		got <- job
+		return nil
+	})
+	run(t, q)
+
+	select {
+	case job := <-got:
+		require.Equal(t, streams[0].Messages[0].ID, job.MessageID)
+		require.Equal(t, 2, job.Attempt) // 重新认领计为一次执行
+	case <-time.After(2 * time.Second):
+		t.Fatal("job not reclaimed")
+	}
+}
+
+func TestReclaimRepeatedly(t *testing.T) {
+	c := newTestClient(t)
+	opts := Options{ClaimIdle: 50 * time.Millisecond, MaxRetry: 1}
+	crashed := newTestQueue(c, "crashed", opts)
+	ctx := context.Background()
+
+	// 任务每次执行都使消费者崩溃, 消息被反复认领
+	require.NoError(t, crashed.createGroup(ctx))
+	_, err := crashed.Enqueue(ctx, "crash", nil)
+	require.NoError(t, err)
+	_, err = c.XReadGroup(ctx, &goredis.XReadGroupArgs{
+		Group:    crashed.opts.Group,
+		Consumer: "crashed",
+		Streams:  []string{crashed.stream, ">"},
+		Count:    1,
+	}).Result()
+	require.NoError(t, err)
+	time.Sleep(60 * time.Millisecond)
+	msgs, _, err := crashed.autoclaim(ctx, "0-0")
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	require.Equal(t, int64(2), msgs[0].deliveries)
+
+	// 第三次投递超过 MaxRetry+1 次执行, 直接写入死信
+	var calls atomic.Int64
+	q := newTestQueue(c, "live", opts)
+	q.Handle("crash", func(ctx context.Context, job *Job) error {
+		calls.Add(1)
+		return nil
+	})
+	run(t, q)
+
+	var dead []goredis.XMessage
+	require.Eventually(t, func() bool {
+		dead, err = q.DeadLetters(ctx, 10)
+		return err == nil && len(dead) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	require.Equal(t, "job abandoned after 3 deliveries", dead[0].Values["error"])
+	require.Equal(t, int64(0), calls.Load())
+	n, err := q.Pending(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), n)
+}
+
+func TestReclaimSkipsRunningJobs(t *testing.T) {
+	c := newTestClient(t)
+	opts := Options{ClaimIdle: 100 * time.Millisecond}
+	ctx := context.Background()
+
+	// 执行时间远超 ClaimIdle 的任务不会被本消费者或其他消费者重复执行
+	var calls atomic.Int64
+	handler := func(ctx context.Context, job *Job) error {
+		calls.Add(1)
+		time.Sleep(500 * time.Millisecond)
+		return nil
+	}
+	for _, consumer := range []string{"c1", "c2"} {
+		q := newTestQueue(c, consumer, opts)
+		q.Handle("slow", handler)
+		run(t, q)
+	}
+	q := newTestQueue(c, "producer", opts)
+	_, err := q.Enqueue(ctx, "slow", nil)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		n, err := q.Pending(ctx)
+		return err == nil && n == 0
+	}, 2*time.Second, 10*time.Millisecond)
+	require.Equal(t, int64(1), calls.Load())
+}
@@ -0,0 +1,284 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/scrawld/library/util"
+)
+
+var (
+	// bitopCountScript 对 KEYS[2:] 执行 BITOP ARGV[1] 写入临时 key KEYS[1], 返回置位数量并删除临时 key
+	bitopCountScript = newScript(`
+redis.call("BITOP", ARGV[1], KEYS[1], unpack(KEYS, 2))
+local n = redis.call("BITCOUNT", KEYS[1])
+redis.call("DEL", KEYS[1])
+return n`, memBitopCount)
+
+	// streakScript 按顺序检查 KEYS 中 ARGV[1] 位, 返回遇到第一个 0 之前的数量
+	streakScript = newScript(`
+local n = 0
+for _, key in ipairs(KEYS) do
+	if redis.call("GETBIT", key, ARGV[1]) == 0 then
+		break
+	end
+	n = n + 1
+end
+return n`, memStreak)
+
+	// markScript SETBIT KEYS[1] ARGV[1] 1 并设置过期时间 ARGV[2](unix 秒), 0 表示不过期
+	markScript = newScript(`
+local old = redis.call("SETBIT", KEYS[1], ARGV[1], 1)
+if tonumber(ARGV[2]) > 0 then
+	redis.call("EXPIREAT", KEYS[1], ARGV[2])
+end
+return old`, memMark)
+)
+
+func memBitopCount(m *MemoryClient, keys, args []string) (interface{}, error) {
+	var (
+		op  = strings.ToUpper(args[0])
+		res []byte
+	)
+	for i, key := range keys[1:] {
+		it, err := m.lookupKind(key, memoryString)
+		if err != nil {
+			return nil, err
+		}
+		var b []byte
+		if it != nil {
+			b = it.str
+		}
+		if i == 0 {
+			res = append([]byte{}, b...)
+			continue
+		}
+		for len(res) < len(b) {
+			res = append(res, 0)
+		}
+		for j := range res {
+			var c byte
+			if j < len(b) {
+				c = b[j]
+			}
+			switch op {
+			case "AND":
+				res[j] &= c
+			case "OR":
+				res[j] |= c
+			case "XOR":
+				res[j] ^= c
+			default:
+				return nil, errUnsupported
+			}
+		}
+	}
+	return memoryPopCount(res), nil
+}
+
+func memStreak(m *MemoryClient, keys, args []string) (interface{}, error) {
+	offset := memInt(args[0])
+	var n int64
+	for _, key := range keys {
+		it, err := m.lookupKind(key, memoryString)
+		if err != nil {
+			return nil, err
+		}
+		if memoryGetBit(it, offset) == 0 {
+			break
+		}
+		n++
+	}
+	return n, nil
+}
+
+func memMark(m *MemoryClient, keys, args []string) (interface{}, error) {
+	old, err := m.setBit(keys[0], memInt(args[0]), 1)
+	if err != nil {
+		return nil, err
+	}
+	if expireAt := memInt(args[1]); expireAt > 0 {
+		m.pexpire(keys[0], time.Unix(expireAt, 0).Sub(m.now))
+	}
+	return old, nil
+}
+
+// ActivityBitmap 基于 bitmap 的按天活跃记录, 以用户 ID 作为偏移量, 用于留存、连续活跃统计
+type ActivityBitmap struct {
+	ctx     context.Context
+	timeout time.Duration
+	client  Cmdable
+	prefix  string
+	name    string
+	expire  time.Duration
+}
+
+/**
+ * NewActivityBitmap 创建按天活跃记录, key 格式：<KeyPrefix>.active.{name}.<dt>, 默认保留 90 天
+ * 用户 ID 需为较小的非负整数, bitmap 大小为最大 ID / 8 字节
+ *
+ * Example:
+ *
+ * act := redis.NewActivityBitmap("login")
+ * act.Mark(time.Now(), 42)
+ *
+ * // 7 日留存: 7 天前活跃且今天也活跃
+ * cohort, retained, _ := act.Retention(time.Now().AddDate(0, 0, -7), 7)
+ * // 最近 7 天每天都活跃的人数
+ * n, _ := act.CountActiveAll(time.Now().AddDate(0, 0, -6), time.Now())
+ */
+func NewActivityBitmap(name string) *ActivityBitmap {
+	return &ActivityBitmap{
+		ctx:    context.Background(),
+		prefix: fmt.Sprintf("%s.active.", KeyPrefix),
+		name:   name,
+		expire: 90 * 24 * time.Hour,
+	}
+}
+
+// SetPrefix 设置前缀
+func (a *ActivityBitmap) SetPrefix(prefix string) *ActivityBitmap {
+	a.prefix = prefix
+	return a
+}
+
+// EmptyPrefix 清空前缀
+func (a *ActivityBitmap) EmptyPrefix() *ActivityBitmap {
+	a.prefix = ""
+	return a
+}
+
+// SetExpire 设置每天数据的保留时间, d <= 0 表示不过期
+func (a *ActivityBitmap) SetExpire(d time.Duration) *ActivityBitmap {
+	a.expire = d
+	return a
+}
+
+// WithContext 返回使用 ctx 的副本
+func (a *ActivityBitmap) WithContext(ctx context.Context) *ActivityBitmap {
+	if ctx == nil {
+		panic("redis: nil context")
+	}
+	r := *a
+	r.ctx = ctx
+	return &r
+}
+
+// WithTimeout 返回设置单条命令超时时间的副本, timeout <= 0 表示不限制
+func (a *ActivityBitmap) WithTimeout(timeout time.Duration) *ActivityBitmap {
+	r := *a
+	r.timeout = timeout
+	return &r
+}
+
+// WithClient 返回使用指定客户端的副本, c 为 nil 时使用 DefaultClient()
+func (a *ActivityBitmap) WithClient(c Cmdable) *ActivityBitmap {
+	r := *a
+	r.client = c
+	return &r
+}
+
+// Client 返回使用的客户端
+func (a *ActivityBitmap) Client() Cmdable {
+	return pick(a.client)
+}
+
+// DayKey 返回 tm 当天的完整 key
+func (a *ActivityBitmap) DayKey(tm time.Time) string {
+	return a.prefix + "{" + a.name + "}." + strconv.Itoa(util.GetDtByOffset(tm, 0))
+}
+
+// Mark 记录用户 tm 当天活跃
+func (a *ActivityBitmap) Mark(tm time.Time, userId int64) error {
+	if userId < 0 {
+		return fmt.Errorf("invalid user id: %d", userId)
+	}
+	ctx, cancel := withTimeout(a.ctx, a.timeout)
+	defer cancel()
+	var expireAt int64
+	if a.expire > 0 {
+		expireAt = util.StartOfDay(tm).AddDate(0, 0, 1).Add(a.expire).Unix()
+	}
+	return markScript.Run(ctx, a.Client(), []string{a.DayKey(tm)}, userId, expireAt).Err()
+}
+
+// IsActive 判断用户 tm 当天是否活跃
+func (a *ActivityBitmap) IsActive(tm time.Time, userId int64) (bool, error) {
+	ctx, cancel := withTimeout(a.ctx, a.timeout)
+	defer cancel()
+	n, err := a.Client().GetBit(ctx, a.DayKey(tm), userId).Result()
+	return n == 1, err
+}
+
+// Count 返回 tm 当天的活跃人数
+func (a *ActivityBitmap) Count(tm time.Time) (int64, error) {
+	ctx, cancel := withTimeout(a.ctx, a.timeout)
+	defer cancel()
+	return a.Client().BitCount(ctx, a.DayKey(tm), nil).Result()
+}
+
+// CountActiveAll 返回 [st, et] 内每天都活跃的人数
+func (a *ActivityBitmap) CountActiveAll(st, et time.Time) (int64, error) {
+	return a.bitopCount("AND", a.rangeKeys(st, et)...)
+}
+
+// CountActiveAny 返回 [st, et] 内至少活跃一天的人数
+func (a *ActivityBitmap) CountActiveAny(st, et time.Time) (int64, error) {
+	return a.bitopCount("OR", a.rangeKeys(st, et)...)
+}
+
+// Retention 返回 cohortDay 当天活跃的人数, 及其中在 n 天后仍活跃的人数
+func (a *ActivityBitmap) Retention(cohortDay time.Time, n int) (cohort, retained int64, err error) {
+	if cohort, err = a.Count(cohortDay); err != nil {
+		return
+	}
+	retained, err = a.bitopCount("AND", a.DayKey(cohortDay), a.DayKey(cohortDay.AddDate(0, 0, n)))
+	return
+}
+
+// Streak 返回用户截至 tm 的连续活跃天数, 最多向前检查 maxDays 天
+func (a *ActivityBitmap) Streak(userId int64, tm time.Time, maxDays int) (int64, error) {
+	if maxDays <= 0 {
+		return 0, nil
+	}
+	keys := make([]string, 0, maxDays)
+	for i := 0; i < maxDays; i++ {
+		keys = append(keys, a.DayKey(tm.AddDate(0, 0, -i)))
+	}
+	ctx, cancel := withTimeout(a.ctx, a.timeout)
+	defer cancel()
+	return streakScript.Run(ctx, a.Client(), keys, userId).Int64()
+}
+
+// CountStreak 返回截至 tm 连续活跃至少 days 天的人数
+func (a *ActivityBitmap) CountStreak(tm time.Time, days int) (int64, error) {
+	if days <= 0 {
+		return 0, nil
+	}
+	return a.CountActiveAll(tm.AddDate(0, 0, -(days-1)), tm)
+}
+
+func (a *ActivityBitmap) bitopCount(op string, keys ...string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	uid, _ := uuid.NewRandom()
+	tmp := a.prefix + "{" + a.name + "}.tmp." + uid.String()
+
+	ctx, cancel := withTimeout(a.ctx, a.timeout)
+	defer cancel()
+	return bitopCountScript.Run(ctx, a.Client(), append([]string{tmp}, keys...), op).Int64()
+}
+
+func (a *ActivityBitmap) rangeKeys(st, et time.Time) []string {
+	days := util.GetDateRange(st, et)
+	keys := make([]string, 0, len(days))
+	for _, d := range days {
+		keys = append(keys, a.DayKey(d))
+	}
+	return keys
+}
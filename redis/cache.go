@@ -4,11 +4,15 @@ import (
 	"context"
 	"fmt"
 	"time"
+
+	"github.com/go-redis/redis/v8"
 )
 
 type Cache struct {
-	ctx    context.Context
-	prefix string
+	ctx     context.Context
+	timeout time.Duration
+	client  Cmdable
+	prefix  string
 }
 
 func New() (r *Cache) {
@@ -29,50 +33,129 @@ func (c *Cache) EmptyPrefix() *Cache {
 	return c
 }
 
+// WithContext 返回使用 ctx 的副本, 请求的取消、超时与链路信息会传递到每条命令
+func (c *Cache) WithContext(ctx context.Context) *Cache {
+	if ctx == nil {
+		panic("redis: nil context")
+	}
+	r := *c
+	r.ctx = ctx
+	return &r
+}
+
+// WithTimeout 返回设置单条命令超时时间的副本, timeout <= 0 表示不限制
+func (c *Cache) WithTimeout(timeout time.Duration) *Cache {
+	r := *c
+	r.timeout = timeout
+	return &r
+}
+
+// WithClient 返回使用指定客户端的副本, client 为 nil 时使用 DefaultClient()
+func (c *Cache) WithClient(client Cmdable) *Cache {
+	r := *c
+	r.client = client
+	return &r
+}
+
+// Client 返回使用的客户端
+func (c *Cache) Client() Cmdable {
+	return pick(c.client)
+}
+
+// Context 返回当前使用的 context
+func (c *Cache) Context() context.Context {
+	return c.ctx
+}
+
+// cmdContext 为单条命令生成 context
+func (c *Cache) cmdContext() (context.Context, context.CancelFunc) {
+	return withTimeout(c.ctx, c.timeout)
+}
+
 func (c *Cache) Set(key string, val interface{}) error {
-	return GetClient().Set(c.ctx, fmt.Sprintf("%s%s", c.prefix, key), val, 0).Err()
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	return c.Client().Set(ctx, fmt.Sprintf("%s%s", c.prefix, key), val, 0).Err()
 }
 
 func (c *Cache) SetEX(key string, val interface{}, expire time.Duration) error {
-	return GetClient().Set(c.ctx, fmt.Sprintf("%s%s", c.prefix, key), val, expire).Err()
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	return c.Client().Set(ctx, fmt.Sprintf("%s%s", c.prefix, key), val, expire).Err()
+}
+
+// SetNX key 不存在时写入, 返回是否写入, expire 为 0 表示不过期
+func (c *Cache) SetNX(key string, val interface{}, expire time.Duration) (bool, error) {
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	return c.Client().SetNX(ctx, fmt.Sprintf("%s%s", c.prefix, key), val, expire).Result()
 }
 
 func (c *Cache) Get(key string) (string, error) {
-	return GetClient().Get(c.ctx, fmt.Sprintf("%s%s", c.prefix, key)).Result()
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	return c.Client().Get(ctx, fmt.Sprintf("%s%s", c.prefix, key)).Result()
 }
 
 func (c *Cache) GetInt64(key string) (int64, error) {
-	return GetClient().Get(c.ctx, fmt.Sprintf("%s%s", c.prefix, key)).Int64()
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	return c.Client().Get(ctx, fmt.Sprintf("%s%s", c.prefix, key)).Int64()
 }
 
 func (c *Cache) Del(keys ...string) error {
+	ctx, cancel := c.cmdContext()
+	defer cancel()
 	sk := []string{}
 	for _, k := range keys {
 		sk = append(sk, fmt.Sprintf("%s%s", c.prefix, k))
 	}
-	return GetClient().Del(c.ctx, sk...).Err()
+	client := c.Client()
+	if cc, ok := client.(*redis.ClusterClient); ok && len(sk) > 1 {
+		// 集群模式下多个 key 可能位于不同 slot, 逐个删除
+		_, err := cc.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, k := range sk {
+				pipe.Del(ctx, k)
+			}
+			return nil
+		})
+		return err
+	}
+	return client.Del(ctx, sk...).Err()
 }
 
 func (c *Cache) Exists(key string) (int64, error) {
-	return GetClient().Exists(c.ctx, fmt.Sprintf("%s%s", c.prefix, key)).Result()
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	return c.Client().Exists(ctx, fmt.Sprintf("%s%s", c.prefix, key)).Result()
 }
 
 func (c *Cache) Expire(key string, expiration time.Duration) (bool, error) {
-	return GetClient().Expire(c.ctx, fmt.Sprintf("%s%s", c.prefix, key), expiration).Result()
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	return c.Client().Expire(ctx, fmt.Sprintf("%s%s", c.prefix, key), expiration).Result()
 }
 
 func (c *Cache) ExpireAt(key string, tm time.Time) (bool, error) {
-	return GetClient().ExpireAt(c.ctx, fmt.Sprintf("%s%s", c.prefix, key), tm).Result()
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	return c.Client().ExpireAt(ctx, fmt.Sprintf("%s%s", c.prefix, key), tm).Result()
 }
 
 func (c *Cache) HGet(key string, field string) (string, error) {
-	return GetClient().HGet(c.ctx, fmt.Sprintf("%s%s", c.prefix, key), field).Result()
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	return c.Client().HGet(ctx, fmt.Sprintf("%s%s", c.prefix, key), field).Result()
 }
 
 func (c *Cache) HSet(key string, field string, val string) error {
-	return GetClient().HSet(c.ctx, fmt.Sprintf("%s%s", c.prefix, key), field, val).Err()
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	return c.Client().HSet(ctx, fmt.Sprintf("%s%s", c.prefix, key), field, val).Err()
 }
 
 func (c *Cache) HDel(key string, field string) error {
-	return GetClient().HDel(c.ctx, fmt.Sprintf("%s%s", c.prefix, key), field).Err()
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	return c.Client().HDel(ctx, fmt.Sprintf("%s%s", c.prefix, key), field).Err()
 }
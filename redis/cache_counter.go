@@ -0,0 +1,103 @@
+package redis
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var (
+	// incrEXScript 自增 KEYS[1], 首次创建时设置 ARGV[1] 毫秒的过期时间, 返回自增后的值
+	incrEXScript = newScript(`
+local n = redis.call("INCR", KEYS[1])
+if n == 1 and tonumber(ARGV[1]) > 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return n`, memIncrEX)
+
+	// setMaxScript ARGV[1] 大于当前值(或 key 不存在)时写入并设置 ARGV[2] 毫秒的过期时间, 返回是否写入
+	setMaxScript = newScript(`
+local cur = redis.call("GET", KEYS[1])
+if cur and tonumber(cur) >= tonumber(ARGV[1]) then
+	return 0
+end
+if tonumber(ARGV[2]) > 0 then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+else
+	redis.call("SET", KEYS[1], ARGV[1])
+end
+return 1`, memSetMax)
+
+	// decrIfPositiveScript KEYS[1] 存在且大于 0 时自减, 保留过期时间, 返回自减后的值, 不存在返回 0
+	decrIfPositiveScript = newScript(`
+local n = tonumber(redis.call("GET", KEYS[1]) or "0")
+if n <= 0 then
+	return 0
+end
+return redis.call("DECR", KEYS[1])`, memDecrIfPositive)
+)
+
+func memIncrEX(m *MemoryClient, keys, args []string) (interface{}, error) {
+	n, err := m.incrBy(keys[0], 1)
+	if err != nil {
+		return nil, err
+	}
+	if px := memMs(args[0]); n == 1 && px > 0 {
+		m.pexpire(keys[0], px)
+	}
+	return n, nil
+}
+
+func memSetMax(m *MemoryClient, keys, args []string) (interface{}, error) {
+	v, ok, err := m.getString(keys[0])
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		cur, _ := strconv.ParseFloat(v, 64)
+		if cur >= memFloat(args[0]) {
+			return int64(0), nil
+		}
+	}
+	m.setString(keys[0], args[0], memMs(args[1]))
+	return int64(1), nil
+}
+
+func memDecrIfPositive(m *MemoryClient, keys, args []string) (interface{}, error) {
+	v, ok, err := m.getString(keys[0])
+	if err != nil || !ok {
+		return int64(0), err
+	}
+	if n, _ := strconv.ParseInt(v, 10, 64); n <= 0 {
+		return int64(0), nil
+	}
+	return m.incrBy(keys[0], -1)
+}
+
+// IncrEX 自增 key 并返回新值, key 首次创建时设置过期时间, expire 为 0 表示不过期; 适用于固定窗口计数
+func (c *Cache) IncrEX(key string, expire time.Duration) (int64, error) {
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	return incrEXScript.Run(ctx, c.Client(), []string{fmt.Sprintf("%s%s", c.prefix, key)}, expire.Milliseconds()).Int64()
+}
+
+// DecrIfPositive key 存在且大于 0 时自减并返回新值, 保留过期时间, 否则返回 0; 用于撤销 IncrEX 的计数
+func (c *Cache) DecrIfPositive(key string) (int64, error) {
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	return decrIfPositiveScript.Run(ctx, c.Client(), []string{fmt.Sprintf("%s%s", c.prefix, key)}).Int64()
+}
+
+// SetMax 仅当 val 大于当前值或 key 不存在时写入并重置过期时间, 返回是否写入; 适用于单调递增的序号、防重放
+func (c *Cache) SetMax(key string, val int64, expire time.Duration) (bool, error) {
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	return setMaxScript.Run(ctx, c.Client(), []string{fmt.Sprintf("%s%s", c.prefix, key)}, val, expire.Milliseconds()).Bool()
+}
+
+// PTTL 返回 key 的剩余过期时间, key 不存在时返回 -2ns, 没有过期时间时返回 -1ns
+func (c *Cache) PTTL(key string) (time.Duration, error) {
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	return c.Client().PTTL(ctx, fmt.Sprintf("%s%s", c.prefix, key)).Result()
+}
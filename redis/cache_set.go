@@ -0,0 +1,72 @@
+package redis
+
+import (
+	"fmt"
+	"time"
+)
+
+// sReplaceScript 用 ARGV[2:] 替换集合 KEYS[1] 的全部成员, ARGV[1] 为过期毫秒数, 0 表示不过期
+var sReplaceScript = newScript(`
+redis.call("DEL", KEYS[1])
+for i = 2, #ARGV, 1000 do
+	redis.call("SADD", KEYS[1], unpack(ARGV, i, math.min(i + 999, #ARGV)))
+end
+if #ARGV > 1 and tonumber(ARGV[1]) > 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return #ARGV - 1`, memSReplace)
+
+func memSReplace(m *MemoryClient, keys, args []string) (interface{}, error) {
+	m.del(keys[0])
+	if len(args) == 1 {
+		return int64(0), nil
+	}
+	it, err := m.create(keys[0], memorySet)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range args[1:] {
+		it.set[v] = struct{}{}
+	}
+	if px := memMs(args[0]); px > 0 {
+		m.pexpire(keys[0], px)
+	}
+	return int64(len(args) - 1), nil
+}
+
+func (c *Cache) SAdd(key string, members ...interface{}) (int64, error) {
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	return c.Client().SAdd(ctx, fmt.Sprintf("%s%s", c.prefix, key), members...).Result()
+}
+
+// SRem 移除集合成员, 返回实际移除的数量, 可用于原子地消费一次性成员
+func (c *Cache) SRem(key string, members ...interface{}) (int64, error) {
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	return c.Client().SRem(ctx, fmt.Sprintf("%s%s", c.prefix, key), members...).Result()
+}
+
+func (c *Cache) SMembers(key string) ([]string, error) {
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	return c.Client().SMembers(ctx, fmt.Sprintf("%s%s", c.prefix, key)).Result()
+}
+
+func (c *Cache) SCard(key string) (int64, error) {
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	return c.Client().SCard(ctx, fmt.Sprintf("%s%s", c.prefix, key)).Result()
+}
+
+// SReplace 原子地用 members 替换集合的全部成员, members 为空时删除集合, expire 为 0 表示不过期
+func (c *Cache) SReplace(key string, members []string, expire time.Duration) error {
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	args := make([]interface{}, 0, len(members)+1)
+	args = append(args, expire.Milliseconds())
+	for _, m := range members {
+		args = append(args, m)
+	}
+	return sReplaceScript.Run(ctx, c.Client(), []string{fmt.Sprintf("%s%s", c.prefix, key)}, args...).Err()
+}
@@ -0,0 +1,258 @@
+package redis
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// tagAddScript 将 ARGV[1] 加入标签集合, 集合的过期时间不短于 ARGV[2] 毫秒, ARGV[2] 为 0 表示 key 不过期, 集合也不再过期
+	tagAddScript = newScript(`
+local px = tonumber(ARGV[2])
+local existed = redis.call("EXISTS", KEYS[1]) == 1
+redis.call("SADD", KEYS[1], ARGV[1])
+if px == 0 then
+	redis.call("PERSIST", KEYS[1])
+	return 1
+end
+local ttl = redis.call("PTTL", KEYS[1])
+if not existed or (ttl >= 0 and ttl < px) then
+	redis.call("PEXPIRE", KEYS[1], px)
+end
+return 1`, memTagAdd)
+
+	// setWithTagsScript 将 KEYS[1] 加入 KEYS[2:] 的标签集合后 SET KEYS[1] ARGV[1], ARGV[2] 为过期毫秒数, 0 表示不过期
+	setWithTagsScript = newScript(`
+local px = tonumber(ARGV[2])
+for i = 2, #KEYS do
+	local existed = redis.call("EXISTS", KEYS[i]) == 1
+	redis.call("SADD", KEYS[i], KEYS[1])
+	if px == 0 then
+		redis.call("PERSIST", KEYS[i])
+	else
+		local ttl = redis.call("PTTL", KEYS[i])
+		if not existed or (ttl >= 0 and ttl < px) then
+			redis.call("PEXPIRE", KEYS[i], px)
+		end
+	end
+end
+if px == 0 then
+	return redis.call("SET", KEYS[1], ARGV[1])
+end
+return redis.call("SET", KEYS[1], ARGV[1], "PX", px)`, memSetWithTags)
+
+	// invalidateTagsScript KEYS 为 ARGV[1] 个标签集合及其成员, 删除成员并从集合中移除, 返回删除的 key 数量
+	// 集合在读取成员后新增的成员会保留, 集合为空时由 Redis 自动删除
+	invalidateTagsScript = newScript(`
+local nt = tonumber(ARGV[1])
+local n = 0
+for i = nt + 1, #KEYS, 1000 do
+	local j = math.min(i + 999, #KEYS)
+	n = n + redis.call("DEL", unpack(KEYS, i, j))
+	for t = 1, nt do
+		redis.call("SREM", KEYS[t], unpack(KEYS, i, j))
+	end
+end
+return n`, memInvalidateTags)
+)
+
+func memTagAdd(m *MemoryClient, keys, args []string) (interface{}, error) {
+	if err := memAddTag(m, keys[0], args[0], memInt(args[1])); err != nil {
+		return nil, err
+	}
+	return int64(1), nil
+}
+
+func memSetWithTags(m *MemoryClient, keys, args []string) (interface{}, error) {
+	px := memInt(args[1])
+	for _, tag := range keys[1:] {
+		if err := memAddTag(m, tag, keys[0], px); err != nil {
+			return nil, err
+		}
+	}
+	m.setString(keys[0], args[0], time.Duration(px)*time.Millisecond)
+	return "OK", nil
+}
+
+func memAddTag(m *MemoryClient, tag, member string, px int64) error {
+	existed := m.lookup(tag) != nil
+	it, err := m.create(tag, memorySet)
+	if err != nil {
+		return err
+	}
+	it.set[member] = struct{}{}
+	if px == 0 {
+		it.expireAt = time.Time{}
+		return nil
+	}
+	if ttl := m.pttl(tag); !existed || (ttl >= 0 && ttl < px) {
+		m.pexpire(tag, time.Duration(px)*time.Millisecond)
+	}
+	return nil
+}
+
+func memInvalidateTags(m *MemoryClient, keys, args []string) (interface{}, error) {
+	nt := int(memInt(args[0]))
+	members := keys[nt:]
+	for _, tag := range keys[:nt] {
+		it, err := m.lookupKind(tag, memorySet)
+		if err != nil {
+			return nil, err
+		}
+		if it == nil {
+			continue
+		}
+		for _, k := range members {
+			delete(it.set, k)
+		}
+		if len(it.set) == 0 {
+			m.del(tag)
+		}
+	}
+	return m.del(members...), nil
+}
+
+// tagKey 返回标签集合的完整 key：<KeyPrefix>.tag.<prefix><tag>
+// 标签集合不在缓存的前缀之下, 不会被 ScanKeys、DelPrefix、Inventory 等按前缀扫描的方法匹配到
+func (c *Cache) tagKey(tag string) string {
+	return fmt.Sprintf("%s.tag.%s%s", KeyPrefix, c.prefix, tag)
+}
+
+/**
+ * SetWithTags 设置 key 并记录标签, expire 为 0 表示不过期, 之后可通过 InvalidateTags 删除带有任一标签的全部 key
+ * 标签以 set 保存, 集合的过期时间不短于其中 key 的过期时间; key 过期或被删除后留下的成员可通过 CleanupTags 清理
+ * 单节点和哨兵模式下标签与 key 在同一脚本中写入; 集群模式下先记录标签再写入, 不保证原子性
+ *
+ * Example:
+ *
+ * c := redis.New()
+ * c.SetWithTags("product:42", data, time.Hour, "product:42", "product-list")
+ * c.SetWithTags("product-list:page:1", page, time.Hour, "product-list")
+ *
+ * // 商品更新后
+ * n, err := c.InvalidateTags("product:42", "product-list")
+ */
+func (c *Cache) SetWithTags(key string, val interface{}, expire time.Duration, tags ...string) error {
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	fullKey := fmt.Sprintf("%s%s", c.prefix, key)
+	client := c.Client()
+	if _, ok := client.(*redis.ClusterClient); !ok {
+		keys := make([]string, 0, len(tags)+1)
+		keys = append(keys, fullKey)
+		for _, tag := range tags {
+			keys = append(keys, c.tagKey(tag))
+		}
+		return setWithTagsScript.Run(ctx, client, keys, val, expire.Milliseconds()).Err()
+	}
+
+	// 集群模式下先记录标签再写入, 中途失败只会留下无效的成员
+	for _, tag := range tags {
+		if err := tagAddScript.Run(ctx, client, []string{c.tagKey(tag)}, fullKey, expire.Milliseconds()).Err(); err != nil {
+			return fmt.Errorf("add tag %s error: %s", tag, err)
+		}
+	}
+	return client.Set(ctx, fullKey, val, expire).Err()
+}
+
+// InvalidateTags 删除带有任一标签的全部 key 并从标签中移除, 返回删除的 key 数量
+// 单节点和哨兵模式下读取标签成员后通过 Lua 脚本原子删除, 脚本涉及的 key 均通过 KEYS 传入;
+// 集群模式下 key 分布在不同 slot, 逐个删除, 不保证原子性
+func (c *Cache) InvalidateTags(tags ...string) (int64, error) {
+	if len(tags) == 0 {
+		return 0, nil
+	}
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	client := c.Client()
+	tagKeys := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tagKeys = append(tagKeys, c.tagKey(tag))
+	}
+	if _, ok := client.(*redis.ClusterClient); !ok {
+		members, err := client.SUnion(ctx, tagKeys...).Result()
+		if err != nil {
+			return 0, err
+		}
+		if len(members) == 0 {
+			return 0, nil
+		}
+		return invalidateTagsScript.Run(ctx, client, append(tagKeys, members...), len(tagKeys)).Int64()
+	}
+
+	var total int64
+	for _, tagKey := range tagKeys {
+		members, err := client.SMembers(ctx, tagKey).Result()
+		if err != nil {
+			return total, err
+		}
+		for _, k := range members {
+			n, err := client.Unlink(ctx, k).Result()
+			if err != nil {
+				return total, err
+			}
+			total += n
+			if err = client.SRem(ctx, tagKey, k).Err(); err != nil {
+				return total, err
+			}
+		}
+	}
+	return total, nil
+}
+
+// TagKeys 返回带有标签的 key(不含前缀), 可能包含已过期的 key
+func (c *Cache) TagKeys(tag string) ([]string, error) {
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	members, err := c.Client().SMembers(ctx, c.tagKey(tag)).Result()
+	if err != nil {
+		return nil, err
+	}
+	return c.trimPrefix(members), nil
+}
+
+// CleanupTags 使用 SSCAN 遍历标签集合, 移除已不存在的 key, 返回移除的数量
+func (c *Cache) CleanupTags(tags ...string) (int64, error) {
+	var removed int64
+	for _, tag := range tags {
+		var (
+			tagKey = c.tagKey(tag)
+			cursor uint64
+		)
+		for {
+			ctx, cancel := c.cmdContext()
+			members, next, err := c.Client().SScan(ctx, tagKey, cursor, "", defaultScanCount).Result()
+			cancel()
+			if err != nil {
+				return removed, err
+			}
+			var stale []interface{}
+			for _, k := range members {
+				ctx, cancel = c.cmdContext()
+				n, err := c.Client().Exists(ctx, k).Result()
+				cancel()
+				if err != nil {
+					return removed, err
+				}
+				if n == 0 {
+					stale = append(stale, k)
+				}
+			}
+			if len(stale) > 0 {
+				ctx, cancel = c.cmdContext()
+				n, err := c.Client().SRem(ctx, tagKey, stale...).Result()
+				cancel()
+				if err != nil {
+					return removed, err
+				}
+				removed += n
+			}
+			if cursor = next; cursor == 0 {
+				break
+			}
+		}
+	}
+	return removed, nil
+}
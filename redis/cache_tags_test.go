@@ -0,0 +1,68 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheTags(t *testing.T) {
+	forEachScriptClient(t, func(t *testing.T, sc scriptClient) {
+		c := New()
+
+		require.NoError(t, c.SetWithTags("product:1", "a", time.Minute, "product:1", "product-list"))
+		require.NoError(t, c.SetWithTags("product:2", "b", time.Hour, "product:2", "product-list"))
+		require.NoError(t, c.SetWithTags("list:1", "c", time.Minute, "product-list"))
+		require.NoError(t, c.Set("other", "d"))
+
+		v, err := c.Get("product:2")
+		require.NoError(t, err)
+		require.Equal(t, "b", v)
+
+		// 标签集合不在缓存前缀之下, 不会被扫描到
+		var scanned []string
+		require.NoError(t, c.ScanKeys("*", nil, func(keys []string) error {
+			scanned = append(scanned, keys...)
+			return nil
+		}))
+		require.ElementsMatch(t, []string{"product:1", "product:2", "list:1", "other"}, scanned)
+		keys, err := c.TagKeys("product-list")
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"product:1", "product:2", "list:1"}, keys)
+
+		// 标签集合的过期时间不短于其中 key 的过期时间
+		ttl, err := sc.client.PTTL(context.Background(), c.tagKey("product-list")).Result()
+		require.NoError(t, err)
+		require.InDelta(t, time.Hour, ttl, float64(time.Second))
+
+		sc.advance(time.Minute)
+		n, err := c.CleanupTags("product-list", "product:1")
+		require.NoError(t, err)
+		require.Equal(t, int64(2), n)
+
+		n, err = c.InvalidateTags("product-list", "missing")
+		require.NoError(t, err)
+		require.Equal(t, int64(1), n)
+
+		n, err = c.Exists("product:2")
+		require.NoError(t, err)
+		require.Equal(t, int64(0), n)
+		n, err = c.Exists("other")
+		require.NoError(t, err)
+		require.Equal(t, int64(1), n)
+		keys, err = c.TagKeys("product-list")
+		require.NoError(t, err)
+		require.Empty(t, keys)
+
+		// 不过期的 key 使标签集合也不过期
+		require.NoError(t, c.SetWithTags("forever", "e", 0, "product-list"))
+		ttl, err = sc.client.PTTL(context.Background(), c.tagKey("product-list")).Result()
+		require.NoError(t, err)
+		require.Equal(t, time.Duration(-1), ttl)
+		n, err = c.InvalidateTags("product-list")
+		require.NoError(t, err)
+		require.Equal(t, int64(1), n)
+	})
+}
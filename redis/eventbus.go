@@ -0,0 +1,270 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/scrawld/zaplog"
+)
+
+// Topic 类型化的 Pub/Sub 主题, 事件以 JSON 编码发布
+type Topic[T any] struct {
+	client Cmdable
+	prefix string
+	name   string
+}
+
+// NewTopic 创建主题, 使用默认的前缀格式：<KeyPrefix>.event.<name>
+func NewTopic[T any](name string) *Topic[T] {
+	return &Topic[T]{
+		prefix: fmt.Sprintf("%s.event.", KeyPrefix),
+		name:   name,
+	}
+}
+
+// SetPrefix 设置前缀
+func (t *Topic[T]) SetPrefix(prefix string) *Topic[T] {
+	t.prefix = prefix
+	return t
+}
+
+// EmptyPrefix 清空前缀
+func (t *Topic[T]) EmptyPrefix() *Topic[T] {
+	t.prefix = ""
+	return t
+}
+
+// WithClient 设置发布和订阅使用的客户端, c 为 nil 时使用 DefaultClient()
+func (t *Topic[T]) WithClient(c Cmdable) *Topic[T] {
+	t.client = c
+	return t
+}
+
+// Channel 返回完整的频道名称
+func (t *Topic[T]) Channel() string {
+	return t.prefix + t.name
+}
+
+// Publish 发布事件, 返回收到事件的订阅者数量
+func (t *Topic[T]) Publish(ctx context.Context, event T) (int64, error) {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return 0, fmt.Errorf("marshal event error: %s", err)
+	}
+	return pick(t.client).Publish(ctx, t.Channel(), b).Result()
+}
+
+// EventBus 管理一组订阅, Close 时统一退订并等待处理函数返回
+type EventBus struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	log    *zaplog.TracingLogger
+}
+
+// NewEventBus 创建事件总线
+func NewEventBus() *EventBus {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &EventBus{
+		ctx:    ctx,
+		cancel: cancel,
+		subs:   map[*Subscription]struct{}{},
+		log:    zaplog.New().Named("EventBus"),
+	}
+}
+
+// Close 退订全部订阅并等待处理函数返回
+func (b *EventBus) Close() error {
+	b.cancel()
+	b.mu.Lock()
+	subs := make([]*Subscription, 0, len(b.subs))
+	for s := range b.subs {
+		subs = append(subs, s)
+	}
+	b.mu.Unlock()
+
+	for _, s := range subs {
+		s.Unsubscribe()
+	}
+	return nil
+}
+
+// SubscribeOption 订阅选项
+type SubscribeOption func(*Subscription)
+
+// OnReconnect 设置断线重连成功后的回调, 断线期间发布的事件会丢失, 可在回调中做补偿(例如清空本地缓存)
+func OnReconnect(fn func()) SubscribeOption {
+	return func(s *Subscription) {
+		s.onReconnect = fn
+	}
+}
+
+// Subscription 订阅, 每个订阅使用独立的连接和协程, 断线后自动重连
+type Subscription struct {
+	bus         *EventBus
+	client      Cmdable
+	channel     string
+	ctx         context.Context
+	cancel      context.CancelFunc
+	done        chan struct{}
+	onReconnect func()
+
+	mu     sync.Mutex
+	pubsub PubSubConn
+}
+
+/**
+ * Subscribe 订阅主题, handler 在订阅独立的协程中按顺序执行, panic 会被恢复并记录日志
+ *
+ * Example:
+ *
+ * type ConfigChanged struct {
+ * 	Key string `json:"key"`
+ * }
+ *
+ * var configTopic = redis.NewTopic[ConfigChanged]("config-changed")
+ *
+ * bus := redis.NewEventBus()
+ * defer bus.Close()
+ *
+ * redis.Subscribe(bus, configTopic, func(ctx context.Context, e ConfigChanged) error {
+ * 	return reload(e.Key)
+ * })
+ * configTopic.Publish(ctx, ConfigChanged{Key: "price"})
+ */
+func Subscribe[T any](bus *EventBus, topic *Topic[T], handler func(ctx context.Context, event T) error, opts ...SubscribeOption) *Subscription {
+	ctx, cancel := context.WithCancel(bus.ctx)
+	s := &Subscription{
+		bus:     bus,
+		client:  topic.client,
+		channel: topic.Channel(),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	bus.mu.Lock()
+	bus.subs[s] = struct{}{}
+	bus.mu.Unlock()
+
+	go s.run(func(payload string) error {
+		var event T
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			return fmt.Errorf("unmarshal event error: %s", err)
+		}
+		return handler(ctx, event)
+	})
+	return s
+}
+
+// Channel 返回订阅的频道名称
+func (s *Subscription) Channel() string {
+	return s.channel
+}
+
+// Unsubscribe 退订并等待处理函数返回, 不能在 handler 内调用
+func (s *Subscription) Unsubscribe() {
+	s.cancel()
+	s.mu.Lock()
+	if s.pubsub != nil {
+		s.pubsub.Close()
+	}
+	s.mu.Unlock()
+	<-s.done
+
+	s.bus.mu.Lock()
+	delete(s.bus.subs, s)
+	s.bus.mu.Unlock()
+}
+
+// run 接收消息直到退订, 连接出错时按指数退避重连
+func (s *Subscription) run(handle func(payload string) error) {
+	defer close(s.done)
+
+	var (
+		log       = s.bus.log
+		backoff   = time.Second
+		connected = false
+	)
+	for s.ctx.Err() == nil {
+		ps, err := subscribe(s.ctx, pick(s.client), s.channel)
+		if err == nil {
+			if _, err = ps.Receive(s.ctx); err != nil {
+				ps.Close()
+			}
+		}
+		if err != nil {
+			log.Warnf("subscribe %s error: %s, retry after %s", s.channel, err, backoff)
+			if !s.sleep(backoff) {
+				return
+			}
+			if backoff *= 2; backoff > 30*time.Second {
+				backoff = 30 * time.Second
+			}
+			continue
+		}
+		if !s.setPubSub(ps) {
+			ps.Close()
+			return
+		}
+		if connected && s.onReconnect != nil {
+			if err := s.call(func() error { s.onReconnect(); return nil }); err != nil {
+				log.Errorf("reconnect %s callback error: %s", s.channel, err)
+			}
+		}
+		connected, backoff = true, time.Second
+
+		for {
+			msg, err := ps.ReceiveMessage(s.ctx)
+			if err != nil {
+				if s.ctx.Err() == nil {
+					log.Warnf("receive %s error: %s, reconnecting", s.channel, err)
+				}
+				break
+			}
+			if err = s.call(func() error { return handle(msg.Payload) }); err != nil {
+				log.Errorf("handle %s event error: %s", s.channel, err)
+			}
+		}
+		s.setPubSub(nil)
+		ps.Close()
+	}
+}
+
+// call 执行 fn 并将 panic 转为错误
+func (s *Subscription) call(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return fn()
+}
+
+// setPubSub 记录当前连接, 已退订时返回 false
+func (s *Subscription) setPubSub(ps PubSubConn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ps != nil && s.ctx.Err() != nil {
+		return false
+	}
+	s.pubsub = ps
+	return true
+}
+
+// sleep 等待 d, 已退订时返回 false
+func (s *Subscription) sleep(d time.Duration) bool {
+	select {
+	case <-s.ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
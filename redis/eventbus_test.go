@@ -0,0 +1,74 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/require"
+)
+
+type testEvent struct {
+	Name string `json:"name"`
+}
+
+func TestEventBus(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer c.Close()
+	topic := NewTopic[testEvent]("test").WithClient(c)
+	ctx := context.Background()
+
+	bus := NewEventBus()
+	got := make(chan string, 10)
+	reconnected := make(chan struct{}, 10)
+	Subscribe(bus, topic, func(ctx context.Context, e testEvent) error {
+		if e.Name == "panic" {
+			panic("boom")
+		}
+		got <- e.Name
+		return nil
+	}, OnReconnect(func() { reconnected <- struct{}{} }))
+	subscribed := func() bool { return mr.PubSubNumSub(topic.Channel())[topic.Channel()] == 1 }
+	require.Eventually(t, subscribed, time.Second, 10*time.Millisecond)
+
+	// handler panic 被恢复, 后续事件继续处理
+	for _, name := range []string{"panic", "a"} {
+		_, err := topic.Publish(ctx, testEvent{Name: name})
+		require.NoError(t, err)
+	}
+	select {
+	case name := <-got:
+		require.Equal(t, "a", name)
+	case <-time.After(time.Second):
+		t.Fatal("event not handled after panic")
+	}
+
+	// 连接断开后重新订阅并回调 OnReconnect
+	mr.Close()
+	require.NoError(t, mr.Restart())
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription not reconnected")
+	}
+	require.Eventually(t, subscribed, time.Second, 10*time.Millisecond)
+	_, err := topic.Publish(ctx, testEvent{Name: "b"})
+	require.NoError(t, err)
+	select {
+	case name := <-got:
+		require.Equal(t, "b", name)
+	case <-time.After(time.Second):
+		t.Fatal("event not handled after reconnect")
+	}
+
+	// Close 退订全部订阅
+	require.NoError(t, bus.Close())
+	require.Eventually(t, func() bool { return !subscribed() }, time.Second, 10*time.Millisecond)
+	n, err := topic.Publish(ctx, testEvent{Name: "c"})
+	require.NoError(t, err)
+	require.Equal(t, int64(0), n)
+	require.Empty(t, got)
+}
@@ -0,0 +1,358 @@
+package redis
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	textMarshalerT   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerT = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+	hashFieldsCache sync.Map // reflect.Type -> []hashField
+)
+
+// hashField 结构体字段与 hash field 的映射
+type hashField struct {
+	name      string
+	index     []int
+	json      bool // 以 JSON 编码
+	counter   bool // 计数字段, 由 HIncrBy 维护
+	omitEmpty bool // 零值时不写入
+}
+
+/**
+ * HSetStruct 将结构体写入 hash, 字段通过 redis tag 映射, 未设置 tag 的字段忽略, 匿名嵌入的结构体会展开
+ * tag 选项：
+ *   json      以 JSON 编码, 未实现 encoding.TextMarshaler 的结构体、map、slice 默认使用 JSON
+ *   counter   计数字段, 默认不写入, 避免覆盖其他副本通过 HIncrBy 累加的值
+ *   omitempty 零值时不写入
+ * 整数、浮点、bool(1/0)、string 直接转换, decimal.Decimal、types.Date、types.Time、time.Time 使用 MarshalText, nil 指针不写入
+ * fields 不为空时只写入指定的 hash field(包括计数字段)
+ * v 必须为结构体或非 nil 的结构体指针, 否则返回错误
+ *
+ * Example:
+ *
+ * type Profile struct {
+ * 	Id       int64           `redis:"id"`
+ * 	Name     string          `redis:"name"`
+ * 	Balance  decimal.Decimal `redis:"balance"`
+ * 	Birthday types.Date      `redis:"birthday"`
+ * 	Vip      bool            `redis:"vip"`
+ * 	Tags     []string        `redis:"tags"`
+ * 	Visits   int64           `redis:"visits,counter"`
+ * }
+ *
+ * c := redis.New()
+ * c.HSetStruct("profile:42", &p)
+ * c.HSetStruct("profile:42", &p, "name") // 只更新 name
+ * c.HIncrBy("profile:42", "visits", 1)
+ *
+ * var p Profile
+ * err := c.HGetAllInto("profile:42", &p)         // 不存在时返回 redis.Nil
+ * err = c.HGetInto("profile:42", &p, "name", "vip") // 只加载部分字段
+ */
+func (c *Cache) HSetStruct(key string, v interface{}, fields ...string) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return errors.New("redis: v must be a struct or a non-nil pointer to struct")
+	}
+	hfs, err := structHashFields(rv.Type())
+	if err != nil {
+		return err
+	}
+	if hfs, err = selectHashFields(hfs, fields); err != nil {
+		return err
+	}
+
+	values := make([]interface{}, 0, len(hfs)*2)
+	for _, f := range hfs {
+		if f.counter && len(fields) == 0 {
+			continue
+		}
+		fv := rv.FieldByIndex(f.index)
+		if f.omitEmpty && fv.IsZero() {
+			continue
+		}
+		s, ok, err := encodeHashValue(fv, f.json)
+		if err != nil {
+			return fmt.Errorf("encode field %s error: %s", f.name, err)
+		}
+		if ok {
+			values = append(values, f.name, s)
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	return c.Client().HSet(ctx, fmt.Sprintf("%s%s", c.prefix, key), values...).Err()
+}
+
+// HGetAllInto 读取整个 hash 到 dst 指向的结构体, 未映射的 hash field 忽略, key 不存在时返回 Nil
+func (c *Cache) HGetAllInto(key string, dst interface{}) error {
+	rv, hfs, err := hashDest(dst)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	m, err := c.Client().HGetAll(ctx, fmt.Sprintf("%s%s", c.prefix, key)).Result()
+	if err != nil {
+		return err
+	}
+	if len(m) == 0 {
+		return Nil
+	}
+	for _, f := range hfs {
+		s, ok := m[f.name]
+		if !ok {
+			continue
+		}
+		if err = decodeHashValue(s, rv.FieldByIndex(f.index), f.json); err != nil {
+			return fmt.Errorf("decode field %s error: %s", f.name, err)
+		}
+	}
+	return nil
+}
+
+// HGetInto 读取指定的 hash field 到 dst 指向的结构体, fields 为空时读取全部映射字段, 不存在的字段保持原值, 全部不存在时返回 Nil
+func (c *Cache) HGetInto(key string, dst interface{}, fields ...string) error {
+	rv, hfs, err := hashDest(dst)
+	if err != nil {
+		return err
+	}
+	if hfs, err = selectHashFields(hfs, fields); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(hfs))
+	for _, f := range hfs {
+		names = append(names, f.name)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	vals, err := c.Client().HMGet(ctx, fmt.Sprintf("%s%s", c.prefix, key), names...).Result()
+	if err != nil {
+		return err
+	}
+	found := false
+	for i, f := range hfs {
+		s, ok := vals[i].(string)
+		if !ok {
+			continue
+		}
+		found = true
+		if err = decodeHashValue(s, rv.FieldByIndex(f.index), f.json); err != nil {
+			return fmt.Errorf("decode field %s error: %s", f.name, err)
+		}
+	}
+	if !found {
+		return Nil
+	}
+	return nil
+}
+
+// HIncrBy 原子累加 hash field, 返回累加后的值
+func (c *Cache) HIncrBy(key string, field string, incr int64) (int64, error) {
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	return c.Client().HIncrBy(ctx, fmt.Sprintf("%s%s", c.prefix, key), field, incr).Result()
+}
+
+// HIncrByFloat 原子累加 hash field 的浮点值, 返回累加后的值
+func (c *Cache) HIncrByFloat(key string, field string, incr float64) (float64, error) {
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	return c.Client().HIncrByFloat(ctx, fmt.Sprintf("%s%s", c.prefix, key), field, incr).Result()
+}
+
+// hashDest 检查 dst 为非 nil 的结构体指针并返回字段映射
+func hashDest(dst interface{}) (reflect.Value, []hashField, error) {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, nil, errors.New("redis: dst must be a non-nil pointer to struct")
+	}
+	rv = rv.Elem()
+	hfs, err := structHashFields(rv.Type())
+	return rv, hfs, err
+}
+
+// selectHashFields 按 hash field 名称筛选, names 为空时返回全部
+func selectHashFields(hfs []hashField, names []string) ([]hashField, error) {
+	if len(names) == 0 {
+		return hfs, nil
+	}
+	r := make([]hashField, 0, len(names))
+	for _, name := range names {
+		found := false
+		for _, f := range hfs {
+			if f.name == name {
+				r = append(r, f)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("redis: unknown hash field %s", name)
+		}
+	}
+	return r, nil
+}
+
+// structHashFields 解析结构体的 redis tag, 结果按类型缓存
+func structHashFields(t reflect.Type) ([]hashField, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("redis: %s is not a struct", t)
+	}
+	if v, ok := hashFieldsCache.Load(t); ok {
+		return v.([]hashField), nil
+	}
+	hfs := collectHashFields(t, nil)
+	hashFieldsCache.Store(t, hfs)
+	return hfs, nil
+}
+
+func collectHashFields(t reflect.Type, index []int) []hashField {
+	var hfs []hashField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("redis")
+		if tag == "-" {
+			continue
+		}
+		idx := append(append([]int{}, index...), i)
+		if !ok {
+			if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+				hfs = append(hfs, collectHashFields(sf.Type, idx)...)
+			}
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		f := hashField{name: opts[0], index: idx}
+		if len(f.name) == 0 {
+			f.name = sf.Name
+		}
+		for _, opt := range opts[1:] {
+			switch opt {
+			case "json":
+				f.json = true
+			case "counter":
+				f.counter = true
+			case "omitempty":
+				f.omitEmpty = true
+			}
+		}
+		hfs = append(hfs, f)
+	}
+	return hfs
+}
+
+// encodeHashValue 编码字段值, nil 指针返回 false
+func encodeHashValue(v reflect.Value, useJSON bool) (string, bool, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", false, nil
+		}
+		v = v.Elem()
+	}
+	if useJSON {
+		b, err := json.Marshal(v.Interface())
+		return string(b), err == nil, err
+	}
+	if v.Type().Implements(textMarshalerT) {
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err == nil, err
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), true, nil
+	case reflect.Bool:
+		if v.Bool() {
+			return "1", true, nil
+		}
+		return "0", true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), true, nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), true, nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), true, nil
+		}
+	}
+	b, err := json.Marshal(v.Interface())
+	return string(b), err == nil, err
+}
+
+// decodeHashValue 解码 s 到字段, nil 指针会先分配
+func decodeHashValue(s string, v reflect.Value, useJSON bool) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if useJSON {
+		return json.Unmarshal([]byte(s), v.Addr().Interface())
+	}
+	if v.Addr().Type().Implements(textUnmarshalerT) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+		return nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(s))
+			return nil
+		}
+	}
+	return json.Unmarshal([]byte(s), v.Addr().Interface())
+}
@@ -0,0 +1,91 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/scrawld/library/types"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+type testBase struct {
+	Id int64 `redis:"id"`
+}
+
+type testProfile struct {
+	testBase
+	Name     string            `redis:"name"`
+	Balance  decimal.Decimal   `redis:"balance"`
+	Birthday types.Date        `redis:"birthday"`
+	LoginAt  types.Time        `redis:"login_at"`
+	Vip      bool              `redis:"vip"`
+	Score    *float64          `redis:"score"`
+	Extra    map[string]string `redis:"extra"`
+	Visits   int64             `redis:"visits,counter"`
+	Ignored  string
+}
+
+func TestHashStruct(t *testing.T) {
+	newTestClient(t)
+	c := New()
+
+	score := 9.5
+	p := testProfile{
+		testBase: testBase{Id: 42},
+		Name:     "ziy",
+		Balance:  decimal.RequireFromString("12.34"),
+		Birthday: types.Date(time.Date(2000, 1, 2, 0, 0, 0, 0, time.Local)),
+		LoginAt:  types.Time(time.Date(2024, 3, 6, 10, 0, 0, 0, time.Local)),
+		Vip:      true,
+		Score:    &score,
+		Extra:    map[string]string{"city": "sz"},
+		Visits:   100,
+		Ignored:  "x",
+	}
+	require.NoError(t, c.HSetStruct("profile", &p))
+
+	n, err := c.HIncrBy("profile", "visits", 2)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), n)
+
+	var got testProfile
+	require.NoError(t, c.HGetAllInto("profile", &got))
+	require.Equal(t, int64(42), got.Id)
+	require.Equal(t, "ziy", got.Name)
+	require.True(t, p.Balance.Equal(got.Balance))
+	require.Equal(t, p.Birthday.String(), got.Birthday.String())
+	require.Equal(t, p.LoginAt.String(), got.LoginAt.String())
+	require.True(t, got.Vip)
+	require.Equal(t, score, *got.Score)
+	require.Equal(t, p.Extra, got.Extra)
+	require.Equal(t, int64(2), got.Visits)
+	require.Empty(t, got.Ignored)
+
+	require.NoError(t, c.HSetStruct("profile", &testProfile{Name: "new"}, "name"))
+	var partial testProfile
+	require.NoError(t, c.HGetInto("profile", &partial, "name", "vip"))
+	require.Equal(t, "new", partial.Name)
+	require.True(t, partial.Vip)
+	require.Zero(t, partial.Id)
+
+	require.Equal(t, Nil, c.HGetAllInto("missing", &got))
+	require.Error(t, c.HGetInto("profile", &got, "unknown"))
+}
+
+func TestHashStructInvalid(t *testing.T) {
+	newTestClient(t)
+	c := New()
+
+	var nilProfile *testProfile
+	n := 1
+	for _, v := range []interface{}{nil, nilProfile, &nilProfile, n, &n} {
+		require.Error(t, c.HSetStruct("profile:1", v))
+	}
+	require.NoError(t, c.HSetStruct("profile:1", testProfile{Name: "a"}))
+
+	for _, dst := range []interface{}{nil, nilProfile, &nilProfile, testProfile{}, &n} {
+		require.Error(t, c.HGetAllInto("profile:1", dst))
+		require.Error(t, c.HGetInto("profile:1", dst, "name"))
+	}
+}
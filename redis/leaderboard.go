@@ -0,0 +1,436 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/scrawld/library/util"
+)
+
+// LeaderboardPeriod 排行榜周期
+type LeaderboardPeriod int
+
+const (
+	PeriodDay   LeaderboardPeriod = iota // 日榜, key 后缀 d.20060102
+	PeriodWeek                           // 周榜(ISO 周), key 后缀 w.<ISO 年份><周次>, 例如 w.202409
+	PeriodMonth                          // 月榜, key 后缀 m.200601
+	PeriodTotal                          // 总榜, key 后缀 all
+)
+
+const (
+	// leaderboardTieBits 分数低位用于同分排序, 高位保存分数, 分数范围为 ±2^31
+	leaderboardTieBits = 22
+	leaderboardTieSpan = 1 << leaderboardTieBits
+
+	// leaderboardMaxMerge Merge 最多合并的周期数, 日、周、月榜的 tie 只使用低 17 位, 合并 32 个周期求和后不会进位到分数
+	leaderboardMaxMerge     = 32
+	leaderboardPeriodTieTop = leaderboardTieSpan/leaderboardMaxMerge - 1
+)
+
+// leaderboardEpoch 总榜同分排序的起始时间, 以小时为单位可覆盖约 478 年
+var leaderboardEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// 存储的 score = 分数 * 2^22 + tie, tie = top - (更新时间 - 周期开始时间) / unit, 同分时先达到的排在前面
+var (
+	// leaderboardIncrScript KEYS: 各周期 key; ARGV: member, delta, now, 每个 key 依次为 base, unit, top, expireAt
+	leaderboardIncrScript = newScript(`
+local span = 4194304
+local member, delta, now = ARGV[1], tonumber(ARGV[2]), tonumber(ARGV[3])
+local res = {}
+for i, key in ipairs(KEYS) do
+	local base = tonumber(ARGV[4 + (i - 1) * 4])
+	local unit = tonumber(ARGV[5 + (i - 1) * 4])
+	local top = tonumber(ARGV[6 + (i - 1) * 4])
+	local expireAt = tonumber(ARGV[7 + (i - 1) * 4])
+	local score = delta
+	local old = redis.call("ZSCORE", key, member)
+	if old then
+		score = math.floor(tonumber(old) / span) + delta
+	end
+	local tie = top - math.floor((now - base) / unit)
+	tie = math.max(0, math.min(top, tie))
+	redis.call("ZADD", key, string.format("%.0f", score * span + tie), member)
+	if expireAt > 0 then
+		redis.call("EXPIREAT", key, expireAt)
+	end
+	res[i] = score
+end
+return res`, memLeaderboardIncr)
+
+	// leaderboardMergeScript 使用 ZUNIONSTORE SUM 将 KEYS[2:] 汇总到 KEYS[1], ARGV[1] 为过期毫秒数, 0 表示不过期
+	leaderboardMergeScript = newScript(`
+local n = redis.call("ZUNIONSTORE", KEYS[1], #KEYS - 1, unpack(KEYS, 2))
+if n > 0 and tonumber(ARGV[1]) > 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return n`, memLeaderboardMerge)
+)
+
+func memLeaderboardIncr(m *MemoryClient, keys, args []string) (interface{}, error) {
+	const span = leaderboardTieSpan
+	member, delta, now := args[0], memFloat(args[1]), memFloat(args[2])
+	res := make([]interface{}, 0, len(keys))
+	for i, key := range keys {
+		base := memFloat(args[3+i*4])
+		unit := memFloat(args[4+i*4])
+		top := memFloat(args[5+i*4])
+		expireAt := memInt(args[6+i*4])
+		it, err := m.create(key, memoryZSet)
+		if err != nil {
+			return nil, err
+		}
+		score := delta
+		if old, ok := it.zset[member]; ok {
+			score = math.Floor(old/span) + delta
+		}
+		tie := top - math.Floor((now-base)/unit)
+		tie = math.Max(0, math.Min(top, tie))
+		it.zset[member] = score*span + tie
+		if expireAt > 0 {
+			m.pexpire(key, time.Unix(expireAt, 0).Sub(m.now))
+		}
+		res = append(res, int64(score))
+	}
+	return res, nil
+}
+
+func memLeaderboardMerge(m *MemoryClient, keys, args []string) (interface{}, error) {
+	scores := map[string]float64{}
+	for _, key := range keys[1:] {
+		it, err := m.lookupKind(key, memoryZSet)
+		if err != nil {
+			return nil, err
+		}
+		if it == nil {
+			continue
+		}
+		for member, v := range it.zset {
+			scores[member] += v
+		}
+	}
+	m.del(keys[0])
+	if len(scores) == 0 {
+		return int64(0), nil
+	}
+	it, err := m.create(keys[0], memoryZSet)
+	if err != nil {
+		return nil, err
+	}
+	it.zset = scores
+	if px := memMs(args[0]); px > 0 {
+		m.pexpire(keys[0], px)
+	}
+	return int64(len(scores)), nil
+}
+
+// LeaderboardEntry 排行榜条目
+type LeaderboardEntry struct {
+	Member string
+	Score  int64
+	Rank   int64 // 名次, 从 1 开始
+}
+
+// Leaderboard 按日、周、月及总榜同时维护的排行榜
+type Leaderboard struct {
+	ctx       context.Context
+	timeout   time.Duration
+	client    Cmdable
+	prefix    string
+	name      string
+	periods   []LeaderboardPeriod
+	retention map[LeaderboardPeriod]time.Duration
+}
+
+// leaderboardPeriodSpec 周期 key 及同分排序参数
+type leaderboardPeriodSpec struct {
+	key  string
+	base time.Time
+	end  time.Time // 周期结束时间, 总榜为零值
+	unit int64     // tie 的时间单位(秒)
+	top  int64     // tie 的最大值, 即周期开始时的 tie
+}
+
+/**
+ * NewLeaderboard 创建排行榜, periods 为维护的周期, 默认日、周、月及总榜
+ * key 格式：<KeyPrefix>.leaderboard.{name}.<周期>, 使用 hash tag 保证集群模式下位于同一 slot
+ * 分数为整数, 同分时先达到该分数的排在前面, 过期周期默认在周期结束后保留 日榜 31 天、周榜 8 周、月榜 1 年
+ *
+ * Example:
+ *
+ * lb := redis.NewLeaderboard("game")
+ * lb.Incr("user:42", 10) // 同时累加日、周、月及总榜
+ *
+ * top, _ := lb.Top(lb.PeriodKey(redis.PeriodDay, time.Now()), 10)
+ * around, _ := lb.AroundMe(lb.PeriodKey(redis.PeriodWeek, time.Now()), "user:42", 5)
+ *
+ * // 最近 7 天
+ * now := time.Now()
+ * lb.Merge("last7d", redis.PeriodDay, now.AddDate(0, 0, -6), now, time.Hour)
+ * top7d, _ := lb.Top(lb.MergedKey("last7d"), 10)
+ */
+func NewLeaderboard(name string, periods ...LeaderboardPeriod) *Leaderboard {
+	if len(periods) == 0 {
+		periods = []LeaderboardPeriod{PeriodDay, PeriodWeek, PeriodMonth, PeriodTotal}
+	}
+	return &Leaderboard{
+		ctx:     context.Background(),
+		prefix:  fmt.Sprintf("%s.leaderboard.", KeyPrefix),
+		name:    name,
+		periods: periods,
+		retention: map[LeaderboardPeriod]time.Duration{
+			PeriodDay:   31 * 24 * time.Hour,
+			PeriodWeek:  8 * 7 * 24 * time.Hour,
+			PeriodMonth: 366 * 24 * time.Hour,
+		},
+	}
+}
+
+// SetPrefix 设置前缀
+func (l *Leaderboard) SetPrefix(prefix string) *Leaderboard {
+	l.prefix = prefix
+	return l
+}
+
+// EmptyPrefix 清空前缀
+func (l *Leaderboard) EmptyPrefix() *Leaderboard {
+	l.prefix = ""
+	return l
+}
+
+// SetRetention 设置周期结束后的保留时间, d <= 0 表示不过期, 对总榜无效
+func (l *Leaderboard) SetRetention(period LeaderboardPeriod, d time.Duration) *Leaderboard {
+	l.retention[period] = d
+	return l
+}
+
+// WithContext 返回使用 ctx 的副本
+func (l *Leaderboard) WithContext(ctx context.Context) *Leaderboard {
+	if ctx == nil {
+		panic("redis: nil context")
+	}
+	r := *l
+	r.ctx = ctx
+	return &r
+}
+
+// WithTimeout 返回设置单条命令超时时间的副本, timeout <= 0 表示不限制
+func (l *Leaderboard) WithTimeout(timeout time.Duration) *Leaderboard {
+	r := *l
+	r.timeout = timeout
+	return &r
+}
+
+// WithClient 返回使用指定客户端的副本, c 为 nil 时使用 DefaultClient()
+func (l *Leaderboard) WithClient(c Cmdable) *Leaderboard {
+	r := *l
+	r.client = c
+	return &r
+}
+
+// Client 返回使用的客户端
+func (l *Leaderboard) Client() Cmdable {
+	return pick(l.client)
+}
+
+// PeriodKey 返回 tm 所在周期的完整 key
+func (l *Leaderboard) PeriodKey(period LeaderboardPeriod, tm time.Time) string {
+	return l.spec(period, tm).key
+}
+
+// MergedKey 返回 Merge 结果的完整 key
+func (l *Leaderboard) MergedKey(dest string) string {
+	return l.prefix + "{" + l.name + "}.merge." + dest
+}
+
+// Incr 为 member 在所有周期累加 delta, 返回各周期的最新分数
+func (l *Leaderboard) Incr(member string, delta int64) (map[LeaderboardPeriod]int64, error) {
+	return l.IncrAt(member, delta, time.Now())
+}
+
+// IncrAt 以 tm 作为计分时间累加 delta
+func (l *Leaderboard) IncrAt(member string, delta int64, tm time.Time) (map[LeaderboardPeriod]int64, error) {
+	var (
+		keys = make([]string, 0, len(l.periods))
+		args = []interface{}{member, delta, tm.Unix()}
+	)
+	for _, p := range l.periods {
+		spec := l.spec(p, tm)
+		var expireAt int64
+		if d := l.retention[p]; !spec.end.IsZero() && d > 0 {
+			expireAt = spec.end.Add(d).Unix()
+		}
+		keys = append(keys, spec.key)
+		args = append(args, spec.base.Unix(), spec.unit, spec.top, expireAt)
+	}
+
+	ctx, cancel := withTimeout(l.ctx, l.timeout)
+	defer cancel()
+	vals, err := leaderboardIncrScript.Run(ctx, l.Client(), keys, args...).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+	r := make(map[LeaderboardPeriod]int64, len(vals))
+	for i, v := range vals {
+		r[l.periods[i]] = v
+	}
+	return r, nil
+}
+
+// Score 返回 member 的分数, 不存在时返回 Nil
+func (l *Leaderboard) Score(key, member string) (int64, error) {
+	ctx, cancel := withTimeout(l.ctx, l.timeout)
+	defer cancel()
+	v, err := l.Client().ZScore(ctx, key, member).Result()
+	if err != nil {
+		return 0, err
+	}
+	return decodeLeaderboardScore(v), nil
+}
+
+// Rank 返回 member 的名次和分数, 不存在时返回 Nil
+func (l *Leaderboard) Rank(key, member string) (*LeaderboardEntry, error) {
+	ctx, cancel := withTimeout(l.ctx, l.timeout)
+	defer cancel()
+	rank, err := l.Client().ZRevRank(ctx, key, member).Result()
+	if err != nil {
+		return nil, err
+	}
+	v, err := l.Client().ZScore(ctx, key, member).Result()
+	if err != nil {
+		return nil, err
+	}
+	return &LeaderboardEntry{Member: member, Score: decodeLeaderboardScore(v), Rank: rank + 1}, nil
+}
+
+// Top 返回前 n 名
+func (l *Leaderboard) Top(key string, n int64) ([]LeaderboardEntry, error) {
+	if n <= 0 {
+		return []LeaderboardEntry{}, nil
+	}
+	return l.Range(key, 0, n-1)
+}
+
+// Range 返回名次区间 [start, stop] 的条目, 从 0 开始
+func (l *Leaderboard) Range(key string, start, stop int64) ([]LeaderboardEntry, error) {
+	ctx, cancel := withTimeout(l.ctx, l.timeout)
+	defer cancel()
+	zs, err := l.Client().ZRevRangeWithScores(ctx, key, start, stop).Result()
+	if err != nil {
+		return nil, err
+	}
+	r := make([]LeaderboardEntry, 0, len(zs))
+	for i, z := range zs {
+		member, _ := z.Member.(string)
+		r = append(r, LeaderboardEntry{Member: member, Score: decodeLeaderboardScore(z.Score), Rank: start + int64(i) + 1})
+	}
+	return r, nil
+}
+
+// AroundMe 返回 member 前后各 radius 名的条目(包含自己), member 不存在时返回 Nil
+func (l *Leaderboard) AroundMe(key, member string, radius int64) ([]LeaderboardEntry, error) {
+	ctx, cancel := withTimeout(l.ctx, l.timeout)
+	defer cancel()
+	rank, err := l.Client().ZRevRank(ctx, key, member).Result()
+	if err != nil {
+		return nil, err
+	}
+	start := rank - radius
+	if start < 0 {
+		start = 0
+	}
+	return l.Range(key, start, rank+radius)
+}
+
+// Count 返回上榜人数
+func (l *Leaderboard) Count(key string) (int64, error) {
+	ctx, cancel := withTimeout(l.ctx, l.timeout)
+	defer cancel()
+	return l.Client().ZCard(ctx, key).Result()
+}
+
+// Remove 从所有周期中移除 member
+func (l *Leaderboard) Remove(member string, tm time.Time) error {
+	ctx, cancel := withTimeout(l.ctx, l.timeout)
+	defer cancel()
+	for _, p := range l.periods {
+		if err := l.Client().ZRem(ctx, l.PeriodKey(p, tm), member).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Merge 使用 ZUNIONSTORE 汇总 [from, to] 内各周期的分数写入 MergedKey(dest), 最多 32 个周期
+// expire 为结果的过期时间, 0 表示不过期, 返回人数
+// 合并后同分时上榜周期多的排在前面, 其次按各周期内达到分数的时间之和排序
+func (l *Leaderboard) Merge(dest string, period LeaderboardPeriod, from, to time.Time, expire time.Duration) (int64, error) {
+	keys := []string{l.MergedKey(dest)}
+	switch period {
+	case PeriodDay:
+		for _, d := range util.GetDateRange(from, to) {
+			keys = append(keys, l.spec(PeriodDay, d).key)
+		}
+	case PeriodWeek:
+		for _, w := range util.GetWeekRange(from, to) {
+			first, _ := util.GetWeekBounds(w)
+			keys = append(keys, l.spec(PeriodWeek, first).key)
+		}
+	case PeriodMonth:
+		for _, m := range util.GetMonthRange(from, to) {
+			first, _ := util.GetMonthBounds(m)
+			keys = append(keys, l.spec(PeriodMonth, first).key)
+		}
+	default:
+		return 0, fmt.Errorf("leaderboard period %d can not be merged", period)
+	}
+	if len(keys) == 1 {
+		return 0, nil
+	}
+	if len(keys)-1 > leaderboardMaxMerge {
+		return 0, fmt.Errorf("leaderboard can merge at most %d periods, got %d", leaderboardMaxMerge, len(keys)-1)
+	}
+
+	ctx, cancel := withTimeout(l.ctx, l.timeout)
+	defer cancel()
+	return leaderboardMergeScript.Run(ctx, l.Client(), keys, expire.Milliseconds()).Int64()
+}
+
+func (l *Leaderboard) spec(period LeaderboardPeriod, tm time.Time) leaderboardPeriodSpec {
+	var (
+		prefix = l.prefix + "{" + l.name + "}."
+		spec   = leaderboardPeriodSpec{unit: 1, top: leaderboardPeriodTieTop}
+	)
+	// 各周期的 unit 保证 (end - base) / unit 不超过 top
+	switch period {
+	case PeriodDay:
+		spec.base = util.StartOfDay(tm)
+		spec.end = spec.base.AddDate(0, 0, 1)
+		spec.key = prefix + "d." + strconv.Itoa(util.GetDtByOffset(tm, 0))
+	case PeriodWeek:
+		week := util.GetWeekByOffset(tm, 0)
+		spec.base, _ = util.GetWeekBounds(week)
+		spec.end = spec.base.AddDate(0, 0, 7)
+		spec.unit = 5
+		spec.key = prefix + "w." + strconv.Itoa(week)
+	case PeriodMonth:
+		month := util.GetMonthByOffset(tm, 0)
+		spec.base, _ = util.GetMonthBounds(month)
+		spec.end = spec.base.AddDate(0, 1, 0)
+		spec.unit = 30
+		spec.key = prefix + "m." + strconv.Itoa(month)
+	default:
+		spec.base = leaderboardEpoch
+		spec.unit = 3600
+		spec.top = leaderboardTieSpan - 1
+		spec.key = prefix + "all"
+	}
+	return spec
+}
+
+// decodeLeaderboardScore 去掉同分排序位, 返回原始分数
+func decodeLeaderboardScore(v float64) int64 {
+	return int64(math.Floor(v / leaderboardTieSpan))
+}
@@ -0,0 +1,182 @@
+package redis
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// localCache 进程内 LRU 缓存, 超出容量时淘汰最久未使用的条目, 过期条目在访问时删除
+// 从 redis 回填时先 reserve 取得序号, 读取期间 key 被删除则序号失效, 回填被忽略, 避免写入读到的旧值
+type localCache struct {
+	mu      sync.Mutex
+	size    int
+	ll      *list.List
+	items   map[string]*list.Element
+	seq     uint64
+	pending map[string]uint64 // 正在回填的 key 及其序号
+	now     func() time.Time
+}
+
+type localEntry struct {
+	key      string
+	value    string
+	fields   map[string]string // hash 类型缓存的字段, 为 nil 表示字符串类型
+	expireAt time.Time
+}
+
+func newLocalCache(size int) *localCache {
+	if size <= 0 {
+		size = 1
+	}
+	return &localCache{
+		size:    size,
+		ll:      list.New(),
+		items:   map[string]*list.Element{},
+		pending: map[string]uint64{},
+		now:     time.Now,
+	}
+}
+
+// get 返回字符串类型的值
+func (l *localCache) get(key string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e := l.lookup(key)
+	if e == nil || e.fields != nil {
+		return "", false
+	}
+	return e.value, true
+}
+
+// set 保存字符串类型的值
+func (l *localCache) set(key, value string, ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.store(&localEntry{key: key, value: value, expireAt: l.now().Add(ttl)})
+}
+
+// hget 返回 hash 字段的值
+func (l *localCache) hget(key, field string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e := l.lookup(key)
+	if e == nil || e.fields == nil {
+		return "", false
+	}
+	v, ok := e.fields[field]
+	return v, ok
+}
+
+// hset 保存 hash 字段的值, 已缓存的 hash 保留原过期时间
+func (l *localCache) hset(key, field, value string, ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hstore(key, field, value, ttl)
+}
+
+// reserve 开始从 redis 读取 key 前调用, 返回回填使用的序号, 结束后调用 release
+func (l *localCache) reserve(key string) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq++
+	l.pending[key] = l.seq
+	return l.seq
+}
+
+// release 结束回填, 序号仍有效时清除记录
+func (l *localCache) release(key string, seq uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.pending[key] == seq {
+		delete(l.pending, key)
+	}
+}
+
+// fill 序号仍有效时保存字符串类型的值
+func (l *localCache) fill(key string, seq uint64, value string, ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.pending[key] == seq {
+		l.store(&localEntry{key: key, value: value, expireAt: l.now().Add(ttl)})
+	}
+}
+
+// hfill 序号仍有效时保存 hash 字段的值
+func (l *localCache) hfill(key string, seq uint64, field, value string, ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.pending[key] == seq {
+		l.hstore(key, field, value, ttl)
+	}
+}
+
+// del 删除条目, 正在进行的回填失效
+func (l *localCache) del(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := l.items[key]; ok {
+			l.remove(el)
+		}
+		delete(l.pending, key)
+	}
+}
+
+// purge 清空全部条目, 正在进行的回填失效
+func (l *localCache) purge() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ll.Init()
+	l.items = map[string]*list.Element{}
+	l.pending = map[string]uint64{}
+}
+
+// len 返回条目数量(包含未清理的过期条目)
+func (l *localCache) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ll.Len()
+}
+
+// lookup 查找未过期的条目并移到队首, 调用方需持有锁
+func (l *localCache) lookup(key string) *localEntry {
+	el, ok := l.items[key]
+	if !ok {
+		return nil
+	}
+	e := el.Value.(*localEntry)
+	if !l.now().Before(e.expireAt) {
+		l.remove(el)
+		return nil
+	}
+	l.ll.MoveToFront(el)
+	return e
+}
+
+// hstore 保存 hash 字段的值, 调用方需持有锁
+func (l *localCache) hstore(key, field, value string, ttl time.Duration) {
+	if e := l.lookup(key); e != nil && e.fields != nil {
+		e.fields[field] = value
+		return
+	}
+	l.store(&localEntry{key: key, fields: map[string]string{field: value}, expireAt: l.now().Add(ttl)})
+}
+
+// store 保存条目, 超出容量时淘汰队尾, 调用方需持有锁
+func (l *localCache) store(e *localEntry) {
+	if el, ok := l.items[e.key]; ok {
+		el.Value = e
+		l.ll.MoveToFront(el)
+		return
+	}
+	l.items[e.key] = l.ll.PushFront(e)
+	for l.ll.Len() > l.size {
+		l.remove(l.ll.Back())
+	}
+}
+
+func (l *localCache) remove(el *list.Element) {
+	l.ll.Remove(el)
+	delete(l.items, el.Value.(*localEntry).key)
+}
@@ -0,0 +1,73 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalCache(t *testing.T) {
+	now := time.Date(2024, 3, 6, 10, 0, 0, 0, time.Local)
+	l := newLocalCache(2)
+	l.now = func() time.Time { return now }
+
+	l.set("a", "1", time.Minute)
+	l.set("b", "2", time.Minute)
+	_, ok := l.get("a") // a 移到队首, b 最久未使用
+	require.True(t, ok)
+	l.set("c", "3", time.Minute)
+	_, ok = l.get("b")
+	require.False(t, ok)
+	require.Equal(t, 2, l.len())
+
+	// 已缓存的 hash 追加字段时保留原过期时间
+	l.hset("h", "f1", "v1", time.Second)
+	now = now.Add(500 * time.Millisecond)
+	l.hset("h", "f2", "v2", time.Minute)
+	v, ok := l.hget("h", "f2")
+	require.True(t, ok)
+	require.Equal(t, "v2", v)
+	_, ok = l.get("h") // 类型不符
+	require.False(t, ok)
+	now = now.Add(500 * time.Millisecond)
+	_, ok = l.hget("h", "f1")
+	require.False(t, ok)
+
+	l.del("a")
+	_, ok = l.get("a")
+	require.False(t, ok)
+	l.purge()
+	require.Equal(t, 0, l.len())
+}
+
+func TestLocalCacheFill(t *testing.T) {
+	l := newLocalCache(10)
+
+	// 读取 redis 期间 key 被删除, 回填读到的旧值被忽略
+	seq := l.reserve("a")
+	l.del("a")
+	l.fill("a", seq, "old", time.Minute)
+	l.release("a", seq)
+	_, ok := l.get("a")
+	require.False(t, ok)
+
+	seq = l.reserve("h")
+	l.purge()
+	l.hfill("h", seq, "f", "old", time.Minute)
+	_, ok = l.hget("h", "f")
+	require.False(t, ok)
+
+	// 并发回填时仅最后一次 reserve 的结果生效
+	s1, s2 := l.reserve("a"), l.reserve("a")
+	l.fill("a", s1, "1", time.Minute)
+	_, ok = l.get("a")
+	require.False(t, ok)
+	l.fill("a", s2, "2", time.Minute)
+	l.release("a", s1)
+	l.release("a", s2)
+	v, ok := l.get("a")
+	require.True(t, ok)
+	require.Equal(t, "2", v)
+	require.Empty(t, l.pending)
+}
@@ -2,25 +2,131 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const (
+	defaultMinBackoff = 5 * time.Millisecond
+	defaultMaxBackoff = 500 * time.Millisecond
+
+	// fenceTTL fencing token 计数器在最后一次获取锁之后保留的时间, 不短于锁过期时间的 2 倍
+	fenceTTL = 7 * 24 * time.Hour
+)
+
+var (
+	ErrNotHeld     = errors.New("redis: lock not held")     // 锁不存在或已被其他持有者获取
+	ErrNotObtained = errors.New("redis: lock not obtained") // 在 context 结束前未获取到锁
+)
+
+var (
+	// lockScript 获取锁成功后自增 fencing token 并续期计数器, ARGV[2] 不大于 0 时锁不过期
+	lockScript = newScript(`
+local ok
+if tonumber(ARGV[2]) > 0 then
+	ok = redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2])
+else
+	ok = redis.call("SET", KEYS[1], ARGV[1], "NX")
+end
+if ok then
+	local token = redis.call("INCR", KEYS[2])
+	redis.call("PEXPIRE", KEYS[2], ARGV[3])
+	return token
+end
+return 0`, memLock)
+
+	// unlockScript 仅当 tag 一致时删除
+	unlockScript = newScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`, memUnlock)
+
+	// extendScript 仅当 tag 一致时续期, ARGV[2] 不大于 0 时取消过期
+	extendScript = newScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	if tonumber(ARGV[2]) > 0 then
+		return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	end
+	redis.call("PERSIST", KEYS[1])
+	return 1
+end
+return 0`, memExtend)
+)
+
+func memLock(m *MemoryClient, keys, args []string) (interface{}, error) {
+	if m.lookup(keys[0]) != nil {
+		return int64(0), nil
+	}
+	m.setString(keys[0], args[0], memMs(args[1]))
+	token, err := m.incrBy(keys[1], 1)
+	if err != nil {
+		return nil, err
+	}
+	m.pexpire(keys[1], memMs(args[2]))
+	return token, nil
+}
+
+func memUnlock(m *MemoryClient, keys, args []string) (interface{}, error) {
+	v, ok, err := m.getString(keys[0])
+	if err != nil || !ok || v != args[0] {
+		return int64(0), err
+	}
+	return m.del(keys[0]), nil
+}
+
+func memExtend(m *MemoryClient, keys, args []string) (interface{}, error) {
+	v, ok, err := m.getString(keys[0])
+	if err != nil || !ok || v != args[0] {
+		return int64(0), err
+	}
+	if px := memMs(args[1]); px > 0 {
+		return memBool(m.pexpire(keys[0], px)), nil
+	}
+	m.lookup(keys[0]).expireAt = time.Time{}
+	return int64(1), nil
+}
+
 type Lock struct {
-	prefix string
-	rawKey string
-	tag    string
+	ctx     context.Context
+	timeout time.Duration
+	client  Cmdable
+	prefix  string
+	rawKey  string
+	tag     string
+
+	minBackoff time.Duration // 等待锁时的最小重试间隔
+	maxBackoff time.Duration // 等待锁时的最大重试间隔
+
+	watchdog bool          // 是否启用看门狗
+	interval time.Duration // 看门狗续期间隔
+	state    *lockState    // 持有状态, WithContext 等返回的副本共享同一状态
+}
+
+// lockState 锁的持有状态
+type lockState struct {
+	mu        sync.Mutex
+	token     int64
+	expire    time.Duration
+	stopWatch chan struct{}
 }
 
 // NewLock 创建一个新的分布式锁实例，使用默认的前缀格式：<KeyPrefix>.lock.<rawKey>
 func NewLock(key string) *Lock {
 	uid, _ := uuid.NewRandom()
 	o := &Lock{
-		prefix: fmt.Sprintf("%s.lock.", KeyPrefix),
-		rawKey: key,
-		tag:    uid.String(),
+		ctx:        context.Background(),
+		prefix:     fmt.Sprintf("%s.lock.", KeyPrefix),
+		rawKey:     key,
+		tag:        uid.String(),
+		minBackoff: defaultMinBackoff,
+		maxBackoff: defaultMaxBackoff,
+		state:      &lockState{},
 	}
 	return o
 }
@@ -37,45 +143,275 @@ func (l *Lock) EmptyPrefix() *Lock {
 	return l
 }
 
+/**
+ * WithContext 返回使用 ctx 的副本, 与原实例共享持有状态, WaitAndLock 会在 ctx 结束时返回
+ * 看门狗随获取锁时使用的 ctx 结束, Unlock 不受 ctx 取消影响
+ *
+ * Example:
+ *
+ * l := redis.NewLock("order:1").WithContext(reqCtx)
+ * if err := l.WaitAndLock(0); err != nil {
+ * 	return err
+ * }
+ * defer l.Unlock() // reqCtx 已取消时仍会释放
+ */
+func (l *Lock) WithContext(ctx context.Context) *Lock {
+	if ctx == nil {
+		panic("redis: nil context")
+	}
+	r := *l
+	r.ctx = ctx
+	return &r
+}
+
+// WithTimeout 返回设置了单条命令超时时间的副本, timeout <= 0 表示不限制
+func (l *Lock) WithTimeout(timeout time.Duration) *Lock {
+	r := *l
+	r.timeout = timeout
+	return &r
+}
+
+// WithClient 返回使用指定客户端的副本, c 为 nil 时使用 DefaultClient()
+func (l *Lock) WithClient(c Cmdable) *Lock {
+	r := *l
+	r.client = c
+	return &r
+}
+
+// Client 返回使用的客户端
+func (l *Lock) Client() Cmdable {
+	return pick(l.client)
+}
+
+// WithBackoff 设置等待锁时的重试间隔, 从 min 开始指数增长到 max, 每次附加随机抖动
+func (l *Lock) WithBackoff(min, max time.Duration) *Lock {
+	if min <= 0 {
+		min = time.Millisecond
+	}
+	if max < min {
+		max = min
+	}
+	l.minBackoff, l.maxBackoff = min, max
+	return l
+}
+
+// WithWatchdog 启用看门狗, 获取锁后每隔 interval 续期一次直到 Unlock 或 context 结束,
+// interval <= 0 时使用过期时间的 1/3
+func (l *Lock) WithWatchdog(interval time.Duration) *Lock {
+	l.watchdog = true
+	l.interval = interval
+	return l
+}
+
 // FullKey 返回拼接后的完整 Redis key：<prefix>.<rawKey>
 func (l *Lock) FullKey() string {
 	return l.prefix + l.rawKey
 }
 
-// Lock 尝试获取锁，设置过期时间。如果锁已存在，返回 false
+// fenceKey 返回 fencing token 计数器的 key, 使用 hash tag 保证集群模式下与锁位于同一 slot
+// 计数器在最后一次获取锁 fenceTTL(且不短于锁过期时间的 2 倍)后过期, 之后 token 重新从 1 开始
+func (l *Lock) fenceKey() string {
+	return "{" + l.FullKey() + "}.fence"
+}
+
+// Token 返回最近一次获取锁得到的 fencing token, 未获取时为 0
+func (l *Lock) Token() int64 {
+	l.state.mu.Lock()
+	defer l.state.mu.Unlock()
+	return l.state.token
+}
+
+// cmdContext 为单条命令生成 context
+func (l *Lock) cmdContext() (context.Context, context.CancelFunc) {
+	return withTimeout(l.ctx, l.timeout)
+}
+
+// Lock 尝试获取锁，设置过期时间, expire <= 0 表示不过期。如果锁已存在，返回 false
 func (l *Lock) Lock(expire time.Duration) (bool, error) {
-	return GetClient().SetNX(context.Background(), l.FullKey(), l.tag, expire).Result()
+	ctx, cancel := l.cmdContext()
+	defer cancel()
+	fence := max(fenceTTL, 2*expire)
+	token, err := lockScript.Run(ctx, l.Client(), []string{l.FullKey(), l.fenceKey()}, l.tag, expire.Milliseconds(), fence.Milliseconds()).Int64()
+	if err != nil {
+		return false, err
+	}
+	if token == 0 {
+		return false, nil
+	}
+	l.state.mu.Lock()
+	l.state.token, l.state.expire = token, expire
+	l.state.mu.Unlock()
+
+	if l.watchdog {
+		l.startWatchdog()
+	}
+	return true, nil
 }
 
-// WaitAndLock 阻塞等待直到成功获取锁
-func (l *Lock) WaitAndLock(expire time.Duration) (err error) {
-	for {
-		var ok bool
-		ok, err = GetClient().SetNX(context.Background(), l.FullKey(), l.tag, expire).Result()
-		if err != nil {
-			return
-		}
-		if ok {
-			break
-		}
-		time.Sleep(5 * time.Millisecond) // 5毫秒
+/**
+ * Acquire 在 ctx 结束前等待获取锁, 重试间隔指数退避并附加随机抖动, 成功返回 fencing token
+ *
+ * Example:
+ *
+ * ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+ * defer cancel()
+ *
+ * l := redis.NewLock("order:1").WithWatchdog(0)
+ * token, err := l.Acquire(ctx, 10*time.Second)
+ * if err != nil {
+ * 	return err // errors.Is(err, redis.ErrNotObtained)
+ * }
+ * defer l.Unlock()
+ *
+ * // 写入存储时携带 token, 拒绝 token 更小的写入
+ */
+func (l *Lock) Acquire(ctx context.Context, expire time.Duration) (int64, error) {
+	err := acquireLoop(ctx, l.minBackoff, l.maxBackoff, func() (bool, error) {
+		return l.Lock(expire)
+	})
+	if err != nil {
+		return 0, err
 	}
+	return l.Token(), nil
+}
+
+// WaitAndLock 阻塞等待直到成功获取锁或 context 结束
+func (l *Lock) WaitAndLock(expire time.Duration) (err error) {
+	_, err = l.Acquire(l.ctx, expire)
 	return
 }
 
-// Unlock 释放锁，仅当当前锁的 tag 与设置时一致才会删除
-func (l *Lock) Unlock() (err error) {
-	tag, err := GetClient().Get(context.Background(), l.FullKey()).Result()
-	if err == Nil {
-		return nil
+// Extend 重置锁的过期时间, expire <= 0 表示不过期, 锁已不属于当前持有者时返回 ErrNotHeld
+func (l *Lock) Extend(expire time.Duration) error {
+	ctx, cancel := l.cmdContext()
+	defer cancel()
+	n, err := extendScript.Run(ctx, l.Client(), []string{l.FullKey()}, l.tag, expire.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotHeld
+	}
+	l.state.mu.Lock()
+	l.state.expire = expire
+	l.state.mu.Unlock()
+	return nil
+}
+
+// TTL 返回锁剩余的过期时间, 锁已不属于当前持有者时返回 ErrNotHeld
+func (l *Lock) TTL() (time.Duration, error) {
+	ctx, cancel := l.cmdContext()
+	defer cancel()
+	tag, err := l.Client().Get(ctx, l.FullKey()).Result()
+	if err == Nil || (err == nil && tag != l.tag) {
+		return 0, ErrNotHeld
 	}
 	if err != nil {
-		err = fmt.Errorf("get %s error, %s", l.FullKey(), err)
+		return 0, err
+	}
+	return l.Client().PTTL(ctx, l.FullKey()).Result()
+}
+
+// Unlock 释放锁，仅当当前锁的 tag 与设置时一致才会删除, 否则返回 ErrNotHeld。ctx 已取消时仍会执行
+func (l *Lock) Unlock() (err error) {
+	l.stopWatchdog()
+
+	ctx, cancel := releaseContext(l.ctx, l.timeout)
+	defer cancel()
+	n, err := unlockScript.Run(ctx, l.Client(), []string{l.FullKey()}, l.tag).Int64()
+	if err != nil {
+		return fmt.Errorf("unlock %s error, %s", l.FullKey(), err)
+	}
+	if n == 0 {
+		return ErrNotHeld
+	}
+	return nil
+}
+
+// startWatchdog 启动续期协程, 已启动时忽略
+func (l *Lock) startWatchdog() {
+	l.state.mu.Lock()
+	defer l.state.mu.Unlock()
+	if l.state.stopWatch != nil {
 		return
 	}
-	if tag != l.tag {
-		err = fmt.Errorf("there is no lock")
+	interval := l.interval
+	if interval <= 0 {
+		interval = l.state.expire / 3
+	}
+	if interval <= 0 {
 		return
 	}
-	return GetClient().Del(context.Background(), l.FullKey()).Err()
+	stop := make(chan struct{})
+	l.state.stopWatch = stop
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer func() {
+			ticker.Stop()
+			l.state.mu.Lock()
+			if l.state.stopWatch == stop {
+				l.state.stopWatch = nil
+			}
+			l.state.mu.Unlock()
+		}()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-l.ctx.Done():
+				return
+			case <-ticker.C:
+				l.state.mu.Lock()
+				expire := l.state.expire
+				l.state.mu.Unlock()
+				if err := l.Extend(expire); errors.Is(err, ErrNotHeld) {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// stopWatchdog 停止续期协程
+func (l *Lock) stopWatchdog() {
+	l.state.mu.Lock()
+	defer l.state.mu.Unlock()
+	if l.state.stopWatch != nil {
+		close(l.state.stopWatch)
+		l.state.stopWatch = nil
+	}
+}
+
+// acquireLoop 在 ctx 结束前反复调用 try 直到成功, 重试间隔从 min 指数增长到 max 并附加随机抖动
+func acquireLoop(ctx context.Context, min, max time.Duration, try func() (bool, error)) error {
+	backoff := min
+	for {
+		ok, err := try()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		timer := time.NewTimer(jitter(backoff))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w, %w", ErrNotObtained, ctx.Err())
+		case <-timer.C:
+		}
+		if backoff *= 2; backoff > max {
+			backoff = max
+		}
+	}
+}
+
+// jitter 返回 [d/2, d) 之间的随机时长
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)))
 }
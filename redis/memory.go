@@ -0,0 +1,1182 @@
+package redis
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	errWrongType   = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errNotInteger  = errors.New("ERR value is not an integer or out of range")
+	errClosed      = errors.New("redis: client is closed")
+	errUnsupported = errors.New("memory client: unsupported script")
+)
+
+type memoryKind int
+
+const (
+	memoryString memoryKind = iota
+	memoryHash
+	memoryZSet
+	memorySet
+)
+
+type memoryItem struct {
+	kind     memoryKind
+	str      []byte
+	hash     map[string]string
+	zset     map[string]float64
+	set      map[string]struct{}
+	expireAt time.Time // 零值表示不过期
+}
+
+/**
+ * MemoryClient Cmdable 的内存实现, 用于离线单元测试
+ * 支持字符串(含 TTL、SETNX、bitmap)、hash、sorted set、HyperLogLog(以精确集合模拟)、本包自带的 Lua 脚本及 Pub/Sub
+ * 使用模拟时钟, 时间只在调用 SetTime/Advance 时变化, 过期与脚本中的 TIME 均基于模拟时钟
+ *
+ * Example:
+ *
+ * mc := redis.NewMemoryClient()
+ * redis.SetDefaultClient(mc)
+ * defer redis.SetDefaultClient(nil)
+ *
+ * redis.New().SetEX("k", "v", time.Minute)
+ * mc.Advance(time.Minute) // k 过期
+ */
+type MemoryClient struct {
+	mu   sync.Mutex
+	now  time.Time
+	data map[string]*memoryItem
+	subs map[string]map[*MemoryPubSub]struct{}
+}
+
+var _ Cmdable = (*MemoryClient)(nil)
+
+// NewMemoryClient 创建内存客户端, 模拟时钟从当前时间开始
+func NewMemoryClient() *MemoryClient {
+	return &MemoryClient{
+		now:  time.Now(),
+		data: map[string]*memoryItem{},
+		subs: map[string]map[*MemoryPubSub]struct{}{},
+	}
+}
+
+// Now 返回模拟时钟的当前时间
+func (m *MemoryClient) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.now
+}
+
+// SetTime 设置模拟时钟
+func (m *MemoryClient) SetTime(t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = t
+}
+
+// Advance 推进模拟时钟
+func (m *MemoryClient) Advance(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = m.now.Add(d)
+}
+
+// FlushAll 清空全部数据
+func (m *MemoryClient) FlushAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data = map[string]*memoryItem{}
+}
+
+/************ Keys **************/
+
+func (m *MemoryClient) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return redis.NewIntResult(m.del(keys...), nil)
+}
+
+func (m *MemoryClient) Exists(ctx context.Context, keys ...string) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for _, k := range keys {
+		if m.lookup(k) != nil {
+			n++
+		}
+	}
+	return redis.NewIntResult(n, nil)
+}
+
+func (m *MemoryClient) Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return redis.NewBoolResult(m.pexpire(key, expiration), nil)
+}
+
+func (m *MemoryClient) ExpireAt(ctx context.Context, key string, tm time.Time) *redis.BoolCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return redis.NewBoolResult(m.pexpire(key, tm.Sub(m.now)), nil)
+}
+
+func (m *MemoryClient) PTTL(ctx context.Context, key string) *redis.DurationCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ms := m.pttl(key)
+	if ms < 0 {
+		return redis.NewDurationResult(time.Duration(ms), nil)
+	}
+	return redis.NewDurationResult(time.Duration(ms)*time.Millisecond, nil)
+}
+
+func (m *MemoryClient) TTL(ctx context.Context, key string) *redis.DurationCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ms := m.pttl(key)
+	if ms < 0 {
+		return redis.NewDurationResult(time.Duration(ms), nil)
+	}
+	return redis.NewDurationResult(time.Duration((ms+500)/1000)*time.Second, nil)
+}
+
+func (m *MemoryClient) Unlink(ctx context.Context, keys ...string) *redis.IntCmd {
+	return m.Del(ctx, keys...)
+}
+
+// Scan 按 key 排序遍历, cursor 为下一次遍历的起始位置
+func (m *MemoryClient) Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	all := make([]string, 0, len(m.data))
+	for k := range m.data {
+		if m.lookup(k) != nil {
+			all = append(all, k)
+		}
+	}
+	sort.Strings(all)
+	keys, next := memoryScan(all, cursor, match, count)
+	return redis.NewScanCmdResult(keys, next, nil)
+}
+
+// MemoryUsage 返回 key 与值的字节数之和加上固定开销, 仅用于测试
+func (m *MemoryClient) MemoryUsage(ctx context.Context, key string, samples ...int) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it := m.lookup(key)
+	if it == nil {
+		return redis.NewIntResult(0, redis.Nil)
+	}
+	n := int64(len(key) + 48 + len(it.str))
+	for k, v := range it.hash {
+		n += int64(len(k) + len(v))
+	}
+	for k := range it.zset {
+		n += int64(len(k) + 8)
+	}
+	for k := range it.set {
+		n += int64(len(k))
+	}
+	return redis.NewIntResult(n, nil)
+}
+
+/************ Strings **************/
+
+func (m *MemoryClient) Get(ctx context.Context, key string) *redis.StringCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, err := m.lookupKind(key, memoryString)
+	if err != nil {
+		return redis.NewStringResult("", err)
+	}
+	if it == nil {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(string(it.str), nil)
+}
+
+// Set expiration 为 0 表示不过期, redis.KeepTTL 表示保留原过期时间
+func (m *MemoryClient) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	v, err := memoryArg(value)
+	if err != nil {
+		return redis.NewStatusResult("", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keep time.Time
+	if expiration == redis.KeepTTL {
+		if it := m.lookup(key); it != nil {
+			keep = it.expireAt
+		}
+	}
+	it := m.setString(key, v, expiration)
+	if expiration == redis.KeepTTL {
+		it.expireAt = keep
+	}
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (m *MemoryClient) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	v, err := memoryArg(value)
+	if err != nil {
+		return redis.NewBoolResult(false, err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lookup(key) != nil {
+		return redis.NewBoolResult(false, nil)
+	}
+	m.setString(key, v, expiration)
+	return redis.NewBoolResult(true, nil)
+}
+
+func (m *MemoryClient) SetBit(ctx context.Context, key string, offset int64, value int) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return redis.NewIntResult(m.setBit(key, offset, value))
+}
+
+func (m *MemoryClient) GetBit(ctx context.Context, key string, offset int64) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, err := m.lookupKind(key, memoryString)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	return redis.NewIntResult(memoryGetBit(it, offset), nil)
+}
+
+// BitCount 按字节区间统计, 与 redis 一致
+func (m *MemoryClient) BitCount(ctx context.Context, key string, bitCount *redis.BitCount) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, err := m.lookupKind(key, memoryString)
+	if err != nil || it == nil {
+		return redis.NewIntResult(0, err)
+	}
+	b := it.str
+	if bitCount != nil {
+		start, end := memoryRange(bitCount.Start, bitCount.End, int64(len(b)))
+		if start > end {
+			return redis.NewIntResult(0, nil)
+		}
+		b = b[start : end+1]
+	}
+	return redis.NewIntResult(memoryPopCount(b), nil)
+}
+
+/************ Hashes **************/
+
+func (m *MemoryClient) HGet(ctx context.Context, key, field string) *redis.StringCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, err := m.lookupKind(key, memoryHash)
+	if err != nil {
+		return redis.NewStringResult("", err)
+	}
+	if it == nil {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	v, ok := it.hash[field]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(v, nil)
+}
+
+// HSet 支持 "field", "value" 成对参数、[]string、map[string]interface{} 与 map[string]string
+func (m *MemoryClient) HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	pairs, err := memoryPairs(values)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, err := m.create(key, memoryHash)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	var n int64
+	for i := 0; i < len(pairs); i += 2 {
+		if _, ok := it.hash[pairs[i]]; !ok {
+			n++
+		}
+		it.hash[pairs[i]] = pairs[i+1]
+	}
+	return redis.NewIntResult(n, nil)
+}
+
+func (m *MemoryClient) HDel(ctx context.Context, key string, fields ...string) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, err := m.lookupKind(key, memoryHash)
+	if err != nil || it == nil {
+		return redis.NewIntResult(0, err)
+	}
+	var n int64
+	for _, f := range fields {
+		if _, ok := it.hash[f]; ok {
+			delete(it.hash, f)
+			n++
+		}
+	}
+	m.cleanup(key, it)
+	return redis.NewIntResult(n, nil)
+}
+
+func (m *MemoryClient) HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, err := m.lookupKind(key, memoryHash)
+	if err != nil {
+		return redis.NewStringStringMapResult(nil, err)
+	}
+	r := map[string]string{}
+	if it != nil {
+		for k, v := range it.hash {
+			r[k] = v
+		}
+	}
+	return redis.NewStringStringMapResult(r, nil)
+}
+
+func (m *MemoryClient) HMGet(ctx context.Context, key string, fields ...string) *redis.SliceCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, err := m.lookupKind(key, memoryHash)
+	if err != nil {
+		return redis.NewSliceResult(nil, err)
+	}
+	r := make([]interface{}, len(fields))
+	for i, f := range fields {
+		if it == nil {
+			continue
+		}
+		if v, ok := it.hash[f]; ok {
+			r[i] = v
+		}
+	}
+	return redis.NewSliceResult(r, nil)
+}
+
+func (m *MemoryClient) HIncrBy(ctx context.Context, key, field string, incr int64) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return redis.NewIntResult(m.hincrBy(key, field, incr))
+}
+
+func (m *MemoryClient) HIncrByFloat(ctx context.Context, key, field string, incr float64) *redis.FloatCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, err := m.create(key, memoryHash)
+	if err != nil {
+		return redis.NewFloatResult(0, err)
+	}
+	var cur float64
+	if v, ok := it.hash[field]; ok {
+		if cur, err = strconv.ParseFloat(v, 64); err != nil {
+			return redis.NewFloatResult(0, errors.New("ERR hash value is not a float"))
+		}
+	}
+	cur += incr
+	it.hash[field] = strconv.FormatFloat(cur, 'f', -1, 64)
+	return redis.NewFloatResult(cur, nil)
+}
+
+/************ Sets **************/
+
+func (m *MemoryClient) SAdd(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, err := m.create(key, memorySet)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	var n int64
+	for _, v := range members {
+		s, err := memoryArg(v)
+		if err != nil {
+			return redis.NewIntResult(0, err)
+		}
+		if _, ok := it.set[s]; !ok {
+			it.set[s] = struct{}{}
+			n++
+		}
+	}
+	return redis.NewIntResult(n, nil)
+}
+
+func (m *MemoryClient) SRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, err := m.lookupKind(key, memorySet)
+	if err != nil || it == nil {
+		return redis.NewIntResult(0, err)
+	}
+	var n int64
+	for _, v := range members {
+		s, err := memoryArg(v)
+		if err != nil {
+			return redis.NewIntResult(0, err)
+		}
+		if _, ok := it.set[s]; ok {
+			delete(it.set, s)
+			n++
+		}
+	}
+	m.cleanup(key, it)
+	return redis.NewIntResult(n, nil)
+}
+
+func (m *MemoryClient) SMembers(ctx context.Context, key string) *redis.StringSliceCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, err := m.lookupKind(key, memorySet)
+	if err != nil {
+		return redis.NewStringSliceResult(nil, err)
+	}
+	return redis.NewStringSliceResult(memorySetMembers(it), nil)
+}
+
+func (m *MemoryClient) SCard(ctx context.Context, key string) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, err := m.lookupKind(key, memorySet)
+	if err != nil || it == nil {
+		return redis.NewIntResult(0, err)
+	}
+	return redis.NewIntResult(int64(len(it.set)), nil)
+}
+
+func (m *MemoryClient) SUnion(ctx context.Context, keys ...string) *redis.StringSliceCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	union, err := m.union(keys...)
+	if err != nil {
+		return redis.NewStringSliceResult(nil, err)
+	}
+	members := make([]string, 0, len(union))
+	for k := range union {
+		members = append(members, k)
+	}
+	return redis.NewStringSliceResult(members, nil)
+}
+
+// SScan 按成员排序遍历, cursor 为下一次遍历的起始位置
+func (m *MemoryClient) SScan(ctx context.Context, key string, cursor uint64, match string, count int64) *redis.ScanCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, err := m.lookupKind(key, memorySet)
+	if err != nil {
+		return redis.NewScanCmdResult(nil, 0, err)
+	}
+	keys, next := memoryScan(memorySetMembers(it), cursor, match, count)
+	return redis.NewScanCmdResult(keys, next, nil)
+}
+
+/************ Sorted sets **************/
+
+func (m *MemoryClient) ZRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, err := m.lookupKind(key, memoryZSet)
+	if err != nil || it == nil {
+		return redis.NewIntResult(0, err)
+	}
+	var n int64
+	for _, v := range members {
+		member, err := memoryArg(v)
+		if err != nil {
+			return redis.NewIntResult(0, err)
+		}
+		if _, ok := it.zset[member]; ok {
+			delete(it.zset, member)
+			n++
+		}
+	}
+	m.cleanup(key, it)
+	return redis.NewIntResult(n, nil)
+}
+
+func (m *MemoryClient) ZScore(ctx context.Context, key, member string) *redis.FloatCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, err := m.lookupKind(key, memoryZSet)
+	if err != nil {
+		return redis.NewFloatResult(0, err)
+	}
+	if it == nil {
+		return redis.NewFloatResult(0, redis.Nil)
+	}
+	score, ok := it.zset[member]
+	if !ok {
+		return redis.NewFloatResult(0, redis.Nil)
+	}
+	return redis.NewFloatResult(score, nil)
+}
+
+func (m *MemoryClient) ZRevRank(ctx context.Context, key, member string) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, err := m.lookupKind(key, memoryZSet)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	for i, z := range memoryZSorted(it, true) {
+		if z.Member == member {
+			return redis.NewIntResult(int64(i), nil)
+		}
+	}
+	return redis.NewIntResult(0, redis.Nil)
+}
+
+func (m *MemoryClient) ZRevRangeWithScores(ctx context.Context, key string, start, stop int64) *redis.ZSliceCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, err := m.lookupKind(key, memoryZSet)
+	if err != nil {
+		return redis.NewZSliceCmdResult(nil, err)
+	}
+	zs := memoryZSorted(it, true)
+	start, stop = memoryRange(start, stop, int64(len(zs)))
+	if start > stop {
+		return redis.NewZSliceCmdResult([]redis.Z{}, nil)
+	}
+	return redis.NewZSliceCmdResult(zs[start:stop+1], nil)
+}
+
+func (m *MemoryClient) ZCard(ctx context.Context, key string) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, err := m.lookupKind(key, memoryZSet)
+	if err != nil || it == nil {
+		return redis.NewIntResult(0, err)
+	}
+	return redis.NewIntResult(int64(len(it.zset)), nil)
+}
+
+/************ HyperLogLog **************/
+
+func (m *MemoryClient) PFAdd(ctx context.Context, key string, els ...interface{}) *redis.IntCmd {
+	members := make([]string, 0, len(els))
+	for _, v := range els {
+		s, err := memoryArg(v)
+		if err != nil {
+			return redis.NewIntResult(0, err)
+		}
+		members = append(members, s)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return redis.NewIntResult(m.pfAdd(key, members))
+}
+
+func (m *MemoryClient) PFCount(ctx context.Context, keys ...string) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	union, err := m.union(keys...)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	return redis.NewIntResult(int64(len(union)), nil)
+}
+
+func (m *MemoryClient) PFMerge(ctx context.Context, dest string, keys ...string) *redis.StatusCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.pfMerge(dest, keys); err != nil {
+		return redis.NewStatusResult("", err)
+	}
+	return redis.NewStatusResult("OK", nil)
+}
+
+/************ Pub/Sub **************/
+
+func (m *MemoryClient) Publish(ctx context.Context, channel string, message interface{}) *redis.IntCmd {
+	payload, err := memoryArg(message)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for ps := range m.subs[channel] {
+		ps.deliver(&redis.Message{Channel: channel, Payload: payload})
+		n++
+	}
+	return redis.NewIntResult(n, nil)
+}
+
+// SubscribeConn 订阅频道, 实现 Subscriber
+func (m *MemoryClient) SubscribeConn(ctx context.Context, channels ...string) PubSubConn {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ps := &MemoryPubSub{
+		client:   m,
+		channels: channels,
+		notify:   make(chan struct{}, 1),
+		closed:   make(chan struct{}),
+	}
+	for _, ch := range channels {
+		if m.subs[ch] == nil {
+			m.subs[ch] = map[*MemoryPubSub]struct{}{}
+		}
+		m.subs[ch][ps] = struct{}{}
+	}
+	return ps
+}
+
+// MemoryPubSub MemoryClient 的订阅连接
+type MemoryPubSub struct {
+	client    *MemoryClient
+	channels  []string
+	mu        sync.Mutex
+	confirmed bool
+	queue     []*redis.Message
+	notify    chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Receive 首次调用返回订阅确认, 之后返回消息
+func (ps *MemoryPubSub) Receive(ctx context.Context) (interface{}, error) {
+	ps.mu.Lock()
+	if !ps.confirmed {
+		ps.confirmed = true
+		ps.mu.Unlock()
+		return &redis.Subscription{Kind: "subscribe", Channel: ps.channels[0], Count: len(ps.channels)}, nil
+	}
+	ps.mu.Unlock()
+	return ps.ReceiveMessage(ctx)
+}
+
+// ReceiveMessage 阻塞直到收到消息、ctx 结束或连接关闭
+func (ps *MemoryPubSub) ReceiveMessage(ctx context.Context) (*redis.Message, error) {
+	for {
+		ps.mu.Lock()
+		if len(ps.queue) > 0 {
+			msg := ps.queue[0]
+			ps.queue = ps.queue[1:]
+			ps.mu.Unlock()
+			return msg, nil
+		}
+		ps.mu.Unlock()
+
+		select {
+		case <-ps.closed:
+			return nil, errClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ps.notify:
+		}
+	}
+}
+
+// Close 退订
+func (ps *MemoryPubSub) Close() error {
+	ps.closeOnce.Do(func() {
+		ps.client.mu.Lock()
+		for _, ch := range ps.channels {
+			delete(ps.client.subs[ch], ps)
+		}
+		ps.client.mu.Unlock()
+		close(ps.closed)
+	})
+	return nil
+}
+
+func (ps *MemoryPubSub) deliver(msg *redis.Message) {
+	ps.mu.Lock()
+	ps.queue = append(ps.queue, msg)
+	ps.mu.Unlock()
+	select {
+	case ps.notify <- struct{}{}:
+	default:
+	}
+}
+
+/************ Scripting **************/
+
+func (m *MemoryClient) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	h := sha1.Sum([]byte(script))
+	return m.EvalSha(ctx, hex.EncodeToString(h[:]), keys, args...)
+}
+
+// EvalSha 执行本包脚本对应的 Go 实现, 未知脚本返回错误, 返回 nil 时与脚本返回 false 一致得到 redis.Nil
+func (m *MemoryClient) EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) *redis.Cmd {
+	fn, ok := memoryScripts()[sha1]
+	if !ok {
+		return redis.NewCmdResult(nil, errUnsupported)
+	}
+	strArgs := make([]string, 0, len(args))
+	for _, a := range args {
+		s, err := memoryArg(a)
+		if err != nil {
+			return redis.NewCmdResult(nil, err)
+		}
+		strArgs = append(strArgs, s)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, err := fn(m, keys, strArgs)
+	if v == nil && err == nil {
+		err = Nil
+	}
+	return redis.NewCmdResult(v, err)
+}
+
+func (m *MemoryClient) ScriptExists(ctx context.Context, hashes ...string) *redis.BoolSliceCmd {
+	scripts := memoryScripts()
+	r := make([]bool, 0, len(hashes))
+	for _, h := range hashes {
+		_, ok := scripts[h]
+		r = append(r, ok)
+	}
+	return redis.NewBoolSliceResult(r, nil)
+}
+
+func (m *MemoryClient) ScriptLoad(ctx context.Context, script string) *redis.StringCmd {
+	h := sha1.Sum([]byte(script))
+	sha := hex.EncodeToString(h[:])
+	if _, ok := memoryScripts()[sha]; !ok {
+		return redis.NewStringResult("", errUnsupported)
+	}
+	return redis.NewStringResult(sha, nil)
+}
+
+/************ internal, 调用方需持有锁 **************/
+
+// lookup 返回未过期的 key, 过期时删除
+func (m *MemoryClient) lookup(key string) *memoryItem {
+	it, ok := m.data[key]
+	if !ok {
+		return nil
+	}
+	if !it.expireAt.IsZero() && !m.now.Before(it.expireAt) {
+		delete(m.data, key)
+		return nil
+	}
+	return it
+}
+
+// lookupKind 返回指定类型的 key, 类型不一致时返回 WRONGTYPE
+func (m *MemoryClient) lookupKind(key string, kind memoryKind) (*memoryItem, error) {
+	it := m.lookup(key)
+	if it == nil {
+		return nil, nil
+	}
+	if it.kind != kind {
+		return nil, errWrongType
+	}
+	return it, nil
+}
+
+// create 返回指定类型的 key, 不存在时创建
+func (m *MemoryClient) create(key string, kind memoryKind) (*memoryItem, error) {
+	it, err := m.lookupKind(key, kind)
+	if err != nil || it != nil {
+		return it, err
+	}
+	it = &memoryItem{kind: kind}
+	switch kind {
+	case memoryHash:
+		it.hash = map[string]string{}
+	case memoryZSet:
+		it.zset = map[string]float64{}
+	case memorySet:
+		it.set = map[string]struct{}{}
+	}
+	m.data[key] = it
+	return it, nil
+}
+
+// cleanup 删除空的集合类型 key
+func (m *MemoryClient) cleanup(key string, it *memoryItem) {
+	if len(it.hash) == 0 && len(it.zset) == 0 && len(it.set) == 0 && it.kind != memoryString {
+		delete(m.data, key)
+	}
+}
+
+func (m *MemoryClient) setString(key, value string, expiration time.Duration) *memoryItem {
+	it := &memoryItem{kind: memoryString, str: []byte(value)}
+	if expiration > 0 {
+		it.expireAt = m.now.Add(expiration)
+	}
+	m.data[key] = it
+	return it
+}
+
+func (m *MemoryClient) del(keys ...string) int64 {
+	var n int64
+	for _, k := range keys {
+		if m.lookup(k) != nil {
+			delete(m.data, k)
+			n++
+		}
+	}
+	return n
+}
+
+// pexpire 设置过期时间, d <= 0 时立即删除
+func (m *MemoryClient) pexpire(key string, d time.Duration) bool {
+	it := m.lookup(key)
+	if it == nil {
+		return false
+	}
+	if d <= 0 {
+		delete(m.data, key)
+		return true
+	}
+	it.expireAt = m.now.Add(d)
+	return true
+}
+
+// pttl 返回剩余毫秒数, key 不存在返回 -2, 未设置过期返回 -1
+func (m *MemoryClient) pttl(key string) int64 {
+	it := m.lookup(key)
+	if it == nil {
+		return -2
+	}
+	if it.expireAt.IsZero() {
+		return -1
+	}
+	return it.expireAt.Sub(m.now).Milliseconds()
+}
+
+// nowMs 返回模拟时钟的毫秒时间戳, 对应脚本中的 TIME
+func (m *MemoryClient) nowMs() int64 {
+	return m.now.UnixMilli()
+}
+
+func (m *MemoryClient) setBit(key string, offset int64, value int) (int64, error) {
+	it, err := m.lookupKind(key, memoryString)
+	if err != nil {
+		return 0, err
+	}
+	if it == nil {
+		it = m.setString(key, "", 0)
+	}
+	idx := int(offset / 8)
+	for len(it.str) <= idx {
+		it.str = append(it.str, 0)
+	}
+	mask := byte(1 << uint(7-offset%8))
+	old := int64(0)
+	if it.str[idx]&mask != 0 {
+		old = 1
+	}
+	if value != 0 {
+		it.str[idx] |= mask
+	} else {
+		it.str[idx] &^= mask
+	}
+	return old, nil
+}
+
+// pfAdd 以 set 模拟 HyperLogLog
+func (m *MemoryClient) pfAdd(key string, members []string) (int64, error) {
+	existed := m.lookup(key) != nil
+	it, err := m.create(key, memorySet)
+	if err != nil {
+		return 0, err
+	}
+	changed := !existed
+	for _, s := range members {
+		if _, ok := it.set[s]; !ok {
+			it.set[s] = struct{}{}
+			changed = true
+		}
+	}
+	if changed {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (m *MemoryClient) pfMerge(dest string, keys []string) error {
+	union, err := m.union(append([]string{dest}, keys...)...)
+	if err != nil {
+		return err
+	}
+	it, err := m.create(dest, memorySet)
+	if err != nil {
+		return err
+	}
+	it.set = union
+	return nil
+}
+
+func (m *MemoryClient) union(keys ...string) (map[string]struct{}, error) {
+	r := map[string]struct{}{}
+	for _, k := range keys {
+		it, err := m.lookupKind(k, memorySet)
+		if err != nil {
+			return nil, err
+		}
+		if it == nil {
+			continue
+		}
+		for s := range it.set {
+			r[s] = struct{}{}
+		}
+	}
+	return r, nil
+}
+
+// memoryZSorted 按 score、member 排序, rev 为 true 时倒序
+func memoryZSorted(it *memoryItem, rev bool) []redis.Z {
+	if it == nil {
+		return nil
+	}
+	zs := make([]redis.Z, 0, len(it.zset))
+	for member, score := range it.zset {
+		zs = append(zs, redis.Z{Score: score, Member: member})
+	}
+	sort.Slice(zs, func(i, j int) bool {
+		a, b := zs[i], zs[j]
+		if rev {
+			a, b = b, a
+		}
+		if a.Score != b.Score {
+			return a.Score < b.Score
+		}
+		return a.Member.(string) < b.Member.(string)
+	})
+	return zs
+}
+
+// memoryRange 将 redis 风格的下标(支持负数)转换为 [start, stop], start > stop 表示为空
+func memoryRange(start, stop, n int64) (int64, int64) {
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	return start, stop
+}
+
+func memoryGetBit(it *memoryItem, offset int64) int64 {
+	if it == nil || offset < 0 || int(offset/8) >= len(it.str) {
+		return 0
+	}
+	if it.str[offset/8]&byte(1<<uint(7-offset%8)) != 0 {
+		return 1
+	}
+	return 0
+}
+
+func memoryPopCount(b []byte) int64 {
+	var n int64
+	for _, c := range b {
+		n += int64(bits.OnesCount8(c))
+	}
+	return n
+}
+
+// memoryArg 按 go-redis 的规则将参数转为字符串
+func memoryArg(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int8:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 64), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case time.Duration:
+		return strconv.FormatInt(v.Nanoseconds(), 10), nil
+	case encoding.BinaryMarshaler:
+		b, err := v.MarshalBinary()
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	default:
+		return "", fmt.Errorf("redis: can't marshal %T (implement encoding.BinaryMarshaler)", v)
+	}
+}
+
+// memoryScan 从 cursor 开始遍历 count 个元素, 返回匹配的元素及下一次的 cursor
+func memoryScan(all []string, cursor uint64, match string, count int64) ([]string, uint64) {
+	if count <= 0 {
+		count = 10
+	}
+	var r []string
+	i := int(cursor)
+	for ; i < len(all) && int64(i) < int64(cursor)+count; i++ {
+		if len(match) == 0 || memoryMatch(match, all[i]) {
+			r = append(r, all[i])
+		}
+	}
+	if i >= len(all) {
+		i = 0
+	}
+	return r, uint64(i)
+}
+
+func memorySetMembers(it *memoryItem) []string {
+	if it == nil {
+		return []string{}
+	}
+	r := make([]string, 0, len(it.set))
+	for s := range it.set {
+		r = append(r, s)
+	}
+	sort.Strings(r)
+	return r
+}
+
+// memoryMatch 按 redis 的 glob 规则匹配, 支持 *、?、[...] 与 \ 转义
+func memoryMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if memoryMatch(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				return false
+			}
+			class := pattern[1 : end+1]
+			not := len(class) > 0 && class[0] == '^'
+			if not {
+				class = class[1:]
+			}
+			matched := false
+			for i := 0; i < len(class); i++ {
+				if i+2 < len(class) && class[i+1] == '-' {
+					if class[i] <= s[0] && s[0] <= class[i+2] {
+						matched = true
+					}
+					i += 2
+				} else if class[i] == s[0] {
+					matched = true
+				}
+			}
+			if matched == not {
+				return false
+			}
+			pattern = pattern[end+1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
+
+// memoryPairs 展开 HSET 的参数
+func memoryPairs(values []interface{}) ([]string, error) {
+	var r []string
+	if len(values) == 1 {
+		switch v := values[0].(type) {
+		case []string:
+			r = v
+		case []interface{}:
+			values = v
+		case map[string]interface{}:
+			for k, val := range v {
+				s, err := memoryArg(val)
+				if err != nil {
+					return nil, err
+				}
+				r = append(r, k, s)
+			}
+			return r, nil
+		case map[string]string:
+			for k, val := range v {
+				r = append(r, k, val)
+			}
+			return r, nil
+		}
+	}
+	if r == nil {
+		for _, v := range values {
+			s, err := memoryArg(v)
+			if err != nil {
+				return nil, err
+			}
+			r = append(r, s)
+		}
+	}
+	if len(r) == 0 || len(r)%2 != 0 {
+		return nil, errors.New("ERR wrong number of arguments for 'hset' command")
+	}
+	return r, nil
+}
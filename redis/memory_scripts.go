@@ -0,0 +1,123 @@
+package redis
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// memoryScript 脚本的 Go 实现, 调用时已持有 MemoryClient 的锁
+type memoryScript func(m *MemoryClient, keys []string, args []string) (interface{}, error)
+
+// memoryScriptsMap 本包脚本 SHA1 到 Go 实现的映射, 由 newScript 登记
+var memoryScriptsMap = map[string]memoryScript{}
+
+// newScript 创建脚本并登记 MemoryClient 使用的 Go 实现
+// Go 实现紧跟在脚本之后, 修改脚本时需同步修改, 并由 scripts_test.go 在真实 Redis 上校验
+func newScript(src string, mem memoryScript) *redis.Script {
+	s := redis.NewScript(src)
+	memoryScriptsMap[s.Hash()] = mem
+	return s
+}
+
+// memoryScripts 返回本包脚本 SHA1 到 Go 实现的映射
+func memoryScripts() map[string]memoryScript {
+	return memoryScriptsMap
+}
+
+/************ helpers **************/
+
+func (m *MemoryClient) getString(key string) (string, bool, error) {
+	it, err := m.lookupKind(key, memoryString)
+	if err != nil || it == nil {
+		return "", false, err
+	}
+	return string(it.str), true, nil
+}
+
+func (m *MemoryClient) incrBy(key string, n int64) (int64, error) {
+	it, err := m.lookupKind(key, memoryString)
+	if err != nil {
+		return 0, err
+	}
+	if it == nil {
+		it = m.setString(key, "0", 0)
+	}
+	cur, err := strconv.ParseInt(string(it.str), 10, 64)
+	if err != nil {
+		return 0, errNotInteger
+	}
+	cur += n
+	it.str = []byte(strconv.FormatInt(cur, 10))
+	return cur, nil
+}
+
+func (m *MemoryClient) hexists(key, field string) bool {
+	it, _ := m.lookupKind(key, memoryHash)
+	if it == nil {
+		return false
+	}
+	_, ok := it.hash[field]
+	return ok
+}
+
+func (m *MemoryClient) hincrBy(key, field string, n int64) (int64, error) {
+	it, err := m.create(key, memoryHash)
+	if err != nil {
+		return 0, err
+	}
+	var cur int64
+	if v, ok := it.hash[field]; ok {
+		if cur, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return 0, errors.New("ERR hash value is not an integer")
+		}
+	}
+	cur += n
+	it.hash[field] = strconv.FormatInt(cur, 10)
+	return cur, nil
+}
+
+// memZRemRangeByScore 删除 score 位于 [min, max] 的成员
+func memZRemRangeByScore(it *memoryItem, min, max float64) {
+	for member, score := range it.zset {
+		if score >= min && score <= max {
+			delete(it.zset, member)
+		}
+	}
+}
+
+// memZExpireAt 返回 score 为毫秒级过期时间的 sorted set 应有的过期时间, 即最大的 score, 存在 +inf 时返回零值表示不过期
+func memZExpireAt(it *memoryItem) time.Time {
+	var at float64
+	for _, score := range it.zset {
+		if math.IsInf(score, 1) {
+			return time.Time{}
+		}
+		at = math.Max(at, score)
+	}
+	return time.UnixMilli(int64(at))
+}
+
+func memInt(s string) int64 {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
+
+func memFloat(s string) float64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
+
+func memMs(s string) time.Duration {
+	return time.Duration(memInt(s)) * time.Millisecond
+}
+
+func memBool(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
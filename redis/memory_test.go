@@ -0,0 +1,69 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/scrawld/zaplog"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	zaplog.Logger = zap.NewNop()
+	m.Run()
+}
+
+func newTestClient(t *testing.T) *MemoryClient {
+	mc := NewMemoryClient()
+	mc.SetTime(time.Date(2024, 3, 6, 10, 0, 0, 0, time.Local))
+	SetDefaultClient(mc)
+	t.Cleanup(func() { SetDefaultClient(nil) })
+	return mc
+}
+
+func TestMemoryCache(t *testing.T) {
+	mc := newTestClient(t)
+	c := New()
+
+	require.NoError(t, c.SetEX("a", 1, time.Minute))
+	v, err := c.GetInt64("a")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), v)
+
+	mc.Advance(time.Minute)
+	_, err = c.Get("a")
+	require.Equal(t, Nil, err)
+
+	require.NoError(t, c.HSet("h", "f", "v"))
+	s, err := c.HGet("h", "f")
+	require.NoError(t, err)
+	require.Equal(t, "v", s)
+	_, err = c.Get("h")
+	require.ErrorContains(t, err, "WRONGTYPE")
+
+	require.NoError(t, c.Del("h"))
+	n, err := c.Exists("h")
+	require.NoError(t, err)
+	require.Equal(t, int64(0), n)
+}
+
+func TestMemoryEventBus(t *testing.T) {
+	newTestClient(t)
+	topic := NewTopic[string]("test")
+	bus := NewEventBus()
+	defer bus.Close()
+
+	received := make(chan string, 1)
+	Subscribe(bus, topic, func(ctx context.Context, e string) error {
+		received <- e
+		return nil
+	})
+
+	require.Eventually(t, func() bool {
+		n, err := topic.Publish(context.Background(), "hello")
+		return err == nil && n == 1
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, "hello", <-received)
+}
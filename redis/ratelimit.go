@@ -0,0 +1,342 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// RateLimitAlgorithm 限流算法
+type RateLimitAlgorithm int
+
+const (
+	FixedWindow      RateLimitAlgorithm = iota // 固定窗口计数
+	SlidingWindowLog                           // 滑动窗口日志, 记录窗口内每次请求的时间
+	TokenBucket                                // 令牌桶, 每个窗口匀速补充 limit 个令牌, 允许突发 limit 次
+)
+
+// 限流脚本统一返回 {allowed, remaining, retry_after_ms, reset_after_ms}
+var (
+	// fixedWindowScript ARGV: cost, limit, window_ms
+	fixedWindowScript = newScript(`
+local cost = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local window = tonumber(ARGV[3])
+local cur = tonumber(redis.call("GET", KEYS[1]) or "0")
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl < 0 then
+	ttl = window
+end
+if cur + cost > limit then
+	return {0, math.max(limit - cur, 0), ttl, ttl}
+end
+cur = redis.call("INCRBY", KEYS[1], cost)
+if redis.call("PTTL", KEYS[1]) < 0 then
+	redis.call("PEXPIRE", KEYS[1], window)
+	ttl = window
+end
+return {1, limit - cur, 0, ttl}`, memFixedWindow)
+
+	// slidingWindowLogScript ARGV: cost, limit, window_ms, member
+	slidingWindowLogScript = newScript(`
+local cost = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local window = tonumber(ARGV[3])
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+local count = redis.call("ZCARD", KEYS[1])
+if count + cost > limit then
+	local retry = window
+	local idx = count + cost - limit - 1
+	if cost <= limit then
+		local e = redis.call("ZRANGE", KEYS[1], idx, idx, "WITHSCORES")
+		if e[2] then
+			retry = tonumber(e[2]) + window - now
+		end
+	end
+	local reset = window
+	local last = redis.call("ZRANGE", KEYS[1], -1, -1, "WITHSCORES")
+	if last[2] then
+		reset = tonumber(last[2]) + window - now
+	end
+	return {0, math.max(limit - count, 0), retry, reset}
+end
+for i = 1, cost do
+	redis.call("ZADD", KEYS[1], now, ARGV[4] .. ":" .. i)
+end
+redis.call("PEXPIRE", KEYS[1], window)
+return {1, limit - count - cost, 0, window}`, memSlidingWindowLog)
+
+	// tokenBucketScript ARGV: cost, limit, window_ms
+	tokenBucketScript = newScript(`
+local cost = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local window = tonumber(ARGV[3])
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local data = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(data[1]) or limit
+local ts = tonumber(data[2]) or now
+if now > ts then
+	tokens = math.min(limit, tokens + (now - ts) * limit / window)
+end
+local allowed = 0
+local retry = 0
+if tokens >= cost then
+	tokens = tokens - cost
+	allowed = 1
+elseif cost > limit then
+	retry = window
+else
+	retry = math.ceil((cost - tokens) * window / limit)
+end
+local reset = math.ceil((limit - tokens) * window / limit)
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.max(reset, 1))
+return {allowed, math.floor(tokens), retry, reset}`, memTokenBucket)
+)
+
+func memFixedWindow(m *MemoryClient, keys, args []string) (interface{}, error) {
+	cost, limit, window := memInt(args[0]), memInt(args[1]), memInt(args[2])
+	v, _, err := m.getString(keys[0])
+	if err != nil {
+		return nil, err
+	}
+	cur, _ := strconv.ParseInt(v, 10, 64)
+	ttl := m.pttl(keys[0])
+	if ttl < 0 {
+		ttl = window
+	}
+	if cur+cost > limit {
+		return []interface{}{int64(0), max(limit-cur, 0), ttl, ttl}, nil
+	}
+	if cur, err = m.incrBy(keys[0], cost); err != nil {
+		return nil, err
+	}
+	if m.pttl(keys[0]) < 0 {
+		m.pexpire(keys[0], time.Duration(window)*time.Millisecond)
+		ttl = window
+	}
+	return []interface{}{int64(1), limit - cur, int64(0), ttl}, nil
+}
+
+func memSlidingWindowLog(m *MemoryClient, keys, args []string) (interface{}, error) {
+	cost, limit, window := memInt(args[0]), memInt(args[1]), memInt(args[2])
+	now := m.nowMs()
+	it, err := m.create(keys[0], memoryZSet)
+	if err != nil {
+		return nil, err
+	}
+	memZRemRangeByScore(it, math.Inf(-1), float64(now-window))
+	count := int64(len(it.zset))
+	if count+cost > limit {
+		zs := memoryZSorted(it, false)
+		retry := window
+		if idx := count + cost - limit - 1; cost <= limit && idx < int64(len(zs)) {
+			retry = int64(zs[idx].Score) + window - now
+		}
+		reset := window
+		if len(zs) > 0 {
+			reset = int64(zs[len(zs)-1].Score) + window - now
+		}
+		m.cleanup(keys[0], it)
+		return []interface{}{int64(0), max(limit-count, 0), retry, reset}, nil
+	}
+	for i := int64(1); i <= cost; i++ {
+		it.zset[args[3]+":"+strconv.FormatInt(i, 10)] = float64(now)
+	}
+	m.cleanup(keys[0], it)
+	m.pexpire(keys[0], time.Duration(window)*time.Millisecond)
+	return []interface{}{int64(1), limit - count - cost, int64(0), window}, nil
+}
+
+func memTokenBucket(m *MemoryClient, keys, args []string) (interface{}, error) {
+	cost, limit, window := memFloat(args[0]), memFloat(args[1]), memFloat(args[2])
+	now := float64(m.nowMs())
+	it, err := m.create(keys[0], memoryHash)
+	if err != nil {
+		return nil, err
+	}
+	tokens, ts := limit, now
+	if v, ok := it.hash["tokens"]; ok {
+		tokens = memFloat(v)
+	}
+	if v, ok := it.hash["ts"]; ok {
+		ts = memFloat(v)
+	}
+	if now > ts {
+		tokens = math.Min(limit, tokens+(now-ts)*limit/window)
+	}
+	allowed, retry := int64(0), float64(0)
+	if tokens >= cost {
+		tokens -= cost
+		allowed = 1
+	} else if cost > limit {
+		retry = window
+	} else {
+		retry = math.Ceil((cost - tokens) * window / limit)
+	}
+	reset := math.Ceil((limit - tokens) * window / limit)
+	it.hash["tokens"] = strconv.FormatFloat(tokens, 'g', 14, 64)
+	it.hash["ts"] = strconv.FormatFloat(now, 'f', -1, 64)
+	m.pexpire(keys[0], time.Duration(math.Max(reset, 1))*time.Millisecond)
+	return []interface{}{allowed, int64(math.Floor(tokens)), int64(retry), int64(reset)}, nil
+}
+
+// RateLimitResult 限流结果
+type RateLimitResult struct {
+	Allowed    bool          // 是否允许本次请求
+	Limit      int64         // 窗口内最大请求数
+	Remaining  int64         // 剩余可用次数
+	RetryAfter time.Duration // 被拒绝时距离下次可以请求的时间
+	ResetAfter time.Duration // 距离额度完全恢复的时间
+}
+
+// RateLimiter 基于 Lua 脚本的原子限流器
+type RateLimiter struct {
+	ctx       context.Context
+	timeout   time.Duration
+	client    Cmdable
+	prefix    string
+	algorithm RateLimitAlgorithm
+	limit     int64
+	window    time.Duration
+}
+
+/**
+ * NewRateLimiter 创建限流器, 每个 window 内最多允许 limit 次请求, 使用默认的前缀格式：<KeyPrefix>.ratelimit.<key>
+ *
+ * Example:
+ *
+ * limiter := redis.NewRateLimiter(redis.SlidingWindowLog, 100, time.Minute)
+ * res, err := limiter.Allow("user:42")
+ * if err != nil {
+ * 	return err
+ * }
+ * if !res.Allowed {
+ * 	// res.RetryAfter 后重试
+ * }
+ */
+func NewRateLimiter(algorithm RateLimitAlgorithm, limit int64, window time.Duration) *RateLimiter {
+	if limit <= 0 {
+		limit = 1
+	}
+	if window < time.Millisecond {
+		window = time.Millisecond
+	}
+	return &RateLimiter{
+		ctx:       context.Background(),
+		prefix:    fmt.Sprintf("%s.ratelimit.", KeyPrefix),
+		algorithm: algorithm,
+		limit:     limit,
+		window:    window,
+	}
+}
+
+// SetPrefix 设置前缀
+func (r *RateLimiter) SetPrefix(prefix string) *RateLimiter {
+	r.prefix = prefix
+	return r
+}
+
+// EmptyPrefix 清空前缀
+func (r *RateLimiter) EmptyPrefix() *RateLimiter {
+	r.prefix = ""
+	return r
+}
+
+// WithContext 返回使用 ctx 的副本
+func (r *RateLimiter) WithContext(ctx context.Context) *RateLimiter {
+	if ctx == nil {
+		panic("redis: nil context")
+	}
+	c := *r
+	c.ctx = ctx
+	return &c
+}
+
+// WithTimeout 返回设置单条命令超时时间的副本, timeout <= 0 表示不限制
+func (r *RateLimiter) WithTimeout(timeout time.Duration) *RateLimiter {
+	c := *r
+	c.timeout = timeout
+	return &c
+}
+
+// WithClient 返回使用指定客户端的副本, client 为 nil 时使用 DefaultClient()
+func (r *RateLimiter) WithClient(client Cmdable) *RateLimiter {
+	c := *r
+	c.client = client
+	return &c
+}
+
+// Client 返回使用的客户端
+func (r *RateLimiter) Client() Cmdable {
+	return pick(r.client)
+}
+
+// Limit 返回窗口内最大请求数
+func (r *RateLimiter) Limit() int64 {
+	return r.limit
+}
+
+// Window 返回窗口时长
+func (r *RateLimiter) Window() time.Duration {
+	return r.window
+}
+
+// Allow 消耗一次额度
+func (r *RateLimiter) Allow(key string) (*RateLimitResult, error) {
+	return r.AllowN(key, 1)
+}
+
+// AllowN 消耗 n 次额度, 额度不足时不消耗
+func (r *RateLimiter) AllowN(key string, n int64) (*RateLimitResult, error) {
+	if n <= 0 {
+		n = 1
+	}
+	var (
+		script *redis.Script
+		args   = []interface{}{n, r.limit, r.window.Milliseconds()}
+	)
+	switch r.algorithm {
+	case FixedWindow:
+		script = fixedWindowScript
+	case SlidingWindowLog:
+		uid, _ := uuid.NewRandom()
+		script, args = slidingWindowLogScript, append(args, uid.String())
+	case TokenBucket:
+		script = tokenBucketScript
+	default:
+		return nil, fmt.Errorf("unknown rate limit algorithm: %d", r.algorithm)
+	}
+
+	ctx, cancel := withTimeout(r.ctx, r.timeout)
+	defer cancel()
+	vals, err := script.Run(ctx, r.Client(), []string{r.prefix + key}, args...).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) != 4 {
+		return nil, fmt.Errorf("unexpected rate limit result: %v", vals)
+	}
+	return &RateLimitResult{
+		Allowed:    vals[0] == 1,
+		Limit:      r.limit,
+		Remaining:  vals[1],
+		RetryAfter: time.Duration(vals[2]) * time.Millisecond,
+		ResetAfter: time.Duration(vals[3]) * time.Millisecond,
+	}, nil
+}
+
+// Reset 清除 key 的限流状态
+func (r *RateLimiter) Reset(key string) error {
+	ctx, cancel := withTimeout(r.ctx, r.timeout)
+	defer cancel()
+	return r.Client().Del(ctx, r.prefix+key).Err()
+}
@@ -3,49 +3,273 @@ package redis
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/scrawld/library/config"
 
 	"github.com/go-redis/redis/v8"
 )
 
+const (
+	ModeStandalone = "standalone" // 单节点
+	ModeSentinel   = "sentinel"   // 哨兵
+	ModeCluster    = "cluster"    // 集群
+)
+
 var (
-	Client    *redis.Client
+	Client    redis.UniversalClient
 	KeyPrefix = "keyPrefix" // your project name
 	Nil       = redis.Nil
+
+	defaultClientMu sync.RWMutex
+	defaultClient   Cmdable
+)
+
+/**
+ * Cmdable 本包使用到的命令集合, *redis.Client、*redis.ClusterClient 等 go-redis 客户端均已实现
+ * 各类型默认使用 DefaultClient(), 也可以通过 WithClient 单独注入, 测试时可注入 MemoryClient
+ *
+ * Example:
+ *
+ * mc := redis.NewMemoryClient()
+ * redis.SetDefaultClient(mc)
+ * defer redis.SetDefaultClient(nil)
+ *
+ * ok, _ := redis.NewLock("order").Lock(time.Second)
+ */
+type Cmdable interface {
+	redis.Scripter
+
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+	Exists(ctx context.Context, keys ...string) *redis.IntCmd
+	Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd
+	ExpireAt(ctx context.Context, key string, tm time.Time) *redis.BoolCmd
+	PTTL(ctx context.Context, key string) *redis.DurationCmd
+	TTL(ctx context.Context, key string) *redis.DurationCmd
+	Unlink(ctx context.Context, keys ...string) *redis.IntCmd
+	Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd
+	MemoryUsage(ctx context.Context, key string, samples ...int) *redis.IntCmd
+
+	HGet(ctx context.Context, key, field string) *redis.StringCmd
+	HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd
+	HDel(ctx context.Context, key string, fields ...string) *redis.IntCmd
+	HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd
+	HMGet(ctx context.Context, key string, fields ...string) *redis.SliceCmd
+	HIncrBy(ctx context.Context, key, field string, incr int64) *redis.IntCmd
+	HIncrByFloat(ctx context.Context, key, field string, incr float64) *redis.FloatCmd
+
+	SAdd(ctx context.Context, key string, members ...interface{}) *redis.IntCmd
+	SRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd
+	SMembers(ctx context.Context, key string) *redis.StringSliceCmd
+	SCard(ctx context.Context, key string) *redis.IntCmd
+	SUnion(ctx context.Context, keys ...string) *redis.StringSliceCmd
+	SScan(ctx context.Context, key string, cursor uint64, match string, count int64) *redis.ScanCmd
+
+	ZRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd
+	ZScore(ctx context.Context, key, member string) *redis.FloatCmd
+	ZRevRank(ctx context.Context, key, member string) *redis.IntCmd
+	ZRevRangeWithScores(ctx context.Context, key string, start, stop int64) *redis.ZSliceCmd
+	ZCard(ctx context.Context, key string) *redis.IntCmd
+
+	PFAdd(ctx context.Context, key string, els ...interface{}) *redis.IntCmd
+	PFCount(ctx context.Context, keys ...string) *redis.IntCmd
+	PFMerge(ctx context.Context, dest string, keys ...string) *redis.StatusCmd
+
+	SetBit(ctx context.Context, key string, offset int64, value int) *redis.IntCmd
+	GetBit(ctx context.Context, key string, offset int64) *redis.IntCmd
+	BitCount(ctx context.Context, key string, bitCount *redis.BitCount) *redis.IntCmd
+
+	Publish(ctx context.Context, channel string, message interface{}) *redis.IntCmd
+}
+
+var (
+	_ Cmdable = (*redis.Client)(nil)
+	_ Cmdable = (*redis.ClusterClient)(nil)
+	_ Cmdable = (redis.UniversalClient)(nil)
 )
 
-func Init() {
+// PubSubConn 订阅连接, *redis.PubSub 已实现
+type PubSubConn interface {
+	Receive(ctx context.Context) (interface{}, error)
+	ReceiveMessage(ctx context.Context) (*redis.Message, error)
+	Close() error
+}
+
+// Subscriber 自定义客户端实现该接口以支持订阅, go-redis 客户端使用其 Subscribe 方法
+type Subscriber interface {
+	SubscribeConn(ctx context.Context, channels ...string) PubSubConn
+}
+
+// SetDefaultClient 设置默认客户端, 传 nil 恢复为 GetClient()
+func SetDefaultClient(c Cmdable) {
+	defaultClientMu.Lock()
+	defer defaultClientMu.Unlock()
+	defaultClient = c
+}
+
+// DefaultClient 返回默认客户端, 未设置时返回 GetClient()
+func DefaultClient() Cmdable {
+	defaultClientMu.RLock()
+	c := defaultClient
+	defaultClientMu.RUnlock()
+	if c != nil {
+		return c
+	}
+	return GetClient()
+}
+
+// pick 返回 c, c 为 nil 时返回 DefaultClient()
+func pick(c Cmdable) Cmdable {
+	if c != nil {
+		return c
+	}
+	return DefaultClient()
+}
+
+// subscribe 使用 c 订阅频道
+func subscribe(ctx context.Context, c Cmdable, channels ...string) (PubSubConn, error) {
+	switch c := c.(type) {
+	case Subscriber:
+		return c.SubscribeConn(ctx, channels...), nil
+	case interface {
+		Subscribe(ctx context.Context, channels ...string) *redis.PubSub
+	}:
+		return c.Subscribe(ctx, channels...), nil
+	}
+	return nil, fmt.Errorf("redis client %T does not support subscribe", c)
+}
+
+/**
+ * Init 根据 config.Get().Redis 创建客户端, 支持单节点、哨兵、集群三种模式
+ *
+ * Example:
+ *
+ * redis:
+ *   mode: sentinel
+ *   masterName: mymaster
+ *   addrs: ["10.0.0.1:26379", "10.0.0.2:26379", "10.0.0.3:26379"]
+ *   password: xxx
+ *   poolSize: 50
+ *   readTimeout: 3s
+ *   tlsProtocols: true
+ *   tlsCaFile: /etc/redis/ca.pem
+ *
+ * 集群模式下涉及多个 key 的 Lua 脚本要求 key 位于同一 slot, 本包内的多 key 操作均使用 hash tag 处理
+ */
+func Init() error {
 	var (
 		redisCfg = config.Get().Redis
-		opt      = &redis.Options{
-			Addr:     redisCfg.Addr,
-			Password: redisCfg.Password, // no password set
-			DB:       redisCfg.DB,       // use default DB
+		opt      = &redis.UniversalOptions{
+			Addrs:            redisCfg.Addrs,
+			MasterName:       redisCfg.MasterName,
+			SentinelUsername: redisCfg.SentinelUsername,
+			SentinelPassword: redisCfg.SentinelPassword,
+			Username:         redisCfg.Username,
+			Password:         redisCfg.Password, // no password set
+			DB:               redisCfg.DB,       // use default DB
+			PoolSize:         redisCfg.PoolSize,
+			MinIdleConns:     redisCfg.MinIdleConns,
+			DialTimeout:      redisCfg.DialTimeout,
+			ReadTimeout:      redisCfg.ReadTimeout,
+			WriteTimeout:     redisCfg.WriteTimeout,
+			PoolTimeout:      redisCfg.PoolTimeout,
 		}
 	)
-	if len(redisCfg.Username) != 0 {
-		opt.Username = redisCfg.Username
+	if len(opt.Addrs) == 0 && len(redisCfg.Addr) != 0 {
+		opt.Addrs = []string{redisCfg.Addr}
 	}
 	if redisCfg.TlsProtocols {
-		opt.TLSConfig = &tls.Config{
-			MinVersion: tls.VersionTLS12,
+		tlsConfig, err := newTLSConfig(redisCfg.TlsCaFile, redisCfg.TlsSkipVerify)
+		if err != nil {
+			return err
+		}
+		opt.TLSConfig = tlsConfig
+	}
+
+	switch redisCfg.Mode {
+	case "", ModeStandalone:
+		Client = redis.NewClient(opt.Simple())
+	case ModeSentinel:
+		if len(opt.MasterName) == 0 {
+			return errors.New("redis sentinel mode requires masterName")
 		}
+		Client = redis.NewFailoverClient(opt.Failover())
+	case ModeCluster:
+		Client = redis.NewClusterClient(opt.Cluster())
+	default:
+		return fmt.Errorf("unknown redis mode: %s", redisCfg.Mode)
+	}
+	return nil
+}
+
+// newTLSConfig 创建 tls 配置, caFile 为空时使用系统证书
+func newTLSConfig(caFile string, skipVerify bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: skipVerify,
+	}
+	if len(caFile) == 0 {
+		return tlsConfig, nil
+	}
+	ca, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("read redis ca file error: %s", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("parse redis ca file %s error: no certificates found", caFile)
 	}
-	Client = redis.NewClient(opt)
+	tlsConfig.RootCAs = pool
+	return tlsConfig, nil
 }
 
-func GetClient() *redis.Client {
+// GetClient 返回客户端, 未初始化时使用配置初始化, 配置错误时 panic
+func GetClient() redis.UniversalClient {
 	if Client == nil {
-		Init()
+		if err := Init(); err != nil {
+			panic(fmt.Sprintf("redis init error: %s", err))
+		}
 	}
 	return Client
 }
 
+// Close 关闭客户端
+func Close() error {
+	if Client == nil {
+		return nil
+	}
+	return Client.Close()
+}
+
 func Ping() (string, error) {
+	return PingContext(context.Background())
+}
+
+// PingContext 使用 ctx 检查连接
+func PingContext(ctx context.Context) (string, error) {
 	if Client == nil {
 		return "", errors.New("redis not init")
 	}
-	return Client.Ping(context.Background()).Result()
+	return Client.Ping(ctx).Result()
+}
+
+// withTimeout 在 timeout > 0 时为 ctx 附加超时, 否则原样返回
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return ctx, func() {}
+}
+
+// releaseContext 为释放类命令生成 context, 不随 ctx 取消, 保证 ctx 结束后 defer 中的释放仍能执行
+func releaseContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	return withTimeout(context.WithoutCancel(ctx), timeout)
 }
@@ -0,0 +1,232 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+var (
+	// reentrantLockScript 锁不存在或由 owner 持有时计数加一并续期, 返回持有次数, ARGV[2] 不大于 0 时锁不过期
+	reentrantLockScript = newScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 or redis.call("HEXISTS", KEYS[1], ARGV[1]) == 1 then
+	local n = redis.call("HINCRBY", KEYS[1], ARGV[1], 1)
+	if tonumber(ARGV[2]) > 0 then
+		redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	else
+		redis.call("PERSIST", KEYS[1])
+	end
+	return n
+end
+return 0`, memReentrantLock)
+
+	// reentrantUnlockScript 计数减一, 归零时删除锁, 返回剩余持有次数, 未持有返回 -1
+	reentrantUnlockScript = newScript(`
+if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 0 then
+	return -1
+end
+local n = redis.call("HINCRBY", KEYS[1], ARGV[1], -1)
+if n <= 0 then
+	redis.call("DEL", KEYS[1])
+	return 0
+end
+return n`, memReentrantUnlock)
+
+	// reentrantExtendScript owner 持有时续期, ARGV[2] 不大于 0 时取消过期
+	reentrantExtendScript = newScript(`
+if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 1 then
+	if tonumber(ARGV[2]) > 0 then
+		return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	end
+	redis.call("PERSIST", KEYS[1])
+	return 1
+end
+return 0`, memReentrantExtend)
+)
+
+func memReentrantLock(m *MemoryClient, keys, args []string) (interface{}, error) {
+	it, err := m.lookupKind(keys[0], memoryHash)
+	if err != nil {
+		return nil, err
+	}
+	if it != nil {
+		if _, ok := it.hash[args[0]]; !ok {
+			return int64(0), nil
+		}
+	}
+	n, err := m.hincrBy(keys[0], args[0], 1)
+	if err != nil {
+		return nil, err
+	}
+	if px := memMs(args[1]); px > 0 {
+		m.pexpire(keys[0], px)
+	} else {
+		m.lookup(keys[0]).expireAt = time.Time{}
+	}
+	return n, nil
+}
+
+func memReentrantUnlock(m *MemoryClient, keys, args []string) (interface{}, error) {
+	if !m.hexists(keys[0], args[0]) {
+		return int64(-1), nil
+	}
+	n, err := m.hincrBy(keys[0], args[0], -1)
+	if err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		m.del(keys[0])
+		return int64(0), nil
+	}
+	return n, nil
+}
+
+func memReentrantExtend(m *MemoryClient, keys, args []string) (interface{}, error) {
+	if !m.hexists(keys[0], args[0]) {
+		return int64(0), nil
+	}
+	if px := memMs(args[1]); px > 0 {
+		return memBool(m.pexpire(keys[0], px)), nil
+	}
+	m.lookup(keys[0]).expireAt = time.Time{}
+	return int64(1), nil
+}
+
+// ReentrantLock 可重入分布式锁, 同一 owner 可多次获取, 释放相同次数后锁才会删除
+type ReentrantLock struct {
+	ctx     context.Context
+	timeout time.Duration
+	client  Cmdable
+	prefix  string
+	rawKey  string
+	owner   string
+}
+
+/**
+ * NewReentrantLock 创建可重入锁, 使用默认的前缀格式：<KeyPrefix>.rlock.<rawKey>
+ * owner 标识持有者, 例如任务 ID, 持有相同 owner 的实例共享同一把锁
+ *
+ * Example:
+ *
+ * l := redis.NewReentrantLock("report:daily", jobId)
+ * if err := l.Acquire(ctx, time.Minute); err != nil {
+ * 	return err
+ * }
+ * defer l.Unlock()
+ */
+func NewReentrantLock(key, owner string) *ReentrantLock {
+	return &ReentrantLock{
+		ctx:    context.Background(),
+		prefix: fmt.Sprintf("%s.rlock.", KeyPrefix),
+		rawKey: key,
+		owner:  owner,
+	}
+}
+
+// SetPrefix 设置锁的前缀
+func (l *ReentrantLock) SetPrefix(prefix string) *ReentrantLock {
+	l.prefix = prefix
+	return l
+}
+
+// EmptyPrefix 清空前缀
+func (l *ReentrantLock) EmptyPrefix() *ReentrantLock {
+	l.prefix = ""
+	return l
+}
+
+// WithContext 返回使用 ctx 的副本, 释放操作不受 ctx 取消影响
+func (l *ReentrantLock) WithContext(ctx context.Context) *ReentrantLock {
+	if ctx == nil {
+		panic("redis: nil context")
+	}
+	r := *l
+	r.ctx = ctx
+	return &r
+}
+
+// WithTimeout 返回设置了单条命令超时时间的副本, timeout <= 0 表示不限制
+func (l *ReentrantLock) WithTimeout(timeout time.Duration) *ReentrantLock {
+	r := *l
+	r.timeout = timeout
+	return &r
+}
+
+// WithClient 返回使用指定客户端的副本, c 为 nil 时使用 DefaultClient()
+func (l *ReentrantLock) WithClient(c Cmdable) *ReentrantLock {
+	r := *l
+	r.client = c
+	return &r
+}
+
+// Client 返回使用的客户端
+func (l *ReentrantLock) Client() Cmdable {
+	return pick(l.client)
+}
+
+// FullKey 返回拼接后的完整 Redis key
+func (l *ReentrantLock) FullKey() string {
+	return l.prefix + l.rawKey
+}
+
+// Owner 返回持有者标识
+func (l *ReentrantLock) Owner() string {
+	return l.owner
+}
+
+// Lock 尝试获取锁, 成功后持有次数加一并重置过期时间, expire <= 0 表示不过期。被其他 owner 持有时返回 false
+func (l *ReentrantLock) Lock(expire time.Duration) (bool, error) {
+	ctx, cancel := withTimeout(l.ctx, l.timeout)
+	defer cancel()
+	n, err := reentrantLockScript.Run(ctx, l.Client(), []string{l.FullKey()}, l.owner, expire.Milliseconds()).Int64()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Acquire 在 ctx 结束前等待获取锁, 超时返回 ErrNotObtained
+func (l *ReentrantLock) Acquire(ctx context.Context, expire time.Duration) error {
+	return acquireLoop(ctx, defaultMinBackoff, defaultMaxBackoff, func() (bool, error) {
+		return l.Lock(expire)
+	})
+}
+
+// Unlock 持有次数减一, 归零时删除锁, 返回剩余持有次数, 未持有时返回 ErrNotHeld
+func (l *ReentrantLock) Unlock() (int64, error) {
+	ctx, cancel := releaseContext(l.ctx, l.timeout)
+	defer cancel()
+	n, err := reentrantUnlockScript.Run(ctx, l.Client(), []string{l.FullKey()}, l.owner).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, ErrNotHeld
+	}
+	return n, nil
+}
+
+// Extend 重置锁的过期时间, expire <= 0 表示不过期, 未持有时返回 ErrNotHeld
+func (l *ReentrantLock) Extend(expire time.Duration) error {
+	ctx, cancel := withTimeout(l.ctx, l.timeout)
+	defer cancel()
+	n, err := reentrantExtendScript.Run(ctx, l.Client(), []string{l.FullKey()}, l.owner, expire.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotHeld
+	}
+	return nil
+}
+
+// Count 返回当前 owner 的持有次数
+func (l *ReentrantLock) Count() (int64, error) {
+	ctx, cancel := withTimeout(l.ctx, l.timeout)
+	defer cancel()
+	n, err := l.Client().HGet(ctx, l.FullKey(), l.owner).Int64()
+	if err == Nil {
+		return 0, nil
+	}
+	return n, err
+}
@@ -0,0 +1,370 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// 读写锁使用一个 hash 保存状态: mode 字段为 read/write, <owner>:r 与 <owner>:w 字段为各持有者的读/写重入次数
+// 另用一个 sorted set 保存各持有字段的毫秒级过期时间(不过期为 +inf), 每次操作先清理已过期的持有者,
+// 两个 key 的过期时间与最晚过期的持有者一致, 崩溃的读者不会因其他读者续期而一直占用锁
+const (
+	// rwPurge 清理已过期的持有者, 全部过期时删除锁, 写者过期但仍有读者时转为读模式
+	rwPurge = `
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local expired = redis.call("ZRANGEBYSCORE", KEYS[2], "-inf", now)
+if #expired > 0 then
+	redis.call("ZREMRANGEBYSCORE", KEYS[2], "-inf", now)
+	local writer = false
+	for _, f in ipairs(expired) do
+		redis.call("HDEL", KEYS[1], f)
+		if string.sub(f, -2) == ":w" then
+			writer = true
+		end
+	end
+	if redis.call("HLEN", KEYS[1]) <= 1 then
+		redis.call("DEL", KEYS[1], KEYS[2])
+	elseif writer then
+		redis.call("HSET", KEYS[1], "mode", "read")
+	end
+end
+`
+	// rwHold 记录持有字段 field 的过期时间, ARGV[2] 不大于 0 时不过期
+	rwHold = `
+if tonumber(ARGV[2]) > 0 then
+	redis.call("ZADD", KEYS[2], now + tonumber(ARGV[2]), field)
+else
+	redis.call("ZADD", KEYS[2], "+inf", field)
+end
+if redis.call("ZCOUNT", KEYS[2], "+inf", "+inf") > 0 then
+	redis.call("PERSIST", KEYS[1])
+	redis.call("PERSIST", KEYS[2])
+else
+	local at = redis.call("ZRANGE", KEYS[2], -1, -1, "WITHSCORES")[2]
+	redis.call("PEXPIREAT", KEYS[1], at)
+	redis.call("PEXPIREAT", KEYS[2], at)
+end
+return 1`
+)
+
+var (
+	// rwReadLockScript 无锁或读模式时获取读锁, 写锁持有者可同时获取读锁(降级)
+	rwReadLockScript = newScript(rwPurge+`
+local mode = redis.call("HGET", KEYS[1], "mode")
+if mode == "write" and redis.call("HEXISTS", KEYS[1], ARGV[1] .. ":w") == 0 then
+	return 0
+end
+if mode == false then
+	redis.call("HSET", KEYS[1], "mode", "read")
+end
+local field = ARGV[1] .. ":r"
+redis.call("HINCRBY", KEYS[1], field, 1)`+rwHold, memRWReadLock)
+
+	// rwWriteLockScript 无锁时获取写锁, 写锁持有者可重入
+	rwWriteLockScript = newScript(rwPurge+`
+local mode = redis.call("HGET", KEYS[1], "mode")
+if mode == false then
+	redis.call("HSET", KEYS[1], "mode", "write")
+elseif mode ~= "write" or redis.call("HEXISTS", KEYS[1], ARGV[1] .. ":w") == 0 then
+	return 0
+end
+local field = ARGV[1] .. ":w"
+redis.call("HINCRBY", KEYS[1], field, 1)`+rwHold, memRWWriteLock)
+
+	// rwUnlockScript 释放读锁或写锁(ARGV[2] 为 r/w), 全部释放后删除 key, 写锁释放但仍有读锁时转为读模式
+	rwUnlockScript = newScript(rwPurge+`
+local field = ARGV[1] .. ":" .. ARGV[2]
+if redis.call("HEXISTS", KEYS[1], field) == 0 then
+	return -1
+end
+local n = redis.call("HINCRBY", KEYS[1], field, -1)
+if n <= 0 then
+	redis.call("HDEL", KEYS[1], field)
+	redis.call("ZREM", KEYS[2], field)
+end
+if redis.call("HLEN", KEYS[1]) <= 1 then
+	redis.call("DEL", KEYS[1], KEYS[2])
+elseif ARGV[2] == "w" and n <= 0 then
+	redis.call("HSET", KEYS[1], "mode", "read")
+end
+return n`, memRWUnlock)
+)
+
+// memRWPurge 对应 rwPurge
+func memRWPurge(m *MemoryClient, keys []string) error {
+	z, err := m.lookupKind(keys[1], memoryZSet)
+	if err != nil || z == nil {
+		return err
+	}
+	h, err := m.lookupKind(keys[0], memoryHash)
+	if err != nil {
+		return err
+	}
+	now := float64(m.nowMs())
+	expired, writer := 0, false
+	for field, score := range z.zset {
+		if score > now {
+			continue
+		}
+		delete(z.zset, field)
+		if h != nil {
+			delete(h.hash, field)
+		}
+		expired++
+		writer = writer || strings.HasSuffix(field, ":w")
+	}
+	if expired == 0 {
+		return nil
+	}
+	if h == nil || len(h.hash) <= 1 {
+		m.del(keys...)
+	} else if writer {
+		h.hash["mode"] = "read"
+	}
+	return nil
+}
+
+// memRWHold 对应 rwHold
+func memRWHold(m *MemoryClient, keys []string, field string, ttl int64) error {
+	z, err := m.create(keys[1], memoryZSet)
+	if err != nil {
+		return err
+	}
+	z.zset[field] = math.Inf(1)
+	if ttl > 0 {
+		z.zset[field] = float64(m.nowMs() + ttl)
+	}
+	at := memZExpireAt(z)
+	z.expireAt = at
+	m.lookup(keys[0]).expireAt = at
+	return nil
+}
+
+func memRWReadLock(m *MemoryClient, keys, args []string) (interface{}, error) {
+	if err := memRWPurge(m, keys); err != nil {
+		return nil, err
+	}
+	it, err := m.create(keys[0], memoryHash)
+	if err != nil {
+		return nil, err
+	}
+	mode, ok := it.hash["mode"]
+	if mode == "write" && !m.hexists(keys[0], args[0]+":w") {
+		return int64(0), nil
+	}
+	if !ok {
+		it.hash["mode"] = "read"
+	}
+	field := args[0] + ":r"
+	if _, err = m.hincrBy(keys[0], field, 1); err != nil {
+		return nil, err
+	}
+	if err = memRWHold(m, keys, field, memInt(args[1])); err != nil {
+		return nil, err
+	}
+	return int64(1), nil
+}
+
+func memRWWriteLock(m *MemoryClient, keys, args []string) (interface{}, error) {
+	if err := memRWPurge(m, keys); err != nil {
+		return nil, err
+	}
+	it, err := m.create(keys[0], memoryHash)
+	if err != nil {
+		return nil, err
+	}
+	mode, ok := it.hash["mode"]
+	if !ok {
+		it.hash["mode"] = "write"
+	} else if mode != "write" || !m.hexists(keys[0], args[0]+":w") {
+		return int64(0), nil
+	}
+	field := args[0] + ":w"
+	if _, err = m.hincrBy(keys[0], field, 1); err != nil {
+		return nil, err
+	}
+	if err = memRWHold(m, keys, field, memInt(args[1])); err != nil {
+		return nil, err
+	}
+	return int64(1), nil
+}
+
+func memRWUnlock(m *MemoryClient, keys, args []string) (interface{}, error) {
+	if err := memRWPurge(m, keys); err != nil {
+		return nil, err
+	}
+	field := args[0] + ":" + args[1]
+	if !m.hexists(keys[0], field) {
+		return int64(-1), nil
+	}
+	n, err := m.hincrBy(keys[0], field, -1)
+	if err != nil {
+		return nil, err
+	}
+	it := m.lookup(keys[0])
+	if n <= 0 {
+		delete(it.hash, field)
+		if z, _ := m.lookupKind(keys[1], memoryZSet); z != nil {
+			delete(z.zset, field)
+		}
+	}
+	if len(it.hash) <= 1 {
+		m.del(keys...)
+	} else if args[1] == "w" && n <= 0 {
+		it.hash["mode"] = "read"
+	}
+	return n, nil
+}
+
+// RWLock 分布式读写锁, 多个读者可同时持有, 写者独占
+type RWLock struct {
+	ctx     context.Context
+	timeout time.Duration
+	client  Cmdable
+	prefix  string
+	rawKey  string
+	owner   string
+}
+
+/**
+ * NewRWLock 创建读写锁, 使用默认的前缀格式：<KeyPrefix>.rwlock.<rawKey>
+ * 每个实例使用随机 owner, 读写锁均可重入
+ *
+ * Example:
+ *
+ * l := redis.NewRWLock("config")
+ * if err := l.AcquireRead(ctx, 10*time.Second); err != nil {
+ * 	return err
+ * }
+ * defer l.RUnlock()
+ */
+func NewRWLock(key string) *RWLock {
+	uid, _ := uuid.NewRandom()
+	return &RWLock{
+		ctx:    context.Background(),
+		prefix: fmt.Sprintf("%s.rwlock.", KeyPrefix),
+		rawKey: key,
+		owner:  uid.String(),
+	}
+}
+
+// SetPrefix 设置锁的前缀
+func (l *RWLock) SetPrefix(prefix string) *RWLock {
+	l.prefix = prefix
+	return l
+}
+
+// EmptyPrefix 清空前缀
+func (l *RWLock) EmptyPrefix() *RWLock {
+	l.prefix = ""
+	return l
+}
+
+// SetOwner 设置持有者标识, 用于跨实例释放同一持有者的锁
+func (l *RWLock) SetOwner(owner string) *RWLock {
+	l.owner = owner
+	return l
+}
+
+// WithContext 返回使用 ctx 的副本, 释放操作不受 ctx 取消影响
+func (l *RWLock) WithContext(ctx context.Context) *RWLock {
+	if ctx == nil {
+		panic("redis: nil context")
+	}
+	r := *l
+	r.ctx = ctx
+	return &r
+}
+
+// WithTimeout 返回设置了单条命令超时时间的副本, timeout <= 0 表示不限制
+func (l *RWLock) WithTimeout(timeout time.Duration) *RWLock {
+	r := *l
+	r.timeout = timeout
+	return &r
+}
+
+// WithClient 返回使用指定客户端的副本, c 为 nil 时使用 DefaultClient()
+func (l *RWLock) WithClient(c Cmdable) *RWLock {
+	r := *l
+	r.client = c
+	return &r
+}
+
+// Client 返回使用的客户端
+func (l *RWLock) Client() Cmdable {
+	return pick(l.client)
+}
+
+// FullKey 返回拼接后的完整 Redis key
+func (l *RWLock) FullKey() string {
+	return l.prefix + l.rawKey
+}
+
+// holdersKey 返回保存持有者过期时间的 key, 使用 hash tag 保证集群模式下与锁位于同一 slot
+func (l *RWLock) holdersKey() string {
+	return "{" + l.FullKey() + "}.holders"
+}
+
+// RLock 尝试获取读锁, 每个读者单独计算过期时间, expire <= 0 表示不过期。被其他持有者以写锁持有时返回 false
+func (l *RWLock) RLock(expire time.Duration) (bool, error) {
+	return l.run(rwReadLockScript, expire.Milliseconds())
+}
+
+// Lock 尝试获取写锁, expire <= 0 表示不过期。存在其他读者或写者时返回 false
+func (l *RWLock) Lock(expire time.Duration) (bool, error) {
+	return l.run(rwWriteLockScript, expire.Milliseconds())
+}
+
+// AcquireRead 在 ctx 结束前等待获取读锁, 超时返回 ErrNotObtained
+func (l *RWLock) AcquireRead(ctx context.Context, expire time.Duration) error {
+	return acquireLoop(ctx, defaultMinBackoff, defaultMaxBackoff, func() (bool, error) {
+		return l.RLock(expire)
+	})
+}
+
+// AcquireWrite 在 ctx 结束前等待获取写锁, 超时返回 ErrNotObtained
+func (l *RWLock) AcquireWrite(ctx context.Context, expire time.Duration) error {
+	return acquireLoop(ctx, defaultMinBackoff, defaultMaxBackoff, func() (bool, error) {
+		return l.Lock(expire)
+	})
+}
+
+// RUnlock 释放一次读锁, 未持有时返回 ErrNotHeld
+func (l *RWLock) RUnlock() error {
+	return l.unlock("r")
+}
+
+// Unlock 释放一次写锁, 未持有时返回 ErrNotHeld
+func (l *RWLock) Unlock() error {
+	return l.unlock("w")
+}
+
+func (l *RWLock) run(script *redis.Script, args ...interface{}) (bool, error) {
+	ctx, cancel := withTimeout(l.ctx, l.timeout)
+	defer cancel()
+	n, err := script.Run(ctx, l.Client(), []string{l.FullKey(), l.holdersKey()}, append([]interface{}{l.owner}, args...)...).Int64()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (l *RWLock) unlock(mode string) error {
+	ctx, cancel := releaseContext(l.ctx, l.timeout)
+	defer cancel()
+	n, err := rwUnlockScript.Run(ctx, l.Client(), []string{l.FullKey(), l.holdersKey()}, l.owner, mode).Int64()
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return ErrNotHeld
+	}
+	return nil
+}
@@ -0,0 +1,356 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	defaultScanCount     = 100
+	defaultScanBatchSize = 100
+	defaultScanSample    = 100
+)
+
+// ScanOptions 扫描选项, 零值使用默认值
+type ScanOptions struct {
+	Count      int64  // 每次 SCAN 的 COUNT 提示, 默认 100
+	BatchSize  int    // 每批回调或 UNLINK 的 key 数量, 默认 100
+	Rate       int    // 每秒最多处理的 key 数量, 0 表示不限制, 在生产环境执行时建议设置
+	Sample     int    // Inventory 每个分组执行 MEMORY USAGE 的最大 key 数量, 默认 100, 小于 0 表示不采样
+	GroupDepth int    // Inventory 按分隔符切分后取前几段作为分组, 默认 1
+	Separator  string // Inventory 分组的分隔符, 默认 ":"
+}
+
+func (o *ScanOptions) withDefaults() ScanOptions {
+	var r ScanOptions
+	if o != nil {
+		r = *o
+	}
+	if r.Count <= 0 {
+		r.Count = defaultScanCount
+	}
+	if r.BatchSize <= 0 {
+		r.BatchSize = defaultScanBatchSize
+	}
+	if r.Sample == 0 {
+		r.Sample = defaultScanSample
+	}
+	if r.GroupDepth <= 0 {
+		r.GroupDepth = 1
+	}
+	if len(r.Separator) == 0 {
+		r.Separator = ":"
+	}
+	return r
+}
+
+// KeyInventory 一组 key 的盘点结果
+type KeyInventory struct {
+	Count        int64            // key 数量
+	Sampled      int64            // 参与内存采样的 key 数量
+	SampledBytes int64            // 采样 key 占用的内存合计
+	AvgBytes     int64            // 采样 key 的平均内存
+	EstBytes     int64            // 按平均值估算的内存合计
+	TTL          map[string]int64 // 剩余过期时间分布, 见 TTLBuckets
+}
+
+// TTLBuckets Inventory 中 TTL 分布的区间名称
+var TTLBuckets = []string{"none", "<1m", "<1h", "<1d", "<7d", ">=7d"}
+
+/**
+ * ScanKeys 使用 SCAN 遍历 pattern 匹配的 key, 每批回调一次, 传入的 key 不含前缀
+ * pattern 为相对于缓存前缀的 glob 模式, 前缀中的特殊字符会被转义; 集群模式下遍历全部主节点, 回调会被串行调用
+ * SCAN 可能返回重复的 key, 回调需要保证幂等
+ *
+ * Example:
+ *
+ * c := redis.New()
+ * err := c.ScanKeys("user:*", &redis.ScanOptions{Rate: 5000}, func(keys []string) error {
+ * 	fmt.Println(keys)
+ * 	return nil
+ * })
+ */
+func (c *Cache) ScanKeys(pattern string, opts *ScanOptions, fn func(keys []string) error) error {
+	o := opts.withDefaults()
+	var (
+		mu    sync.Mutex
+		pacer = newScanPacer(o.Rate)
+	)
+	return c.scan(pattern, o, func(node Cmdable, keys []string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := pacer.wait(c.ctx, len(keys)); err != nil {
+			return err
+		}
+		return fn(c.trimPrefix(keys))
+	})
+}
+
+/**
+ * DelByPattern 使用 SCAN 查找 pattern 匹配的 key 并按批 UNLINK, 返回删除数量
+ * pattern 为相对于缓存前缀的 glob 模式, 设置 Rate 可限制每秒删除的数量
+ *
+ * Example:
+ *
+ * n, err := redis.New().WithTimeout(time.Second).DelByPattern("product-list:*", &redis.ScanOptions{Rate: 2000})
+ */
+func (c *Cache) DelByPattern(pattern string, opts *ScanOptions) (int64, error) {
+	o := opts.withDefaults()
+	var (
+		mu         sync.Mutex
+		total      int64
+		pacer      = newScanPacer(o.Rate)
+		_, cluster = c.Client().(*redis.ClusterClient)
+	)
+	err := c.scan(pattern, o, func(node Cmdable, keys []string) error {
+		mu.Lock()
+		err := pacer.wait(c.ctx, len(keys))
+		mu.Unlock()
+		if err != nil {
+			return err
+		}
+		n, err := c.unlink(node, keys, cluster)
+		mu.Lock()
+		total += n
+		mu.Unlock()
+		return err
+	})
+	return total, err
+}
+
+// DelPrefix 删除以 prefix 开头的 key, prefix 按字面匹配
+func (c *Cache) DelPrefix(prefix string, opts *ScanOptions) (int64, error) {
+	return c.DelByPattern(escapePattern(prefix)+"*", opts)
+}
+
+/**
+ * Inventory 盘点 pattern 匹配的 key, 按分组统计数量、内存占用(MEMORY USAGE 采样)及 TTL 分布
+ * 分组为去掉缓存前缀后按 Separator 切分的前 GroupDepth 段, 例如 user:42:profile 在默认选项下属于 user
+ *
+ * Example:
+ *
+ * inv, err := redis.New().Inventory("*", &redis.ScanOptions{Rate: 1000, Sample: 50})
+ * for group, s := range inv {
+ * 	fmt.Println(group, s.Count, s.EstBytes, s.TTL)
+ * }
+ */
+func (c *Cache) Inventory(pattern string, opts *ScanOptions) (map[string]*KeyInventory, error) {
+	o := opts.withDefaults()
+	var (
+		mu    sync.Mutex
+		res   = map[string]*KeyInventory{}
+		pacer = newScanPacer(o.Rate)
+	)
+	err := c.scan(pattern, o, func(node Cmdable, keys []string) error {
+		mu.Lock()
+		err := pacer.wait(c.ctx, len(keys))
+		mu.Unlock()
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			group := keyGroup(strings.TrimPrefix(key, c.prefix), o.Separator, o.GroupDepth)
+
+			mu.Lock()
+			inv, ok := res[group]
+			if !ok {
+				inv = &KeyInventory{TTL: map[string]int64{}}
+				res[group] = inv
+			}
+			inv.Count++
+			sample := o.Sample > 0 && inv.Sampled < int64(o.Sample)
+			if sample {
+				inv.Sampled++ // 先占位, 避免并发的主节点超出采样数
+			}
+			mu.Unlock()
+
+			ttl, err := c.keyTTL(node, key)
+			if err != nil {
+				return err
+			}
+			var size int64
+			if sample {
+				if size, err = c.memoryUsage(node, key); err != nil {
+					return err
+				}
+			}
+
+			mu.Lock()
+			if ttl != -2 {
+				inv.TTL[ttlBucket(ttl)]++
+			}
+			inv.SampledBytes += size
+			mu.Unlock()
+		}
+		return nil
+	})
+	for _, inv := range res {
+		if inv.Sampled > 0 {
+			inv.AvgBytes = inv.SampledBytes / inv.Sampled
+			inv.EstBytes = inv.AvgBytes * inv.Count
+		}
+	}
+	return res, err
+}
+
+// scan 遍历匹配的完整 key, 集群模式下并发遍历各主节点, fn 收到所在节点的客户端
+func (c *Cache) scan(pattern string, o ScanOptions, fn func(node Cmdable, keys []string) error) error {
+	match := escapePattern(c.prefix) + pattern
+	if cc, ok := c.Client().(*redis.ClusterClient); ok {
+		return cc.ForEachMaster(c.ctx, func(ctx context.Context, node *redis.Client) error {
+			return c.scanNode(node, match, o, fn)
+		})
+	}
+	return c.scanNode(c.Client(), match, o, fn)
+}
+
+func (c *Cache) scanNode(node Cmdable, match string, o ScanOptions, fn func(node Cmdable, keys []string) error) error {
+	var (
+		cursor uint64
+		batch  []string
+	)
+	for {
+		ctx, cancel := c.cmdContext()
+		keys, next, err := node.Scan(ctx, cursor, match, o.Count).Result()
+		cancel()
+		if err != nil {
+			return err
+		}
+		batch = append(batch, keys...)
+		for len(batch) >= o.BatchSize {
+			if err = fn(node, batch[:o.BatchSize]); err != nil {
+				return err
+			}
+			batch = batch[o.BatchSize:]
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	if len(batch) > 0 {
+		return fn(node, batch)
+	}
+	return nil
+}
+
+// unlink 删除一批 key, 集群节点上的 key 可能位于不同 slot, 逐个删除
+func (c *Cache) unlink(node Cmdable, keys []string, cluster bool) (int64, error) {
+	if cluster {
+		var total int64
+		for _, k := range keys {
+			n, err := c.unlinkKeys(node, k)
+			if err != nil {
+				return total, err
+			}
+			total += n
+		}
+		return total, nil
+	}
+	return c.unlinkKeys(node, keys...)
+}
+
+func (c *Cache) unlinkKeys(node Cmdable, keys ...string) (int64, error) {
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	return node.Unlink(ctx, keys...).Result()
+}
+
+// keyTTL 返回剩余过期时间, -1 表示不过期, -2 表示不存在
+func (c *Cache) keyTTL(node Cmdable, key string) (time.Duration, error) {
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	return node.PTTL(ctx, key).Result()
+}
+
+func (c *Cache) memoryUsage(node Cmdable, key string) (int64, error) {
+	ctx, cancel := c.cmdContext()
+	defer cancel()
+	n, err := node.MemoryUsage(ctx, key).Result()
+	if err == Nil {
+		return 0, nil
+	}
+	return n, err
+}
+
+func (c *Cache) trimPrefix(keys []string) []string {
+	r := make([]string, 0, len(keys))
+	for _, k := range keys {
+		r = append(r, strings.TrimPrefix(k, c.prefix))
+	}
+	return r
+}
+
+// escapePattern 转义 glob 特殊字符
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// keyGroup 返回 key 按 sep 切分后的前 depth 段
+func keyGroup(key, sep string, depth int) string {
+	parts := strings.SplitN(key, sep, depth+1)
+	if len(parts) > depth {
+		parts = parts[:depth]
+	}
+	return strings.Join(parts, sep)
+}
+
+// ttlBucket 返回 TTL 所属的区间名称
+func ttlBucket(ttl time.Duration) string {
+	switch {
+	case ttl < 0:
+		return TTLBuckets[0]
+	case ttl < time.Minute:
+		return TTLBuckets[1]
+	case ttl < time.Hour:
+		return TTLBuckets[2]
+	case ttl < 24*time.Hour:
+		return TTLBuckets[3]
+	case ttl < 7*24*time.Hour:
+		return TTLBuckets[4]
+	default:
+		return TTLBuckets[5]
+	}
+}
+
+// scanPacer 限制每秒处理的 key 数量
+type scanPacer struct {
+	rate  int
+	start time.Time
+	n     int64
+}
+
+func newScanPacer(rate int) *scanPacer {
+	return &scanPacer{rate: rate, start: time.Now()}
+}
+
+// wait 记录 n 个 key 并在超出速率时等待, ctx 结束时返回错误
+func (p *scanPacer) wait(ctx context.Context, n int) error {
+	if p.rate <= 0 {
+		return ctx.Err()
+	}
+	p.n += int64(n)
+	d := time.Duration(float64(p.n)/float64(p.rate)*float64(time.Second)) - time.Since(p.start)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,66 @@
+package redis
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheScan(t *testing.T) {
+	newTestClient(t)
+	c := New()
+	for i := 0; i < 25; i++ {
+		require.NoError(t, c.SetEX(fmt.Sprintf("user:%d", i), i, time.Hour*2))
+	}
+	require.NoError(t, c.Set("product-list:1", 1))
+	require.NoError(t, c.Set("a*b", 1))
+	require.NoError(t, New().EmptyPrefix().Set("other", 1))
+
+	var keys []string
+	err := c.ScanKeys("user:*", &ScanOptions{Count: 7, BatchSize: 10}, func(batch []string) error {
+		require.LessOrEqual(t, len(batch), 10)
+		keys = append(keys, batch...)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, keys, 25)
+	sort.Strings(keys)
+	require.Equal(t, "user:0", keys[0])
+
+	inv, err := c.Inventory("*", &ScanOptions{Sample: 5})
+	require.NoError(t, err)
+	require.Len(t, inv, 3)
+	require.Equal(t, int64(25), inv["user"].Count)
+	require.Equal(t, int64(5), inv["user"].Sampled)
+	require.Equal(t, map[string]int64{"<1d": 25}, inv["user"].TTL)
+	require.Equal(t, map[string]int64{"none": 1}, inv["product-list"].TTL)
+	require.Greater(t, inv["user"].EstBytes, int64(0))
+
+	n, err := c.DelPrefix("a*", nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+
+	n, err = c.DelByPattern("user:1*", &ScanOptions{Rate: 1000})
+	require.NoError(t, err)
+	require.Equal(t, int64(11), n)
+
+	n, err = c.Exists("user:2")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+	n, err = New().EmptyPrefix().Exists("other")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+}
+
+func TestMemoryMatch(t *testing.T) {
+	require.True(t, memoryMatch("user:*", "user:1"))
+	require.True(t, memoryMatch("h?llo", "hello"))
+	require.True(t, memoryMatch("h[ae]llo", "hallo"))
+	require.False(t, memoryMatch("h[^e]llo", "hello"))
+	require.True(t, memoryMatch("h[a-c]llo", "hbllo"))
+	require.True(t, memoryMatch(`a\*b`, "a*b"))
+	require.False(t, memoryMatch(`a\*b`, "aXb"))
+}
@@ -0,0 +1,631 @@
+package redis
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptClient 运行脚本测试的客户端
+type scriptClient struct {
+	name    string
+	client  Cmdable
+	now     func() time.Time
+	advance func(d time.Duration) // 推进过期时间及脚本中 TIME 的时钟
+}
+
+/**
+ * scriptClients 返回运行脚本测试的客户端, 同一用例在各客户端上的结果必须一致:
+ * 	memory    MemoryClient, 执行脚本的 Go 实现
+ * 	miniredis 执行脚本原文
+ * 	redis     设置 REDIS_TEST_ADDR 时连接真实 Redis, 使用 REDIS_TEST_DB(默认 15)并在前后清空该库, 通过 sleep 推进时钟
+ *
+ * Example:
+ *
+ * REDIS_TEST_ADDR=127.0.0.1:6379 go test ./redis -run Script
+ */
+func scriptClients(t *testing.T) []scriptClient {
+	start := time.Date(2024, 3, 6, 10, 0, 0, 0, time.Local)
+
+	mc := NewMemoryClient()
+	mc.SetTime(start)
+	clients := []scriptClient{{name: "memory", client: mc, now: mc.Now, advance: mc.Advance}}
+
+	mr := miniredis.RunT(t)
+	mr.SetTime(start)
+	mrc := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { mrc.Close() })
+	clients = append(clients, scriptClient{
+		name:   "miniredis",
+		client: mrc,
+		now:    func() time.Time { return start },
+		advance: func(d time.Duration) {
+			start = start.Add(d)
+			mr.SetTime(start)
+			mr.FastForward(d)
+		},
+	})
+
+	if addr := os.Getenv("REDIS_TEST_ADDR"); addr != "" {
+		db := 15
+		if s := os.Getenv("REDIS_TEST_DB"); s != "" {
+			db, _ = strconv.Atoi(s)
+		}
+		rc := redis.NewClient(&redis.Options{Addr: addr, Password: os.Getenv("REDIS_TEST_PASSWORD"), DB: db})
+		require.NoError(t, rc.FlushDB(context.Background()).Err())
+		t.Cleanup(func() {
+			rc.FlushDB(context.Background())
+			rc.Close()
+		})
+		clients = append(clients, scriptClient{name: "redis", client: rc, now: time.Now, advance: time.Sleep})
+	}
+	return clients
+}
+
+// forEachScriptClient 依次将各客户端设为默认客户端后运行 fn
+func forEachScriptClient(t *testing.T, fn func(t *testing.T, sc scriptClient)) {
+	for _, sc := range scriptClients(t) {
+		t.Run(sc.name, func(t *testing.T) {
+			SetDefaultClient(sc.client)
+			t.Cleanup(func() { SetDefaultClient(nil) })
+			fn(t, sc)
+		})
+	}
+}
+
+func TestScriptLock(t *testing.T) {
+	forEachScriptClient(t, func(t *testing.T, sc scriptClient) {
+		l1, l2 := NewLock("job"), NewLock("job")
+
+		ok, err := l1.Lock(100 * time.Millisecond)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, int64(1), l1.Token())
+
+		ok, err = l2.Lock(100 * time.Millisecond)
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		sc.advance(150 * time.Millisecond)
+		ok, err = l2.Lock(time.Second)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, int64(2), l2.Token())
+
+		require.NoError(t, l2.Extend(2*time.Second))
+
+		require.ErrorIs(t, l1.Unlock(), ErrNotHeld)
+		require.NoError(t, l2.Unlock())
+
+		// fencing token 计数器随锁续期, 不会永久保留
+		ttl, err := sc.client.PTTL(context.Background(), l2.fenceKey()).Result()
+		require.NoError(t, err)
+		require.InDelta(t, fenceTTL, ttl, float64(time.Second))
+	})
+}
+
+func TestScriptLockNoExpire(t *testing.T) {
+	forEachScriptClient(t, func(t *testing.T, sc scriptClient) {
+		l := NewLock("forever")
+
+		ok, err := l.Lock(0)
+		require.NoError(t, err)
+		require.True(t, ok)
+		ttl, err := l.TTL()
+		require.NoError(t, err)
+		require.Equal(t, time.Duration(-1), ttl)
+
+		require.NoError(t, l.Extend(time.Minute))
+		require.NoError(t, l.Extend(0))
+		ttl, err = l.TTL()
+		require.NoError(t, err)
+		require.Equal(t, time.Duration(-1), ttl)
+		require.NoError(t, l.Unlock())
+	})
+}
+
+func TestScriptLockUnlockAfterCancel(t *testing.T) {
+	forEachScriptClient(t, func(t *testing.T, sc scriptClient) {
+		ctx, cancel := context.WithCancel(context.Background())
+		base := NewLock("request")
+		l := base.WithContext(ctx)
+		require.NotSame(t, base, l)
+
+		ok, err := l.Lock(0)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, l.Token(), base.Token()) // 副本共享持有状态
+
+		// 请求结束后 defer 中的 Unlock 仍能释放不过期的锁
+		cancel()
+		require.NoError(t, l.Unlock())
+		ok, err = NewLock("request").Lock(time.Second)
+		require.NoError(t, err)
+		require.True(t, ok)
+	})
+}
+
+func TestScriptReentrantLock(t *testing.T) {
+	forEachScriptClient(t, func(t *testing.T, sc scriptClient) {
+		l1, l2 := NewReentrantLock("order", "a"), NewReentrantLock("order", "b")
+
+		for i := 0; i < 2; i++ {
+			ok, err := l1.Lock(time.Second)
+			require.NoError(t, err)
+			require.True(t, ok)
+		}
+		ok, err := l2.Lock(time.Second)
+		require.NoError(t, err)
+		require.False(t, ok)
+		require.NoError(t, l1.Extend(2*time.Second))
+
+		n, err := l1.Unlock()
+		require.NoError(t, err)
+		require.Equal(t, int64(1), n)
+		ok, err = l2.Lock(time.Second)
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		n, err = l1.Unlock()
+		require.NoError(t, err)
+		require.Equal(t, int64(0), n)
+		ok, err = l2.Lock(time.Second)
+		require.NoError(t, err)
+		require.True(t, ok)
+	})
+}
+
+func TestScriptReentrantLockNoExpire(t *testing.T) {
+	forEachScriptClient(t, func(t *testing.T, sc scriptClient) {
+		l := NewReentrantLock("forever", "a")
+
+		ok, err := l.Lock(0)
+		require.NoError(t, err)
+		require.True(t, ok)
+		ttl, err := sc.client.PTTL(context.Background(), l.FullKey()).Result()
+		require.NoError(t, err)
+		require.Equal(t, time.Duration(-1), ttl)
+
+		require.NoError(t, l.Extend(time.Minute))
+		require.NoError(t, l.Extend(0))
+		sc.advance(2 * time.Minute)
+		n, err := l.Count()
+		require.NoError(t, err)
+		require.Equal(t, int64(1), n)
+		n, err = l.Unlock()
+		require.NoError(t, err)
+		require.Equal(t, int64(0), n)
+	})
+}
+
+func TestScriptRWLock(t *testing.T) {
+	forEachScriptClient(t, func(t *testing.T, sc scriptClient) {
+		r1, r2, w := NewRWLock("doc"), NewRWLock("doc"), NewRWLock("doc")
+
+		for _, l := range []*RWLock{r1, r2} {
+			ok, err := l.RLock(time.Second)
+			require.NoError(t, err)
+			require.True(t, ok)
+		}
+		ok, err := w.Lock(time.Second)
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		require.NoError(t, r1.RUnlock())
+		require.NoError(t, r2.RUnlock())
+		ok, err = w.Lock(time.Second)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		ok, err = r1.RLock(time.Second)
+		require.NoError(t, err)
+		require.False(t, ok)
+		require.NoError(t, w.Unlock())
+	})
+}
+
+func TestScriptRWLockExpire(t *testing.T) {
+	forEachScriptClient(t, func(t *testing.T, sc scriptClient) {
+		crashed, r, w := NewRWLock("doc"), NewRWLock("doc"), NewRWLock("doc")
+
+		// 崩溃的读者到期后被清理, 不会因其他读者续期而一直阻塞写者
+		ok, err := crashed.RLock(100 * time.Millisecond)
+		require.NoError(t, err)
+		require.True(t, ok)
+		sc.advance(50 * time.Millisecond)
+		ok, err = r.RLock(time.Second)
+		require.NoError(t, err)
+		require.True(t, ok)
+		sc.advance(100 * time.Millisecond)
+		require.ErrorIs(t, crashed.RUnlock(), ErrNotHeld)
+		require.NoError(t, r.RUnlock())
+		ok, err = w.Lock(100 * time.Millisecond)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		// 写者到期后读者可获取
+		sc.advance(150 * time.Millisecond)
+		ok, err = r.RLock(0)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.ErrorIs(t, w.Unlock(), ErrNotHeld)
+
+		// expire <= 0 的持有者不过期
+		ttl, err := sc.client.PTTL(context.Background(), r.FullKey()).Result()
+		require.NoError(t, err)
+		require.Equal(t, time.Duration(-1), ttl)
+		ok, err = crashed.RLock(100 * time.Millisecond)
+		require.NoError(t, err)
+		require.True(t, ok)
+		sc.advance(150 * time.Millisecond)
+		ok, err = w.Lock(0)
+		require.NoError(t, err)
+		require.False(t, ok)
+		require.NoError(t, r.RUnlock())
+		ok, err = w.Lock(0)
+		require.NoError(t, err)
+		require.True(t, ok)
+		sc.advance(time.Hour)
+		ok, err = r.RLock(time.Second)
+		require.NoError(t, err)
+		require.False(t, ok)
+		require.NoError(t, w.Unlock())
+	})
+}
+
+func TestScriptSemaphore(t *testing.T) {
+	forEachScriptClient(t, func(t *testing.T, sc scriptClient) {
+		s1, s2, s3 := NewSemaphore("api", 2), NewSemaphore("api", 2), NewSemaphore("api", 2)
+
+		for _, s := range []*Semaphore{s1, s2} {
+			ok, err := s.TryAcquire(100 * time.Millisecond)
+			require.NoError(t, err)
+			require.True(t, ok)
+		}
+		ok, err := s3.TryAcquire(100 * time.Millisecond)
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		require.NoError(t, s1.Release())
+		ok, err = s3.TryAcquire(100 * time.Millisecond)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		sc.advance(150 * time.Millisecond)
+		n, err := s2.Count()
+		require.NoError(t, err)
+		require.Equal(t, int64(0), n)
+	})
+}
+
+func TestScriptSemaphoreNoExpire(t *testing.T) {
+	forEachScriptClient(t, func(t *testing.T, sc scriptClient) {
+		s1, s2 := NewSemaphore("forever", 2), NewSemaphore("forever", 2)
+
+		ok, err := s1.TryAcquire(0)
+		require.NoError(t, err)
+		require.True(t, ok)
+		ok, err = s2.TryAcquire(100 * time.Millisecond)
+		require.NoError(t, err)
+		require.True(t, ok)
+		ttl, err := sc.client.PTTL(context.Background(), s1.FullKey()).Result()
+		require.NoError(t, err)
+		require.Equal(t, time.Duration(-1), ttl)
+
+		sc.advance(time.Hour)
+		n, err := s1.Count()
+		require.NoError(t, err)
+		require.Equal(t, int64(1), n)
+		require.ErrorIs(t, s2.Extend(0), ErrNotHeld)
+
+		// 不过期的持有者释放后, key 随剩余持有者过期
+		require.NoError(t, s1.Extend(time.Minute))
+		ttl, err = sc.client.PTTL(context.Background(), s1.FullKey()).Result()
+		require.NoError(t, err)
+		require.InDelta(t, time.Minute, ttl, float64(time.Second))
+		require.NoError(t, s1.Release())
+	})
+}
+
+func TestScriptReleaseAfterCancel(t *testing.T) {
+	forEachScriptClient(t, func(t *testing.T, sc scriptClient) {
+		ctx, cancel := context.WithCancel(context.Background())
+		rl := NewReentrantLock("order", "a").WithContext(ctx)
+		rw := NewRWLock("doc").WithContext(ctx)
+		sem := NewSemaphore("api", 1).WithContext(ctx)
+
+		ok, err := rl.Lock(0)
+		require.NoError(t, err)
+		require.True(t, ok)
+		ok, err = rw.Lock(0)
+		require.NoError(t, err)
+		require.True(t, ok)
+		ok, err = sem.TryAcquire(0)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		cancel()
+		n, err := rl.Unlock()
+		require.NoError(t, err)
+		require.Equal(t, int64(0), n)
+		require.NoError(t, rw.Unlock())
+		require.NoError(t, sem.Release())
+	})
+}
+
+func TestScriptWorkerLease(t *testing.T) {
+	forEachScriptClient(t, func(t *testing.T, sc scriptClient) {
+		ctx := context.Background()
+		used := time.UnixMilli(time.Now().UnixMilli())
+
+		// 正常释放时记录最近使用时间
+		l1 := NewWorkerLease("order", 1).WithLastUsed(func() time.Time { return used })
+		id, err := l1.Acquire(ctx, time.Minute)
+		require.NoError(t, err)
+		require.Equal(t, int64(0), id)
+		require.True(t, l1.PrevUsed().IsZero())
+		require.NoError(t, l1.Release())
+
+		leaseCtx, crash := context.WithCancel(ctx)
+		l2 := NewWorkerLease("order", 1).WithContext(leaseCtx).WithLastUsed(func() time.Time { return used })
+		_, err = l2.Acquire(ctx, 300*time.Millisecond)
+		require.NoError(t, err)
+		require.Equal(t, used, l2.PrevUsed())
+
+		// 持有者崩溃后, 新的持有者得到其租约截止时间
+		crash()
+		sc.advance(400 * time.Millisecond)
+		l3 := NewWorkerLease("order", 1)
+		_, err = l3.Acquire(ctx, time.Minute)
+		require.NoError(t, err)
+		require.True(t, l3.PrevUsed().After(used))
+		require.WithinDuration(t, time.Now(), l3.PrevUsed(), time.Second)
+
+		// 已失去租约的持有者释放时不会覆盖记录
+		require.NoError(t, l2.Release())
+		ms, err := sc.client.Get(ctx, usedKey(l3.lock)).Int64()
+		require.NoError(t, err)
+		require.WithinDuration(t, time.Now().Add(time.Minute), time.UnixMilli(ms), time.Second)
+		require.NoError(t, l3.Release())
+	})
+}
+
+func TestScriptRateLimiter(t *testing.T) {
+	forEachScriptClient(t, func(t *testing.T, sc scriptClient) {
+		for _, alg := range []RateLimitAlgorithm{FixedWindow, SlidingWindowLog, TokenBucket} {
+			r := NewRateLimiter(alg, 3, 200*time.Millisecond)
+			for i := 0; i < 3; i++ {
+				res, err := r.Allow("ip")
+				require.NoError(t, err)
+				require.True(t, res.Allowed, "algorithm %d request %d", alg, i)
+			}
+			res, err := r.Allow("ip")
+			require.NoError(t, err)
+			require.False(t, res.Allowed)
+			require.Greater(t, res.RetryAfter, time.Duration(0))
+
+			sc.advance(250 * time.Millisecond)
+			res, err = r.Allow("ip")
+			require.NoError(t, err)
+			require.True(t, res.Allowed)
+			require.NoError(t, r.Reset("ip"))
+		}
+	})
+}
+
+func TestScriptLeaderboard(t *testing.T) {
+	forEachScriptClient(t, func(t *testing.T, sc scriptClient) {
+		lb := NewLeaderboard("game", PeriodDay)
+		now := sc.now()
+
+		_, err := lb.IncrAt("a", 10, now)
+		require.NoError(t, err)
+		_, err = lb.IncrAt("b", 10, now.Add(time.Second))
+		require.NoError(t, err)
+		_, err = lb.IncrAt("c", 5, now.Add(time.Second))
+		require.NoError(t, err)
+
+		top, err := lb.Top(lb.PeriodKey(PeriodDay, now), 3)
+		require.NoError(t, err)
+		require.Equal(t, []LeaderboardEntry{
+			{Member: "a", Score: 10, Rank: 1},
+			{Member: "b", Score: 10, Rank: 2},
+			{Member: "c", Score: 5, Rank: 3},
+		}, top)
+	})
+}
+
+func TestScriptLeaderboardMerge(t *testing.T) {
+	forEachScriptClient(t, func(t *testing.T, sc scriptClient) {
+		lb := NewLeaderboard("game", PeriodDay)
+		today := sc.now()
+		yesterday := today.AddDate(0, 0, -1)
+
+		for _, v := range []struct {
+			member string
+			delta  int64
+			tm     time.Time
+		}{
+			{"a", 10, yesterday},
+			{"b", 4, yesterday},
+			{"b", 6, today},
+			{"c", -3, today},
+		} {
+			_, err := lb.IncrAt(v.member, v.delta, v.tm)
+			require.NoError(t, err)
+		}
+
+		n, err := lb.Merge("2d", PeriodDay, yesterday, today, 1500*time.Millisecond)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), n)
+
+		// 同分时上榜周期多的排在前面
+		top, err := lb.Top(lb.MergedKey("2d"), 3)
+		require.NoError(t, err)
+		require.Equal(t, []LeaderboardEntry{
+			{Member: "b", Score: 10, Rank: 1},
+			{Member: "a", Score: 10, Rank: 2},
+			{Member: "c", Score: -3, Rank: 3},
+		}, top)
+
+		ttl, err := sc.client.PTTL(context.Background(), lb.MergedKey("2d")).Result()
+		require.NoError(t, err)
+		require.InDelta(t, 1500*time.Millisecond, ttl, float64(100*time.Millisecond))
+
+		_, err = lb.Merge("40d", PeriodDay, today.AddDate(0, 0, -39), today, 0)
+		require.Error(t, err)
+	})
+}
+
+func TestScriptActivityBitmap(t *testing.T) {
+	forEachScriptClient(t, func(t *testing.T, sc scriptClient) {
+		act := NewActivityBitmap("login")
+		today := sc.now()
+		yesterday := today.AddDate(0, 0, -1)
+
+		require.NoError(t, act.Mark(yesterday, 1))
+		require.NoError(t, act.Mark(yesterday, 2))
+		require.NoError(t, act.Mark(today, 2))
+
+		n, err := act.CountActiveAll(yesterday, today)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), n)
+
+		n, err = act.Streak(2, today, 7)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), n)
+
+		// 写入时同时设置过期时间
+		ttl, err := sc.client.TTL(context.Background(), act.DayKey(today)).Result()
+		require.NoError(t, err)
+		require.Greater(t, ttl, time.Duration(0))
+	})
+}
+
+func TestScriptUniqueCounter(t *testing.T) {
+	forEachScriptClient(t, func(t *testing.T, sc scriptClient) {
+		uv := NewUniqueCounter("dau")
+		today := sc.now()
+		yesterday := today.AddDate(0, 0, -1)
+
+		require.NoError(t, uv.Add(yesterday, "a", "b"))
+		require.NoError(t, uv.Add(today, "b", "c", "c"))
+		require.NoError(t, uv.Add(today))
+
+		n, err := uv.Count(today)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), n)
+		// miniredis 多 key 的 PFCOUNT 未去重
+		if sc.name != "miniredis" {
+			n, err = uv.CountRange(yesterday, today)
+			require.NoError(t, err)
+			require.Equal(t, int64(3), n)
+		}
+
+		ttl, err := sc.client.TTL(context.Background(), uv.DayKey(today)).Result()
+		require.NoError(t, err)
+		require.Greater(t, ttl, 90*24*time.Hour)
+
+		key, err := uv.MergeRange("2d", yesterday, today, 1500*time.Millisecond)
+		require.NoError(t, err)
+		n, err = sc.client.PFCount(context.Background(), key).Result()
+		require.NoError(t, err)
+		require.Equal(t, int64(3), n)
+		pttl, err := sc.client.PTTL(context.Background(), key).Result()
+		require.NoError(t, err)
+		require.InDelta(t, 1500*time.Millisecond, pttl, float64(100*time.Millisecond))
+
+		// 超出 unpack 限制的成员数量分批写入
+		members := make([]string, 10000)
+		for i := range members {
+			members[i] = strconv.Itoa(i)
+		}
+		require.NoError(t, uv.Add(yesterday, members...))
+		n, err = uv.Count(yesterday)
+		require.NoError(t, err)
+		require.InEpsilon(t, 10002, n, 0.02)
+
+		// 空区间
+		n, err = uv.CountRange(today, yesterday)
+		require.NoError(t, err)
+		require.Equal(t, int64(0), n)
+		key, err = uv.MergeRange("empty", today, yesterday, 0)
+		require.NoError(t, err)
+		n, err = sc.client.PFCount(context.Background(), key).Result()
+		require.NoError(t, err)
+		require.Equal(t, int64(0), n)
+
+		// 不过期
+		noExpire := NewUniqueCounter("wau").SetExpire(0)
+		require.NoError(t, noExpire.Add(today, "a"))
+		ttl, err = sc.client.TTL(context.Background(), noExpire.DayKey(today)).Result()
+		require.NoError(t, err)
+		require.Equal(t, time.Duration(-1), ttl)
+	})
+}
+
+func TestScriptCounter(t *testing.T) {
+	forEachScriptClient(t, func(t *testing.T, sc scriptClient) {
+		c := New()
+
+		for i := int64(1); i <= 2; i++ {
+			n, err := c.IncrEX("fail", 100*time.Millisecond)
+			require.NoError(t, err)
+			require.Equal(t, i, n)
+		}
+		sc.advance(150 * time.Millisecond)
+		n, err := c.IncrEX("fail", 100*time.Millisecond)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), n)
+
+		// 自减不低于 0 且保留过期时间, 不存在的 key 不会被创建
+		for i := 0; i < 2; i++ {
+			n, err = c.DecrIfPositive("fail")
+			require.NoError(t, err)
+			require.Equal(t, int64(0), n)
+		}
+		ttl, err := c.PTTL("fail")
+		require.NoError(t, err)
+		require.Greater(t, ttl, time.Duration(0))
+		n, err = c.DecrIfPositive("missing")
+		require.NoError(t, err)
+		require.Equal(t, int64(0), n)
+		n, err = c.Exists("missing")
+		require.NoError(t, err)
+		require.Equal(t, int64(0), n)
+
+		ok, err := c.SetMax("step", 5, time.Minute)
+		require.NoError(t, err)
+		require.True(t, ok)
+		ok, err = c.SetMax("step", 5, time.Minute)
+		require.NoError(t, err)
+		require.False(t, ok)
+		ok, err = c.SetMax("step", 6, time.Minute)
+		require.NoError(t, err)
+		require.True(t, ok)
+	})
+}
+
+func TestScriptSReplace(t *testing.T) {
+	forEachScriptClient(t, func(t *testing.T, sc scriptClient) {
+		c := New()
+
+		_, err := c.SAdd("codes", "old")
+		require.NoError(t, err)
+		require.NoError(t, c.SReplace("codes", []string{"a", "b"}, time.Minute))
+		members, err := c.SMembers("codes")
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"a", "b"}, members)
+
+		require.NoError(t, c.SReplace("codes", nil, 0))
+		n, err := c.Exists("codes")
+		require.NoError(t, err)
+		require.Equal(t, int64(0), n)
+	})
+}
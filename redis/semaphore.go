@@ -0,0 +1,248 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 信号量使用 sorted set 保存持有者, score 为毫秒级过期时间(不过期为 +inf), 每次操作先清理已过期的持有者, key 的过期时间与最晚过期的持有者一致
+const (
+	// semHold 记录持有者 ARGV[1] 的过期时间, ttl 不大于 0 时不过期
+	semHold = `
+if ttl > 0 then
+	redis.call("ZADD", KEYS[1], now + ttl, ARGV[1])
+else
+	redis.call("ZADD", KEYS[1], "+inf", ARGV[1])
+end
+if redis.call("ZCOUNT", KEYS[1], "+inf", "+inf") > 0 then
+	redis.call("PERSIST", KEYS[1])
+else
+	redis.call("PEXPIREAT", KEYS[1], redis.call("ZRANGE", KEYS[1], -1, -1, "WITHSCORES")[2])
+end
+return 1`
+)
+
+var (
+	// semAcquireScript 持有者数量小于上限时加入, 已持有时刷新过期时间
+	semAcquireScript = newScript(`
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now)
+if redis.call("ZSCORE", KEYS[1], ARGV[1]) == false and redis.call("ZCARD", KEYS[1]) >= tonumber(ARGV[2]) then
+	return 0
+end
+local ttl = tonumber(ARGV[3])`+semHold, memSemAcquire)
+
+	// semExtendScript 未过期的持有者刷新过期时间
+	semExtendScript = newScript(`
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now)
+if redis.call("ZSCORE", KEYS[1], ARGV[1]) == false then
+	return 0
+end
+local ttl = tonumber(ARGV[2])`+semHold, memSemExtend)
+
+	// semCountScript 返回未过期的持有者数量
+	semCountScript = newScript(`
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+return redis.call("ZCOUNT", KEYS[1], "(" .. now, "+inf")`, memSemCount)
+)
+
+// memSemHold 对应 semHold
+func memSemHold(m *MemoryClient, it *memoryItem, member string, ttl int64) {
+	it.zset[member] = math.Inf(1)
+	if ttl > 0 {
+		it.zset[member] = float64(m.nowMs() + ttl)
+	}
+	it.expireAt = memZExpireAt(it)
+}
+
+func memSemAcquire(m *MemoryClient, keys, args []string) (interface{}, error) {
+	it, err := m.create(keys[0], memoryZSet)
+	if err != nil {
+		return nil, err
+	}
+	memZRemRangeByScore(it, math.Inf(-1), float64(m.nowMs()))
+	if _, ok := it.zset[args[0]]; !ok && int64(len(it.zset)) >= memInt(args[1]) {
+		m.cleanup(keys[0], it)
+		return int64(0), nil
+	}
+	memSemHold(m, it, args[0], memInt(args[2]))
+	return int64(1), nil
+}
+
+func memSemExtend(m *MemoryClient, keys, args []string) (interface{}, error) {
+	it, err := m.lookupKind(keys[0], memoryZSet)
+	if err != nil || it == nil {
+		return int64(0), err
+	}
+	memZRemRangeByScore(it, math.Inf(-1), float64(m.nowMs()))
+	if _, ok := it.zset[args[0]]; !ok {
+		m.cleanup(keys[0], it)
+		return int64(0), nil
+	}
+	memSemHold(m, it, args[0], memInt(args[1]))
+	return int64(1), nil
+}
+
+func memSemCount(m *MemoryClient, keys, args []string) (interface{}, error) {
+	now := float64(m.nowMs())
+	it, err := m.lookupKind(keys[0], memoryZSet)
+	if err != nil || it == nil {
+		return int64(0), err
+	}
+	var n int64
+	for _, score := range it.zset {
+		if score > now {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Semaphore 分布式计数信号量, 限制跨副本的并发数, 持有者崩溃后在过期时间到达时自动释放
+type Semaphore struct {
+	ctx     context.Context
+	timeout time.Duration
+	client  Cmdable
+	prefix  string
+	rawKey  string
+	limit   int64
+	tag     string
+}
+
+/**
+ * NewSemaphore 创建信号量, 使用默认的前缀格式：<KeyPrefix>.semaphore.<rawKey>
+ * limit 为最大并发数, 每个实例代表一个许可的持有者
+ *
+ * Example:
+ *
+ * sem := redis.NewSemaphore("third-party-api", 10)
+ * if err := sem.Acquire(ctx, 30*time.Second); err != nil {
+ * 	return err
+ * }
+ * defer sem.Release()
+ */
+func NewSemaphore(key string, limit int64) *Semaphore {
+	if limit <= 0 {
+		limit = 1
+	}
+	uid, _ := uuid.NewRandom()
+	return &Semaphore{
+		ctx:    context.Background(),
+		prefix: fmt.Sprintf("%s.semaphore.", KeyPrefix),
+		rawKey: key,
+		limit:  limit,
+		tag:    uid.String(),
+	}
+}
+
+// SetPrefix 设置前缀
+func (s *Semaphore) SetPrefix(prefix string) *Semaphore {
+	s.prefix = prefix
+	return s
+}
+
+// EmptyPrefix 清空前缀
+func (s *Semaphore) EmptyPrefix() *Semaphore {
+	s.prefix = ""
+	return s
+}
+
+// WithContext 返回使用 ctx 的副本, 释放操作不受 ctx 取消影响
+func (s *Semaphore) WithContext(ctx context.Context) *Semaphore {
+	if ctx == nil {
+		panic("redis: nil context")
+	}
+	r := *s
+	r.ctx = ctx
+	return &r
+}
+
+// WithTimeout 返回设置了单条命令超时时间的副本, timeout <= 0 表示不限制
+func (s *Semaphore) WithTimeout(timeout time.Duration) *Semaphore {
+	r := *s
+	r.timeout = timeout
+	return &r
+}
+
+// WithClient 返回使用指定客户端的副本, c 为 nil 时使用 DefaultClient()
+func (s *Semaphore) WithClient(c Cmdable) *Semaphore {
+	r := *s
+	r.client = c
+	return &r
+}
+
+// Client 返回使用的客户端
+func (s *Semaphore) Client() Cmdable {
+	return pick(s.client)
+}
+
+// FullKey 返回拼接后的完整 Redis key
+func (s *Semaphore) FullKey() string {
+	return s.prefix + s.rawKey
+}
+
+// Limit 返回最大并发数
+func (s *Semaphore) Limit() int64 {
+	return s.limit
+}
+
+// TryAcquire 尝试获取一个许可, expire <= 0 表示不过期, 许可已用完时返回 false
+func (s *Semaphore) TryAcquire(expire time.Duration) (bool, error) {
+	ctx, cancel := withTimeout(s.ctx, s.timeout)
+	defer cancel()
+	n, err := semAcquireScript.Run(ctx, s.Client(), []string{s.FullKey()}, s.tag, s.limit, expire.Milliseconds()).Int64()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// Acquire 在 ctx 结束前等待获取许可, 超时返回 ErrNotObtained
+func (s *Semaphore) Acquire(ctx context.Context, expire time.Duration) error {
+	return acquireLoop(ctx, defaultMinBackoff, defaultMaxBackoff, func() (bool, error) {
+		return s.TryAcquire(expire)
+	})
+}
+
+// Extend 重置许可的过期时间, expire <= 0 表示不过期, 未持有或已过期时返回 ErrNotHeld
+func (s *Semaphore) Extend(expire time.Duration) error {
+	ctx, cancel := withTimeout(s.ctx, s.timeout)
+	defer cancel()
+	n, err := semExtendScript.Run(ctx, s.Client(), []string{s.FullKey()}, s.tag, expire.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotHeld
+	}
+	return nil
+}
+
+// Release 释放许可, 未持有时返回 ErrNotHeld
+func (s *Semaphore) Release() error {
+	ctx, cancel := releaseContext(s.ctx, s.timeout)
+	defer cancel()
+	n, err := s.Client().ZRem(ctx, s.FullKey(), s.tag).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotHeld
+	}
+	return nil
+}
+
+// Count 返回当前已被持有的许可数量
+func (s *Semaphore) Count() (int64, error) {
+	ctx, cancel := withTimeout(s.ctx, s.timeout)
+	defer cancel()
+	return semCountScript.Run(ctx, s.Client(), []string{s.FullKey()}).Int64()
+}
@@ -0,0 +1,451 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/scrawld/zaplog"
+)
+
+var (
+	// getPTTLScript 返回值及 key 的剩余毫秒数, key 不存在时返回 nil
+	getPTTLScript = newScript(`
+local v = redis.call("GET", KEYS[1])
+if not v then
+	return false
+end
+return {v, redis.call("PTTL", KEYS[1])}`, memGetPTTL)
+
+	// hgetPTTLScript 返回 hash 字段的值及 key 的剩余毫秒数, 字段不存在时返回 nil
+	hgetPTTLScript = newScript(`
+local v = redis.call("HGET", KEYS[1], ARGV[1])
+if not v then
+	return false
+end
+return {v, redis.call("PTTL", KEYS[1])}`, memHGetPTTL)
+)
+
+func memGetPTTL(m *MemoryClient, keys, args []string) (interface{}, error) {
+	v, ok, err := m.getString(keys[0])
+	if err != nil || !ok {
+		return nil, err
+	}
+	return []interface{}{v, m.pttl(keys[0])}, nil
+}
+
+func memHGetPTTL(m *MemoryClient, keys, args []string) (interface{}, error) {
+	it, err := m.lookupKind(keys[0], memoryHash)
+	if err != nil || it == nil {
+		return nil, err
+	}
+	v, ok := it.hash[args[0]]
+	if !ok {
+		return nil, nil
+	}
+	return []interface{}{v, m.pttl(keys[0])}, nil
+}
+
+// cacheInvalidation 缓存失效广播
+type cacheInvalidation struct {
+	Origin string   `json:"origin"` // 发送方实例 ID, 发送方已自行更新本地缓存
+	Keys   []string `json:"keys"`   // 完整的 redis key
+}
+
+// TieredCacheStats 各级缓存的命中统计
+type TieredCacheStats struct {
+	LocalHits    int64 // 本地缓存命中
+	LocalMisses  int64 // 本地缓存未命中
+	RemoteHits   int64 // redis 命中
+	RemoteMisses int64 // redis 未命中
+	LocalSize    int   // 本地缓存条目数
+}
+
+type tieredStats struct {
+	localHits, localMisses, remoteHits, remoteMisses atomic.Int64
+}
+
+// TieredCache 两级缓存, 进程内 LRU 位于 redis.Cache 之前, 写操作通过 Pub/Sub 广播使其他副本的本地缓存失效
+// 提供 Cache 中字符串、计数器与 hash 的读写方法, 仅 Get/GetInt64/HGet/Exists 使用本地缓存;
+// 集合、标签、扫描等其他操作通过 Remote() 调用, 修改已缓存的 key 后需调用 Invalidate
+type TieredCache struct {
+	cache    *Cache
+	local    *localCache
+	localTTL time.Duration
+	stats    *tieredStats
+	origin   string
+	topic    *Topic[cacheInvalidation]
+	bus      *EventBus
+	once     *sync.Once
+	log      *zaplog.TracingLogger
+}
+
+/**
+ * NewTieredCache 创建两级缓存, size 为本地缓存的最大条目数, localTTL 为本地缓存的最长保留时间
+ * 本地缓存的保留时间同时不超过读取时 redis key 的剩余过期时间, key 在 redis 中过期后本地缓存随之失效
+ * key 前缀与 New() 一致, 失效广播使用频道 <KeyPrefix>.event.cache-invalidate
+ * 广播为尽力而为, 断线期间错过的失效通过重连后清空本地缓存和 localTTL 兜底
+ *
+ * Example:
+ *
+ * var configCache = redis.NewTieredCache(1000, time.Minute)
+ *
+ * v, err := configCache.WithContext(ctx).Get("price")
+ * configCache.Set("price", "100") // 所有副本的本地缓存失效
+ *
+ * // 退出时
+ * configCache.Close()
+ */
+func NewTieredCache(size int, localTTL time.Duration) *TieredCache {
+	if localTTL <= 0 {
+		localTTL = time.Minute
+	}
+	uid, _ := uuid.NewRandom()
+	t := &TieredCache{
+		cache:    New(),
+		local:    newLocalCache(size),
+		localTTL: localTTL,
+		stats:    &tieredStats{},
+		origin:   uid.String(),
+		topic:    NewTopic[cacheInvalidation]("cache-invalidate"),
+		bus:      NewEventBus(),
+		once:     &sync.Once{},
+		log:      zaplog.New().Named("TieredCache"),
+	}
+	return t
+}
+
+// subscribe 首次使用时订阅失效广播, 避免在包初始化阶段连接 redis
+func (t *TieredCache) subscribe() {
+	t.once.Do(func() {
+		local, origin := t.local, t.origin
+		Subscribe(t.bus, t.topic, func(ctx context.Context, e cacheInvalidation) error {
+			if e.Origin != origin {
+				local.del(e.Keys...)
+			}
+			return nil
+		}, OnReconnect(local.purge))
+	})
+}
+
+// SetPrefix 设置前缀
+func (t *TieredCache) SetPrefix(prefix string) *TieredCache {
+	t.cache.SetPrefix(prefix)
+	return t
+}
+
+// EmptyPrefix 清空前缀
+func (t *TieredCache) EmptyPrefix() *TieredCache {
+	t.cache.EmptyPrefix()
+	return t
+}
+
+// WithContext 返回使用 ctx 的副本, 与原实例共享本地缓存
+func (t *TieredCache) WithContext(ctx context.Context) *TieredCache {
+	r := *t
+	r.cache = t.cache.WithContext(ctx)
+	return &r
+}
+
+// WithTimeout 返回设置单条命令超时时间的副本, 与原实例共享本地缓存
+func (t *TieredCache) WithTimeout(timeout time.Duration) *TieredCache {
+	r := *t
+	r.cache = t.cache.WithTimeout(timeout)
+	return &r
+}
+
+// SetClient 设置使用的客户端, 包括失效广播, 需在首次使用前调用
+func (t *TieredCache) SetClient(c Cmdable) *TieredCache {
+	t.cache = t.cache.WithClient(c)
+	t.topic.WithClient(c)
+	return t
+}
+
+// Remote 返回底层的 redis 缓存
+func (t *TieredCache) Remote() *Cache {
+	return t.cache
+}
+
+// Stats 返回命中统计
+func (t *TieredCache) Stats() TieredCacheStats {
+	return TieredCacheStats{
+		LocalHits:    t.stats.localHits.Load(),
+		LocalMisses:  t.stats.localMisses.Load(),
+		RemoteHits:   t.stats.remoteHits.Load(),
+		RemoteMisses: t.stats.remoteMisses.Load(),
+		LocalSize:    t.local.len(),
+	}
+}
+
+// Purge 清空本实例的本地缓存
+func (t *TieredCache) Purge() {
+	t.local.purge()
+}
+
+// Close 停止接收失效广播
+func (t *TieredCache) Close() error {
+	return t.bus.Close()
+}
+
+func (t *TieredCache) Set(key string, val interface{}) error {
+	t.subscribe()
+	if err := t.cache.Set(key, val); err != nil {
+		return err
+	}
+	t.invalidate(key)
+	return nil
+}
+
+func (t *TieredCache) SetEX(key string, val interface{}, expire time.Duration) error {
+	t.subscribe()
+	if err := t.cache.SetEX(key, val, expire); err != nil {
+		return err
+	}
+	t.invalidate(key)
+	return nil
+}
+
+func (t *TieredCache) Get(key string) (string, error) {
+	t.subscribe()
+	fullKey := t.cache.prefix + key
+	if v, ok := t.local.get(fullKey); ok {
+		t.stats.localHits.Add(1)
+		return v, nil
+	}
+	t.stats.localMisses.Add(1)
+
+	seq := t.local.reserve(fullKey)
+	defer t.local.release(fullKey, seq)
+	v, ttl, err := t.remoteGet(getPTTLScript, fullKey)
+	if err == Nil {
+		t.stats.remoteMisses.Add(1)
+		return v, err
+	}
+	if err != nil {
+		return v, err
+	}
+	t.stats.remoteHits.Add(1)
+	if ttl > 0 {
+		t.local.fill(fullKey, seq, v, ttl)
+	}
+	return v, nil
+}
+
+func (t *TieredCache) GetInt64(key string) (int64, error) {
+	v, err := t.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+func (t *TieredCache) Del(keys ...string) error {
+	t.subscribe()
+	if err := t.cache.Del(keys...); err != nil {
+		return err
+	}
+	t.invalidate(keys...)
+	return nil
+}
+
+func (t *TieredCache) Exists(key string) (int64, error) {
+	t.subscribe()
+	if _, ok := t.local.get(t.cache.prefix + key); ok {
+		t.stats.localHits.Add(1)
+		return 1, nil
+	}
+	return t.cache.Exists(key)
+}
+
+func (t *TieredCache) Expire(key string, expiration time.Duration) (bool, error) {
+	t.subscribe()
+	ok, err := t.cache.Expire(key, expiration)
+	if err != nil {
+		return ok, err
+	}
+	t.invalidate(key)
+	return ok, nil
+}
+
+func (t *TieredCache) ExpireAt(key string, tm time.Time) (bool, error) {
+	t.subscribe()
+	ok, err := t.cache.ExpireAt(key, tm)
+	if err != nil {
+		return ok, err
+	}
+	t.invalidate(key)
+	return ok, nil
+}
+
+func (t *TieredCache) HGet(key string, field string) (string, error) {
+	t.subscribe()
+	fullKey := t.cache.prefix + key
+	if v, ok := t.local.hget(fullKey, field); ok {
+		t.stats.localHits.Add(1)
+		return v, nil
+	}
+	t.stats.localMisses.Add(1)
+
+	seq := t.local.reserve(fullKey)
+	defer t.local.release(fullKey, seq)
+	v, ttl, err := t.remoteGet(hgetPTTLScript, fullKey, field)
+	if err == Nil {
+		t.stats.remoteMisses.Add(1)
+		return v, err
+	}
+	if err != nil {
+		return v, err
+	}
+	t.stats.remoteHits.Add(1)
+	if ttl > 0 {
+		t.local.hfill(fullKey, seq, field, v, ttl)
+	}
+	return v, nil
+}
+
+func (t *TieredCache) HSet(key string, field string, val string) error {
+	t.subscribe()
+	if err := t.cache.HSet(key, field, val); err != nil {
+		return err
+	}
+	t.invalidate(key)
+	return nil
+}
+
+func (t *TieredCache) HDel(key string, field string) error {
+	t.subscribe()
+	if err := t.cache.HDel(key, field); err != nil {
+		return err
+	}
+	t.invalidate(key)
+	return nil
+}
+
+func (t *TieredCache) SetNX(key string, val interface{}, expire time.Duration) (bool, error) {
+	t.subscribe()
+	ok, err := t.cache.SetNX(key, val, expire)
+	if err != nil || !ok {
+		return ok, err
+	}
+	t.invalidate(key)
+	return true, nil
+}
+
+func (t *TieredCache) IncrEX(key string, expire time.Duration) (int64, error) {
+	t.subscribe()
+	n, err := t.cache.IncrEX(key, expire)
+	if err != nil {
+		return n, err
+	}
+	t.invalidate(key)
+	return n, nil
+}
+
+func (t *TieredCache) DecrIfPositive(key string) (int64, error) {
+	t.subscribe()
+	n, err := t.cache.DecrIfPositive(key)
+	if err != nil {
+		return n, err
+	}
+	t.invalidate(key)
+	return n, nil
+}
+
+func (t *TieredCache) SetMax(key string, val int64, expire time.Duration) (bool, error) {
+	t.subscribe()
+	ok, err := t.cache.SetMax(key, val, expire)
+	if err != nil || !ok {
+		return ok, err
+	}
+	t.invalidate(key)
+	return true, nil
+}
+
+// PTTL 返回 redis 中 key 的剩余过期时间, 不经过本地缓存
+func (t *TieredCache) PTTL(key string) (time.Duration, error) {
+	return t.cache.PTTL(key)
+}
+
+func (t *TieredCache) HIncrBy(key string, field string, incr int64) (int64, error) {
+	t.subscribe()
+	n, err := t.cache.HIncrBy(key, field, incr)
+	if err != nil {
+		return n, err
+	}
+	t.invalidate(key)
+	return n, nil
+}
+
+func (t *TieredCache) HIncrByFloat(key string, field string, incr float64) (float64, error) {
+	t.subscribe()
+	n, err := t.cache.HIncrByFloat(key, field, incr)
+	if err != nil {
+		return n, err
+	}
+	t.invalidate(key)
+	return n, nil
+}
+
+func (t *TieredCache) HSetStruct(key string, v interface{}, fields ...string) error {
+	t.subscribe()
+	if err := t.cache.HSetStruct(key, v, fields...); err != nil {
+		return err
+	}
+	t.invalidate(key)
+	return nil
+}
+
+// HGetAllInto 从 redis 读取整个 hash, 不经过本地缓存
+func (t *TieredCache) HGetAllInto(key string, dst interface{}) error {
+	return t.cache.HGetAllInto(key, dst)
+}
+
+// HGetInto 从 redis 读取指定字段, 不经过本地缓存
+func (t *TieredCache) HGetInto(key string, dst interface{}, fields ...string) error {
+	return t.cache.HGetInto(key, dst, fields...)
+}
+
+// Invalidate 使本实例及其他副本中 keys 的本地缓存失效, 通过 Remote() 修改已缓存的 key 后调用
+func (t *TieredCache) Invalidate(keys ...string) {
+	t.subscribe()
+	t.invalidate(keys...)
+}
+
+// remoteGet 从 redis 读取值及本地缓存的保留时间, 保留时间不超过 localTTL 和 key 的剩余过期时间
+func (t *TieredCache) remoteGet(script *redis.Script, fullKey string, args ...interface{}) (string, time.Duration, error) {
+	ctx, cancel := t.cache.cmdContext()
+	defer cancel()
+	res, err := script.Run(ctx, t.cache.Client(), []string{fullKey}, args...).Slice()
+	if err != nil {
+		return "", 0, err
+	}
+	if len(res) != 2 {
+		return "", 0, fmt.Errorf("unexpected script result %v", res)
+	}
+	v, _ := res[0].(string)
+	ttl := t.localTTL
+	if ms, _ := res[1].(int64); ms >= 0 {
+		ttl = min(ttl, time.Duration(ms)*time.Millisecond)
+	}
+	return v, ttl, nil
+}
+
+// invalidate 删除本地缓存并广播给其他副本
+func (t *TieredCache) invalidate(keys ...string) {
+	fullKeys := make([]string, 0, len(keys))
+	for _, k := range keys {
+		fullKeys = append(fullKeys, t.cache.prefix+k)
+	}
+	t.local.del(fullKeys...)
+
+	ctx, cancel := t.cache.cmdContext()
+	defer cancel()
+	if _, err := t.topic.Publish(ctx, cacheInvalidation{Origin: t.origin, Keys: fullKeys}); err != nil {
+		t.log.Warnf("publish cache invalidation %v error: %s", fullKeys, err)
+	}
+}
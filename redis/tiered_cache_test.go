@@ -0,0 +1,112 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTieredCacheTTL(t *testing.T) {
+	forEachScriptClient(t, func(t *testing.T, sc scriptClient) {
+		tc := NewTieredCache(10, time.Minute).SetClient(sc.client)
+		tc.local.now = sc.now
+		defer tc.Close()
+
+		require.NoError(t, tc.SetEX("short", "a", time.Second))
+		require.NoError(t, tc.Set("long", "b"))
+		require.NoError(t, tc.Remote().HSet("h", "f", "c"))
+		_, err := tc.Remote().Expire("h", time.Second)
+		require.NoError(t, err)
+
+		for i := 0; i < 2; i++ {
+			v, err := tc.Get("short")
+			require.NoError(t, err)
+			require.Equal(t, "a", v)
+			v, err = tc.HGet("h", "f")
+			require.NoError(t, err)
+			require.Equal(t, "c", v)
+		}
+		v, err := tc.Get("long")
+		require.NoError(t, err)
+		require.Equal(t, "b", v)
+		stats := tc.Stats()
+		require.Equal(t, int64(2), stats.LocalHits)
+		require.Equal(t, int64(3), stats.RemoteHits)
+
+		// 本地缓存不会比 redis 中的 key 保留更久
+		sc.advance(1100 * time.Millisecond)
+		_, err = tc.Get("short")
+		require.Equal(t, Nil, err)
+		_, err = tc.HGet("h", "f")
+		require.Equal(t, Nil, err)
+		v, err = tc.Get("long")
+		require.NoError(t, err)
+		require.Equal(t, "b", v)
+		require.Equal(t, int64(3), tc.Stats().LocalHits)
+	})
+}
+
+func TestTieredCacheInvalidate(t *testing.T) {
+	mc := newTestClient(t)
+	c1 := NewTieredCache(10, time.Minute).SetClient(mc)
+	c2 := NewTieredCache(10, time.Minute).SetClient(mc)
+	defer c1.Close()
+	defer c2.Close()
+
+	require.NoError(t, c1.Set("price", "100"))
+	v, err := c2.Get("price")
+	require.NoError(t, err)
+	require.Equal(t, "100", v)
+
+	// 等待两个实例的订阅建立
+	require.Eventually(t, func() bool {
+		n, err := mc.Publish(context.Background(), c2.topic.Channel(), "{}").Result()
+		return err == nil && n == 2
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, c1.Set("price", "200"))
+	require.Eventually(t, func() bool {
+		v, err := c2.Get("price")
+		return err == nil && v == "200"
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, c1.Del("price"))
+	require.Eventually(t, func() bool {
+		_, err := c2.Get("price")
+		return err == Nil
+	}, time.Second, 10*time.Millisecond)
+
+	// 计数器与 hash 的写操作同样广播失效
+	_, err = c1.IncrEX("stock", time.Minute)
+	require.NoError(t, err)
+	n, err := c2.GetInt64("stock")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+	_, err = c1.DecrIfPositive("stock")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		n, err := c2.GetInt64("stock")
+		return err == nil && n == 0
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, c1.HSet("user", "name", "a"))
+	v, err = c2.HGet("user", "name")
+	require.NoError(t, err)
+	require.Equal(t, "a", v)
+	_, err = c1.HIncrBy("user", "age", 1)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		v, err := c2.HGet("user", "age")
+		return err == nil && v == "1"
+	}, time.Second, 10*time.Millisecond)
+
+	// 通过 Remote() 修改后调用 Invalidate
+	require.NoError(t, c1.Remote().HSet("user", "name", "b"))
+	c1.Invalidate("user")
+	require.Eventually(t, func() bool {
+		v, err := c2.HGet("user", "name")
+		return err == nil && v == "b"
+	}, time.Second, 10*time.Millisecond)
+}
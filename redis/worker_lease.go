@@ -0,0 +1,282 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrNoWorkerAvailable 全部 worker ID 均已被占用
+var ErrNoWorkerAvailable = errors.New("redis: no worker id available")
+
+// leaseReleaseScript 仅当 tag 一致时记录最近一次使用时间并删除锁
+var leaseReleaseScript = newScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("SET", KEYS[2], ARGV[2], "PX", ARGV[3])
+	return redis.call("DEL", KEYS[1])
+end
+return 0`, memLeaseRelease)
+
+func memLeaseRelease(m *MemoryClient, keys, args []string) (interface{}, error) {
+	v, ok, err := m.getString(keys[0])
+	if err != nil || !ok || v != args[0] {
+		return int64(0), err
+	}
+	m.setString(keys[1], args[1], memMs(args[2]))
+	return m.del(keys[0]), nil
+}
+
+/**
+ * WorkerLease 从 [0, maxWorkers) 中租用一个 worker ID, 租约通过后台协程定期续期, 用于多副本间分配不冲突的 ID
+ * 每个 ID 对应一把锁, key 格式：<KeyPrefix>.worker.<name>.<id>
+ * 续期失败且超过 ttl 后 Valid 返回 false, 此时其他副本可能已获取该 ID, 持有者应停止使用
+ * 每个 ID 另记录持有者最后可能使用它的时间(租约截止时间, 正常释放时为 WithLastUsed 返回的时间),
+ * 新的持有者通过 PrevUsed 获取, 依赖时间戳的使用方(例如 snowflake)应等待本机时钟超过该时间后再使用
+ *
+ * Example:
+ *
+ * lease := redis.NewWorkerLease("order-id", 1024)
+ * id, err := lease.Acquire(ctx, 30*time.Second)
+ * if err != nil {
+ * 	return err
+ * }
+ * defer lease.Release()
+ *
+ * if !lease.Valid() {
+ * 	// 租约已丢失
+ * }
+ */
+type WorkerLease struct {
+	ctx        context.Context
+	timeout    time.Duration
+	client     Cmdable
+	prefix     string
+	name       string
+	maxWorkers int64
+	lastUsed   func() time.Time // Release 时记录的最近使用时间
+
+	mu         sync.Mutex
+	lock       *Lock
+	workerId   int64
+	validUntil time.Time
+	prevUsed   time.Time
+	lost       bool
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// NewWorkerLease 创建 worker ID 租约, 使用默认的前缀格式：<KeyPrefix>.worker.<name>.<id>
+func NewWorkerLease(name string, maxWorkers int64) *WorkerLease {
+	return &WorkerLease{
+		ctx:        context.Background(),
+		prefix:     fmt.Sprintf("%s.worker.", KeyPrefix),
+		name:       name,
+		maxWorkers: maxWorkers,
+		workerId:   -1,
+	}
+}
+
+// SetPrefix 设置前缀
+func (w *WorkerLease) SetPrefix(prefix string) *WorkerLease {
+	w.prefix = prefix
+	return w
+}
+
+// EmptyPrefix 清空前缀
+func (w *WorkerLease) EmptyPrefix() *WorkerLease {
+	w.prefix = ""
+	return w
+}
+
+// WithContext 设置续期使用的 context, ctx 结束后停止续期
+func (w *WorkerLease) WithContext(ctx context.Context) *WorkerLease {
+	if ctx == nil {
+		panic("redis: nil context")
+	}
+	w.ctx = ctx
+	return w
+}
+
+// WithTimeout 设置单条命令的超时时间, timeout <= 0 表示不限制
+func (w *WorkerLease) WithTimeout(timeout time.Duration) *WorkerLease {
+	w.timeout = timeout
+	return w
+}
+
+// WithClient 设置使用的客户端, c 为 nil 时使用 DefaultClient()
+func (w *WorkerLease) WithClient(c Cmdable) *WorkerLease {
+	w.client = c
+	return w
+}
+
+// WithLastUsed 设置 Release 时记录的最近使用时间, 例如最近一次发号的时间戳, 未设置或返回零值时使用释放时的当前时间
+func (w *WorkerLease) WithLastUsed(fn func() time.Time) *WorkerLease {
+	w.lastUsed = fn
+	return w
+}
+
+// usedKey 返回记录 ID 最后使用时间的 key, 使用 hash tag 保证集群模式下与锁位于同一 slot, 在最后一次续期 fenceTTL 后过期
+func usedKey(l *Lock) string {
+	return "{" + l.FullKey() + "}.used"
+}
+
+// markUsed 记录持有者在 until 之前可能使用该 ID, 只会增大
+func (w *WorkerLease) markUsed(l *Lock, until time.Time) error {
+	ctx, cancel := l.cmdContext()
+	defer cancel()
+	return setMaxScript.Run(ctx, l.Client(), []string{usedKey(l)}, until.UnixMilli(), fenceTTL.Milliseconds()).Err()
+}
+
+// Acquire 从随机位置开始依次尝试租用 worker ID, 成功后启动续期协程, 全部被占用时返回 ErrNoWorkerAvailable
+func (w *WorkerLease) Acquire(ctx context.Context, ttl time.Duration) (int64, error) {
+	if ttl < 3*time.Millisecond || w.maxWorkers <= 0 {
+		return -1, errors.New("redis: invalid worker lease ttl or maxWorkers")
+	}
+	w.mu.Lock()
+	if w.lock != nil && !w.lost {
+		id := w.workerId
+		w.mu.Unlock()
+		return id, nil
+	}
+	w.mu.Unlock()
+
+	start := rand.Int63n(w.maxWorkers)
+	for i := int64(0); i < w.maxWorkers; i++ {
+		if err := ctx.Err(); err != nil {
+			return -1, err
+		}
+		id := (start + i) % w.maxWorkers
+		l := NewLock(w.name + "." + strconv.FormatInt(id, 10)).
+			SetPrefix(w.prefix).
+			WithContext(w.ctx).
+			WithTimeout(w.timeout).
+			WithClient(w.client)
+
+		begin := time.Now()
+		ok, err := l.Lock(ttl)
+		if err != nil {
+			return -1, err
+		}
+		if !ok {
+			continue
+		}
+		prev, err := w.readUsed(l)
+		if err == nil {
+			err = w.markUsed(l, begin.Add(ttl))
+		}
+		if err != nil {
+			l.Unlock()
+			return -1, err
+		}
+		w.mu.Lock()
+		w.lock, w.workerId, w.lost = l, id, false
+		w.validUntil, w.prevUsed = begin.Add(ttl), prev
+		w.stop, w.done = make(chan struct{}), make(chan struct{})
+		go w.renew(l, ttl, w.stop, w.done)
+		w.mu.Unlock()
+		return id, nil
+	}
+	return -1, ErrNoWorkerAvailable
+}
+
+// readUsed 读取上一个持有者记录的最后使用时间
+func (w *WorkerLease) readUsed(l *Lock) (time.Time, error) {
+	ctx, cancel := l.cmdContext()
+	defer cancel()
+	ms, err := l.Client().Get(ctx, usedKey(l)).Int64()
+	if err == Nil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms), nil
+}
+
+// PrevUsed 返回租用时上一个持有者最后可能使用该 ID 的时间, 没有记录时为零值
+func (w *WorkerLease) PrevUsed() time.Time {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.prevUsed
+}
+
+// WorkerId 返回租用的 worker ID, 未租用时为 -1
+func (w *WorkerLease) WorkerId() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.workerId
+}
+
+// Valid 租约是否仍然有效
+func (w *WorkerLease) Valid() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lock != nil && !w.lost && time.Now().Before(w.validUntil)
+}
+
+// Release 停止续期, 记录最近使用时间(不早于 PrevUsed)并释放 worker ID
+func (w *WorkerLease) Release() error {
+	w.mu.Lock()
+	l, stop, done, prev := w.lock, w.stop, w.done, w.prevUsed
+	w.lock, w.stop, w.done, w.workerId = nil, nil, nil, -1
+	w.mu.Unlock()
+	if l == nil {
+		return nil
+	}
+	close(stop)
+	<-done
+
+	used := time.Now()
+	if w.lastUsed != nil {
+		if t := w.lastUsed(); !t.IsZero() {
+			used = t
+		}
+	}
+	if used.Before(prev) {
+		// 尚未使用时释放, 保留上一个持有者的记录
+		used = prev
+	}
+	ctx, cancel := releaseContext(w.ctx, w.timeout)
+	defer cancel()
+	err := leaseReleaseScript.Run(ctx, l.Client(), []string{l.FullKey(), usedKey(l)}, l.tag, used.UnixMilli(), fenceTTL.Milliseconds()).Err()
+	if err != nil {
+		return fmt.Errorf("release %s error, %s", l.FullKey(), err)
+	}
+	return nil
+}
+
+// renew 每隔 ttl/3 续期一次并记录新的租约截止时间, 两者均成功后才延长有效期, 锁被其他持有者获取时标记为丢失
+func (w *WorkerLease) renew(l *Lock, ttl time.Duration, stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+			begin := time.Now()
+			err := l.Extend(ttl)
+			if err == nil {
+				err = w.markUsed(l, begin.Add(ttl))
+			}
+			w.mu.Lock()
+			if err == nil {
+				w.validUntil = begin.Add(ttl)
+			} else if errors.Is(err, ErrNotHeld) {
+				w.lost = true
+			}
+			w.mu.Unlock()
+			if errors.Is(err, ErrNotHeld) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package safe_stop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/scrawld/zaplog"
+)
+
+// State 组件状态
+type State int
+
+const (
+	StateIdle     State = iota // 尚未启动
+	StateStarting              // 启动中
+	StateReady                 // 就绪
+	StateDegraded              // 降级, 仍可提供服务
+	StateStopping              // 停止中
+	StateStopped               // 已停止
+	StateFailed                // 运行失败
+)
+
+var stateNames = [...]string{"idle", "starting", "ready", "degraded", "stopping", "stopped", "failed"}
+
+func (s State) String() string {
+	if s < 0 || int(s) >= len(stateNames) {
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+	return stateNames[s]
+}
+
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Component 由 Runner 管理的组件
+type Component struct {
+	Name         string
+	DependsOn    []string      // 依赖的组件, 依赖就绪后才启动, 停止时先于依赖停止
+	StartTimeout time.Duration // 等待就绪的超时, 默认 30s
+	StopTimeout  time.Duration // 停止的超时, 默认使用 SafeStop 的钩子超时
+	// Run 运行组件直到 ctx 取消, 就绪后需调用 h.Ready(); 返回即视为组件结束
+	Run func(ctx context.Context, h *Handle) error
+	// Stop 可选, 停止时在取消 Run 的 ctx 之前调用, 如 HTTP 服务排空
+	Stop HookFunc
+}
+
+// Handle 组件上报状态的句柄
+type Handle struct {
+	c *component
+}
+
+// Ready 标记组件就绪, 降级恢复后也可再次调用
+func (h *Handle) Ready() { h.c.set(StateReady, nil) }
+
+// Degraded 标记组件降级
+func (h *Handle) Degraded(reason error) { h.c.set(StateDegraded, reason) }
+
+type component struct {
+	Component
+	mu     sync.Mutex
+	state  State
+	err    error
+	ready  chan struct{} // 首次就绪时关闭
+	exited chan struct{} // Run 返回时关闭
+	cancel context.CancelFunc
+}
+
+func (c *component) set(state State, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// 停止后不再接受状态上报
+	if c.state == StateStopping || c.state == StateStopped || c.state == StateFailed {
+		return
+	}
+	c.state, c.err = state, err
+	if state == StateReady || state == StateDegraded {
+		select {
+		case <-c.ready:
+		default:
+			close(c.ready)
+		}
+	}
+}
+
+func (c *component) status() ComponentStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := ComponentStatus{Name: c.Name, State: c.state}
+	if c.err != nil {
+		s.Error = c.err.Error()
+	}
+	return s
+}
+
+// ComponentStatus 组件状态
+type ComponentStatus struct {
+	Name  string `json:"name"`
+	State State  `json:"state"`
+	Error string `json:"error,omitempty"`
+}
+
+// Health 聚合的健康状态
+type Health struct {
+	Live         bool              `json:"live"`         // 没有组件运行失败
+	Ready        bool              `json:"ready"`        // 全部组件就绪或降级, 且未开始退出
+	ShuttingDown bool              `json:"shuttingDown"` // 已开始退出
+	Components   []ComponentStatus `json:"components"`
+}
+
+// Runner 按依赖顺序启动组件, 退出时按相反顺序停止, 并提供存活和就绪状态
+type Runner struct {
+	stop          *SafeStop
+	mu            sync.Mutex
+	components    []*component
+	byName        map[string]*component
+	shutdownDelay time.Duration
+	started       bool
+}
+
+/**
+ * NewRunner 创建组件运行器, 组件的停止注册为 s 的退出钩子, s 为 nil 时使用 Default
+ * s 开始退出时就绪状态立即变为 false, 之后才依次停止组件
+ *
+ * Example:
+ *
+ * r := safe_stop.NewRunner(nil).SetShutdownDelay(5 * time.Second)
+ * r.Add(safe_stop.Component{Name: "redis", Run: func(ctx context.Context, h *safe_stop.Handle) error {
+ * 	if err := redis.Init(); err != nil {
+ * 		return err
+ * 	}
+ * 	h.Ready()
+ * 	<-ctx.Done()
+ * 	return redis.Close()
+ * }})
+ * r.Add(safe_stop.Component{Name: "jobqueue", DependsOn: []string{"redis"}, Run: func(ctx context.Context, h *safe_stop.Handle) error {
+ * 	h.Ready()
+ * 	return q.Run(ctx)
+ * }})
+ * r.Add(safe_stop.Component{Name: "http", DependsOn: []string{"redis"}, Run: func(ctx context.Context, h *safe_stop.Handle) error {
+ * 	ln, err := net.Listen("tcp", ":8080")
+ * 	if err != nil {
+ * 		return err
+ * 	}
+ * 	h.Ready()
+ * 	if err = srv.Serve(ln); err == http.ErrServerClosed {
+ * 		return nil
+ * 	}
+ * 	return err
+ * }, Stop: safe_stop.HTTPServer(srv)})
+ *
+ * router.GET("/healthz", ginx.LivenessHandler(r))
+ * router.GET("/readyz", ginx.ReadinessHandler(r))
+ *
+ * safe_stop.Listen()
+ * if err := r.Start(ctx); err != nil {
+ * 	safe_stop.Shutdown(err.Error())
+ * }
+ * safe_stop.WaitShutdown()
+ */
+func NewRunner(s *SafeStop) *Runner {
+	if s == nil {
+		s = Default
+	}
+	return &Runner{stop: s, byName: map[string]*component{}}
+}
+
+// SetShutdownDelay 设置开始退出后停止组件前的等待时间, 让负载均衡有时间感知未就绪状态
+func (r *Runner) SetShutdownDelay(d time.Duration) *Runner {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.shutdownDelay = d
+	return r
+}
+
+// Add 添加组件, 需在 Start 之前调用
+func (r *Runner) Add(c Component) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.started {
+		return fmt.Errorf("component %s: runner already started", c.Name)
+	}
+	if c.Run == nil {
+		return fmt.Errorf("component %s: Run is nil", c.Name)
+	}
+	if _, ok := r.byName[c.Name]; ok {
+		return fmt.Errorf("component %s already exists", c.Name)
+	}
+	if c.StartTimeout <= 0 {
+		c.StartTimeout = 30 * time.Second
+	}
+	rc := &component{Component: c, ready: make(chan struct{}), exited: make(chan struct{})}
+	r.components = append(r.components, rc)
+	r.byName[c.Name] = rc
+	return nil
+}
+
+// Start 按依赖顺序启动全部组件, 每个组件就绪后才启动依赖它的组件; 某个组件启动失败时返回错误, 已启动的组件由退出流程停止
+func (r *Runner) Start(ctx context.Context) error {
+	r.mu.Lock()
+	if r.started {
+		r.mu.Unlock()
+		return fmt.Errorf("runner already started")
+	}
+	order, err := r.sort()
+	if err != nil {
+		r.mu.Unlock()
+		return err
+	}
+	r.started = true
+	delay := r.shutdownDelay
+	r.mu.Unlock()
+
+	if delay > 0 {
+		r.stop.RegisterHook(Hook{Name: "shutdown delay", Priority: PriorityServer + 1, Timeout: delay + time.Second, Fn: func(ctx context.Context) error {
+			time.Sleep(delay)
+			return nil
+		}})
+	}
+	// 开始退出时立即标记为停止中, 就绪检查随即失败
+	go func() {
+		<-r.stop.Context().Done()
+		for _, c := range r.components {
+			c.mu.Lock()
+			if c.state != StateStopped && c.state != StateFailed {
+				c.state = StateStopping
+			}
+			c.mu.Unlock()
+		}
+	}()
+
+	log := zaplog.New().Named("Runner")
+	for _, c := range order {
+		if err := r.startComponent(ctx, log, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Runner) startComponent(ctx context.Context, log *zaplog.TracingLogger, c *component) error {
+	if r.stop.Context().Err() != nil {
+		return fmt.Errorf("component %s: shutting down", c.Name)
+	}
+	c.mu.Lock()
+	c.state = StateStarting
+	c.mu.Unlock()
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	// 同优先级的钩子按注册的逆序执行, 先启动的组件后停止
+	r.stop.RegisterHook(Hook{Name: c.Name, Priority: PriorityServer, Timeout: c.StopTimeout, Fn: func(ctx context.Context) error {
+		return r.stopComponent(ctx, c)
+	}})
+
+	start := time.Now()
+	go func() {
+		defer close(c.exited)
+		err := call(runCtx, c.Run, &Handle{c: c})
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.state == StateStopping {
+			if errors.Is(err, context.Canceled) {
+				err = nil
+			}
+			c.state, c.err = StateStopped, err
+			return
+		}
+		if err == nil {
+			err = fmt.Errorf("exited unexpectedly")
+		}
+		c.state, c.err = StateFailed, err
+		log.Errorf("component %s failed: %s", c.Name, err)
+	}()
+
+	timer := time.NewTimer(c.StartTimeout)
+	defer timer.Stop()
+	select {
+	case <-c.ready:
+		log.Infof("component %s ready, take: %s", c.Name, time.Since(start))
+		return nil
+	case <-c.exited:
+		return fmt.Errorf("component %s start error: %s", c.Name, c.status().Error)
+	case <-timer.C:
+		return fmt.Errorf("component %s not ready after %s", c.Name, c.StartTimeout)
+	case <-ctx.Done():
+		return fmt.Errorf("component %s start error: %w", c.Name, ctx.Err())
+	case <-r.stop.Context().Done():
+		return fmt.Errorf("component %s: shutting down", c.Name)
+	}
+}
+
+// stopComponent 调用 Stop 后取消 Run 的 ctx 并等待其返回
+func (r *Runner) stopComponent(ctx context.Context, c *component) error {
+	c.mu.Lock()
+	if c.state != StateStopped && c.state != StateFailed {
+		c.state = StateStopping
+	}
+	c.mu.Unlock()
+
+	var err error
+	if c.Stop != nil {
+		err = c.Stop(ctx)
+	}
+	c.cancel()
+	select {
+	case <-c.exited:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state == StateStopping {
+		c.state = StateStopped
+	}
+	if err == nil {
+		err = c.err
+	}
+	return err
+}
+
+// sort 按依赖拓扑排序, 无依赖关系的组件保持添加顺序, 调用方需持有 r.mu
+func (r *Runner) sort() ([]*component, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	var (
+		mark  = map[string]int{}
+		order []*component
+		visit func(c *component) error
+	)
+	visit = func(c *component) error {
+		switch mark[c.Name] {
+		case visiting:
+			return fmt.Errorf("component %s: dependency cycle", c.Name)
+		case visited:
+			return nil
+		}
+		mark[c.Name] = visiting
+		for _, name := range c.DependsOn {
+			dep, ok := r.byName[name]
+			if !ok {
+				return fmt.Errorf("component %s: unknown dependency %s", c.Name, name)
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		mark[c.Name] = visited
+		order = append(order, c)
+		return nil
+	}
+	for _, c := range r.components {
+		if err := visit(c); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// Health 返回聚合的健康状态
+func (r *Runner) Health() Health {
+	r.mu.Lock()
+	components := r.components
+	r.mu.Unlock()
+
+	h := Health{
+		Live:         true,
+		Ready:        true,
+		ShuttingDown: r.stop.Context().Err() != nil,
+		Components:   make([]ComponentStatus, 0, len(components)),
+	}
+	for _, c := range components {
+		s := c.status()
+		switch s.State {
+		case StateFailed:
+			h.Live, h.Ready = false, false
+		case StateReady, StateDegraded:
+		default:
+			h.Ready = false
+		}
+		h.Components = append(h.Components, s)
+	}
+	if h.ShuttingDown {
+		h.Ready = false
+	}
+	return h
+}
+
+// Live 是否存活
+func (r *Runner) Live() bool { return r.Health().Live }
+
+// Ready 是否就绪
+func (r *Runner) Ready() bool { return r.Health().Ready }
+
+// call 执行 Run 并将 panic 转为错误
+func call(ctx context.Context, fn func(ctx context.Context, h *Handle) error, h *Handle) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("panic: %v", rec)
+		}
+	}()
+	return fn(ctx, h)
+}
@@ -0,0 +1,77 @@
+package safe_stop
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunner(t *testing.T) {
+	var (
+		s      = NewSafeStop()
+		r      = NewRunner(s)
+		mu     sync.Mutex
+		events []string
+		record = func(e string) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, e)
+		}
+		degrade = make(chan struct{})
+	)
+	run := func(name string) func(ctx context.Context, h *Handle) error {
+		return func(ctx context.Context, h *Handle) error {
+			record("start " + name)
+			h.Ready()
+			if name == "http" {
+				<-degrade
+				h.Degraded(errors.New("slow"))
+			}
+			<-ctx.Done()
+			record("stop " + name)
+			return ctx.Err()
+		}
+	}
+	require.NoError(t, r.Add(Component{Name: "http", DependsOn: []string{"db", "cache"}, Run: run("http")}))
+	require.NoError(t, r.Add(Component{Name: "db", Run: run("db")}))
+	require.NoError(t, r.Add(Component{Name: "cache", DependsOn: []string{"db"}, Run: run("cache")}))
+	require.Error(t, r.Add(Component{Name: "db", Run: run("db")}))
+
+	require.False(t, r.Ready())
+	require.NoError(t, r.Start(context.Background()))
+	require.True(t, r.Ready())
+	require.True(t, r.Live())
+
+	close(degrade)
+	require.Eventually(t, func() bool { return r.Health().Components[0].State == StateDegraded }, time.Second, time.Millisecond)
+	require.True(t, r.Ready())
+
+	s.RegisterHook(Hook{Name: "check", Priority: PriorityServer + 10, Fn: func(ctx context.Context) error {
+		// 组件停止前就已经不再就绪
+		require.False(t, r.Ready())
+		require.True(t, r.Health().ShuttingDown)
+		return nil
+	}})
+	require.NoError(t, s.Shutdown("test"))
+	require.Equal(t, []string{"start db", "start cache", "start http", "stop http", "stop cache", "stop db"}, events)
+	for _, c := range r.Health().Components {
+		require.Equal(t, StateStopped, c.State)
+	}
+}
+
+func TestRunnerFailure(t *testing.T) {
+	r := NewRunner(NewSafeStop())
+	require.NoError(t, r.Add(Component{Name: "a", DependsOn: []string{"b"}, Run: func(ctx context.Context, h *Handle) error { return nil }}))
+	require.NoError(t, r.Add(Component{Name: "b", DependsOn: []string{"a"}, Run: func(ctx context.Context, h *Handle) error { return nil }}))
+	require.ErrorContains(t, r.Start(context.Background()), "cycle")
+
+	r = NewRunner(NewSafeStop())
+	errA := errors.New("a")
+	require.NoError(t, r.Add(Component{Name: "a", Run: func(ctx context.Context, h *Handle) error { return errA }}))
+	require.ErrorContains(t, r.Start(context.Background()), "a start error: a")
+	require.False(t, r.Live())
+}
@@ -1,13 +1,67 @@
 package safe_stop
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/scrawld/zaplog"
+)
+
+// 常用的钩子优先级, 数值大的先执行, 相同优先级按注册的逆序执行
+const (
+	PriorityServer   = 100 // 停止接收请求, 如 HTTP 服务排空
+	PriorityWorkers  = 50  // 等待通过 Add/Done 登记的任务及协程池排空
+	PriorityResource = 0   // 释放资源, 如关闭数据库、redis, 刷新日志
+)
+
+// HookFunc 退出钩子, ctx 在钩子超时或整体超时后取消
+type HookFunc func(ctx context.Context) error
+
+// Hook 退出钩子
+type Hook struct {
+	Name     string
+	Priority int           // 数值大的先执行, 默认 PriorityResource
+	Timeout  time.Duration // 单个钩子的超时, 默认使用 SetHookTimeout 的值
+	Fn       HookFunc
+}
 
 type SafeStop struct {
 	wg *sync.WaitGroup
+
+	ctx         context.Context
+	cancel      context.CancelFunc
+	mu          sync.Mutex
+	hooks       []Hook
+	timeout     time.Duration
+	hookTimeout time.Duration
+	current     string // 正在执行的钩子
+	listen      sync.Once
+	once        sync.Once
+	done        chan struct{}
+	err         error
+	exit        func(code int)
 }
 
 func NewSafeStop() *SafeStop {
-	o := &SafeStop{wg: &sync.WaitGroup{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	o := &SafeStop{
+		wg:          &sync.WaitGroup{},
+		ctx:         ctx,
+		cancel:      cancel,
+		timeout:     30 * time.Second,
+		hookTimeout: 10 * time.Second,
+		done:        make(chan struct{}),
+		exit:        os.Exit,
+	}
+	o.RegisterHook(Hook{Name: "workers", Priority: PriorityWorkers, Fn: o.waitWorkers})
 	return o
 }
 
@@ -15,8 +69,203 @@ func (s *SafeStop) Add(in int) { s.wg.Add(in) }
 func (s *SafeStop) Done()      { s.wg.Done() }
 func (s *SafeStop) Wait()      { s.wg.Wait() }
 
+// SetTimeout 设置整体超时, 超过后记录阻塞的钩子并强制退出进程, 默认 30s
+func (s *SafeStop) SetTimeout(d time.Duration) *SafeStop {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timeout = d
+	return s
+}
+
+// SetHookTimeout 设置单个钩子的默认超时, 默认 10s
+func (s *SafeStop) SetHookTimeout(d time.Duration) *SafeStop {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hookTimeout = d
+	return s
+}
+
+// Context 返回根 context, 开始退出时取消
+func (s *SafeStop) Context() context.Context {
+	return s.ctx
+}
+
+// Register 以 PriorityResource 注册退出钩子
+func (s *SafeStop) Register(name string, fn HookFunc) {
+	s.RegisterHook(Hook{Name: name, Priority: PriorityResource, Fn: fn})
+}
+
+// RegisterHook 注册退出钩子
+func (s *SafeStop) RegisterHook(h Hook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, h)
+}
+
+/**
+ * Listen 监听 SIGINT、SIGTERM, 收到信号后执行 Shutdown, 再次收到信号时立即退出
+ *
+ * Example:
+ *
+ * safe_stop.Listen()
+ * safe_stop.RegisterHook(safe_stop.Hook{Name: "http", Priority: safe_stop.PriorityServer, Fn: safe_stop.HTTPServer(srv)})
+ * safe_stop.RegisterHook(safe_stop.Hook{Name: "pool", Priority: safe_stop.PriorityWorkers, Fn: pool.Close})
+ * safe_stop.Register("redis", safe_stop.Closer(redis.Close))
+ * safe_stop.Register("gorm log", safe_stop.Closer(gormzaplog.Sync))
+ *
+ * go q.Run(safe_stop.Context())
+ * if err := safe_stop.WaitShutdown(); err != nil {
+ * 	log.Printf("shutdown error: %s", err)
+ * }
+ */
+func (s *SafeStop) Listen() {
+	s.listen.Do(func() {
+		ch := make(chan os.Signal, 2)
+		signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			sig := <-ch
+			go s.Shutdown(fmt.Sprintf("signal %s", sig))
+			sig = <-ch
+			zaplog.New().Named("SafeStop").Warnf("received signal %s again, force exit", sig)
+			s.exit(1)
+		}()
+	})
+}
+
+// Shutdown 取消根 context 并按顺序执行退出钩子, 只执行一次, 返回所有钩子错误的聚合
+func (s *SafeStop) Shutdown(reason string) error {
+	s.once.Do(func() {
+		defer close(s.done)
+		log := zaplog.New().Named("SafeStop")
+		log.Infof("shutdown: %s", reason)
+		s.cancel()
+
+		s.mu.Lock()
+		hooks := make([]Hook, len(s.hooks))
+		// 逆序后稳定排序, 相同优先级按注册的逆序执行
+		for i, h := range s.hooks {
+			hooks[len(hooks)-1-i] = h
+		}
+		timeout, hookTimeout := s.timeout, s.hookTimeout
+		s.mu.Unlock()
+		sort.SliceStable(hooks, func(i, j int) bool { return hooks[i].Priority > hooks[j].Priority })
+
+		finished := make(chan struct{})
+		defer close(finished)
+		if timeout > 0 {
+			go s.watchdog(timeout, finished)
+		}
+
+		var errs []error
+		for _, h := range hooks {
+			d := h.Timeout
+			if d <= 0 {
+				d = hookTimeout
+			}
+			if err := s.runHook(log, h, d); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", h.Name, err))
+			}
+		}
+		s.err = errors.Join(errs...)
+		log.Infof("shutdown completed")
+	})
+	<-s.done
+	return s.err
+}
+
+// WaitShutdown 阻塞直到 Shutdown 执行完成, 返回钩子错误的聚合
+func (s *SafeStop) WaitShutdown() error {
+	<-s.done
+	return s.err
+}
+
+// runHook 执行钩子, 超时后不再等待其返回
+func (s *SafeStop) runHook(log *zaplog.TracingLogger, h Hook, timeout time.Duration) error {
+	s.mu.Lock()
+	s.current = h.Name
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	result := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				result <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		result <- h.Fn(ctx)
+	}()
+	select {
+	case err := <-result:
+		if err != nil {
+			log.Warnf("hook %s error: %s, take: %s", h.Name, err, time.Since(start))
+			return err
+		}
+		log.Infof("hook %s done, take: %s", h.Name, time.Since(start))
+		return nil
+	case <-ctx.Done():
+		log.Warnf("hook %s timeout after %s, skip", h.Name, timeout)
+		return ctx.Err()
+	}
+}
+
+// watchdog 整体超时后记录阻塞的钩子并强制退出
+func (s *SafeStop) watchdog(timeout time.Duration, finished <-chan struct{}) {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-finished:
+	case <-t.C:
+		s.mu.Lock()
+		current := s.current
+		s.mu.Unlock()
+		zaplog.New().Named("SafeStop").Errorf("shutdown timeout after %s, blocking hook: %s, force exit", timeout, current)
+		s.exit(1)
+	}
+}
+
+// waitWorkers 等待通过 Add/Done 登记的任务结束
+func (s *SafeStop) waitWorkers(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// HTTPServer 返回排空 HTTP 服务的钩子
+func HTTPServer(srv *http.Server) HookFunc {
+	return func(ctx context.Context) error {
+		return srv.Shutdown(ctx)
+	}
+}
+
+// Closer 将不接收 context 的关闭函数转为钩子, 如 redis.Close、gormzaplog.Sync、sqlDB.Close
+func Closer(fn func() error) HookFunc {
+	return func(ctx context.Context) error {
+		return fn()
+	}
+}
+
 var Default = NewSafeStop()
 
 func Add(in int) { Default.Add(in) }
 func Done()      { Default.Done() }
 func Wait()      { Default.Wait() }
+
+func Context() context.Context                 { return Default.Context() }
+func Register(name string, fn HookFunc)        { Default.Register(name, fn) }
+func RegisterHook(h Hook)                      { Default.RegisterHook(h) }
+func Listen()                                  { Default.Listen() }
+func Shutdown(reason string) error             { return Default.Shutdown(reason) }
+func WaitShutdown() error                      { return Default.WaitShutdown() }
+func SetTimeout(d time.Duration) *SafeStop     { return Default.SetTimeout(d) }
+func SetHookTimeout(d time.Duration) *SafeStop { return Default.SetHookTimeout(d) }
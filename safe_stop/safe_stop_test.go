@@ -0,0 +1,87 @@
+package safe_stop
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/scrawld/zaplog"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	zaplog.Logger = zap.NewNop()
+	os.Exit(m.Run())
+}
+
+func TestShutdown(t *testing.T) {
+	var (
+		s      = NewSafeStop().SetHookTimeout(50 * time.Millisecond)
+		mu     sync.Mutex
+		order  []string
+		errA   = errors.New("a")
+		httpOk = make(chan struct{})
+	)
+	record := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, name)
+	}
+	hook := func(name string, err error) HookFunc {
+		return func(ctx context.Context) error {
+			record(name)
+			return err
+		}
+	}
+	s.Register("db", hook("db", nil))
+	s.Register("redis", hook("redis", errA))
+	s.RegisterHook(Hook{Name: "http", Priority: PriorityServer, Fn: func(ctx context.Context) error {
+		record("http")
+		close(httpOk)
+		return nil
+	}})
+	s.RegisterHook(Hook{Name: "slow", Priority: PriorityServer - 1, Timeout: 10 * time.Millisecond, Fn: func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(time.Second) // 忽略取消的钩子不会阻塞后续钩子
+		return nil
+	}})
+
+	s.Add(1)
+	go func() {
+		defer s.Done()
+		<-s.Context().Done()
+		// 根 ctx 在所有钩子之前取消, 等 http 钩子执行后再记录, 验证 workers 钩子会等待该 goroutine
+		<-httpOk
+		record("worker")
+	}()
+
+	err := s.Shutdown("test")
+	require.ErrorIs(t, err, errA)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, []string{"http", "worker", "redis", "db"}, order)
+	require.Equal(t, err, s.WaitShutdown())
+}
+
+func TestShutdownForceExit(t *testing.T) {
+	s := NewSafeStop().SetTimeout(20 * time.Millisecond)
+	exited := make(chan int, 1)
+	s.exit = func(code int) { exited <- code }
+	s.Register("stuck", func(ctx context.Context) error {
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	})
+	go s.Shutdown("test")
+	select {
+	case code := <-exited:
+		require.Equal(t, 1, code)
+	case <-time.After(time.Second):
+		t.Fatal("not exited")
+	}
+	s.mu.Lock()
+	require.Equal(t, "stuck", s.current)
+	s.mu.Unlock()
+}
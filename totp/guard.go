@@ -0,0 +1,349 @@
+package totp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/scrawld/library/redis"
+)
+
+var (
+	ErrInvalidCode = errors.New("totp: invalid code")             // 验证码错误
+	ErrReplayed    = errors.New("totp: code already used")        // 验证码已使用过
+	ErrLocked      = errors.New("totp: too many failed attempts") // 失败次数过多被锁定, 具体错误为 *LockedError
+)
+
+// LockedError 锁定错误, errors.Is(err, ErrLocked) 成立
+type LockedError struct {
+	RetryAfter time.Duration // 剩余锁定时间
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrLocked, e.RetryAfter)
+}
+
+func (e *LockedError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+// Store 防重放及失败计数的存储
+type Store interface {
+	// UseStep 记录账号通过的时间步, step 不大于已记录的值时返回 false, 需保证原子性
+	UseStep(ctx context.Context, account string, step int64, ttl time.Duration) (bool, error)
+	// Fail 失败次数加一并返回新值, 计数在首次失败 window 后清零, 需保证原子性
+	Fail(ctx context.Context, key string, window time.Duration) (int64, error)
+	// Undo 撤销一次 Fail, 计数已清零时忽略
+	Undo(ctx context.Context, key string) error
+	// Reset 清除失败次数
+	Reset(ctx context.Context, key string) error
+	// Lock 未锁定时锁定 d 时长, 返回是否锁定成功, 需保证原子性
+	Lock(ctx context.Context, key string, d time.Duration) (bool, error)
+	// Unlock 解除锁定
+	Unlock(ctx context.Context, key string) error
+	// LockedFor 返回剩余锁定时间, 未锁定时返回 0
+	LockedFor(ctx context.Context, key string) (time.Duration, error)
+}
+
+// GuardOptions 验证器配置
+type GuardOptions struct {
+	Options       *Options      // TOTP 选项, nil 使用默认值
+	MaxFailures   int           // 账号在 FailureWindow 内失败达到该次数后锁定, 默认 5
+	IPMaxFailures int           // IP 在 FailureWindow 内失败达到该次数后锁定, 默认 20, 小于 0 表示不按 IP 限制
+	FailureWindow time.Duration // 失败计数的窗口, 默认 1 小时
+	Lockout       time.Duration // 首次锁定时长, 之后每多失败一次翻倍, 默认 1 分钟
+	MaxLockout    time.Duration // 最长锁定时长, 默认 1 小时
+}
+
+// Guard 带防重放和失败锁定的 TOTP 验证器
+type Guard struct {
+	store Store
+	opts  GuardOptions
+	now   func() time.Time
+}
+
+/**
+ * NewGuard 创建验证器, store 为 nil 时使用 NewRedisStore(nil)
+ *
+ * Example:
+ *
+ * g := totp.NewGuard(nil, totp.GuardOptions{MaxFailures: 5})
+ * _, err := g.Validate(ctx, userId, ctx.ClientIP(), code, secret)
+ * var locked *totp.LockedError
+ * switch {
+ * case errors.As(err, &locked):
+ * 	return fmt.Errorf("请 %s 后重试", locked.RetryAfter)
+ * case errors.Is(err, totp.ErrReplayed), errors.Is(err, totp.ErrInvalidCode):
+ * 	return errors.New("验证码错误")
+ * case err != nil:
+ * 	return err
+ * }
+ */
+func NewGuard(store Store, opts GuardOptions) *Guard {
+	if store == nil {
+		store = NewRedisStore(nil)
+	}
+	if opts.MaxFailures <= 0 {
+		opts.MaxFailures = 5
+	}
+	if opts.IPMaxFailures == 0 {
+		opts.IPMaxFailures = 20
+	}
+	if opts.FailureWindow <= 0 {
+		opts.FailureWindow = time.Hour
+	}
+	if opts.Lockout <= 0 {
+		opts.Lockout = time.Minute
+	}
+	if opts.MaxLockout <= 0 {
+		opts.MaxLockout = time.Hour
+	}
+	return &Guard{store: store, opts: opts, now: time.Now}
+}
+
+// Validate 验证账号的验证码, ip 为空时不按 IP 计数, 通过时返回匹配的时间步
+// 验证前先计入失败并在达到次数时锁定, 并发的猜测同样受 MaxFailures 限制, 通过后撤销; 重放同样计为失败
+// 返回 *LockedError、ErrReplayed、ErrInvalidCode 或存储的错误
+func (g *Guard) Validate(ctx context.Context, account, ip, passcode, secret string) (int64, error) {
+	keys := []string{"account:" + account}
+	limits := []int{g.opts.MaxFailures}
+	if ip != "" && g.opts.IPMaxFailures > 0 {
+		keys = append(keys, "ip:"+ip)
+		limits = append(limits, g.opts.IPMaxFailures)
+	}
+	if err := g.checkLocked(ctx, keys); err != nil {
+		return 0, err
+	}
+
+	// 达到次数的尝试先锁定再验证, 同时只有一个请求能取得锁, 其余请求直接拒绝
+	var locked []string
+	for i, key := range keys {
+		n, err := g.store.Fail(ctx, key, g.opts.FailureWindow)
+		if err != nil {
+			return 0, err
+		}
+		if n < int64(limits[i]) {
+			continue
+		}
+		ok, err := g.store.Lock(ctx, key, g.lockout(n, limits[i]))
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			if err = g.checkLocked(ctx, keys); err != nil {
+				return 0, err
+			}
+			return 0, &LockedError{}
+		}
+		locked = append(locked, key)
+	}
+
+	step, ok := ValidateAt(passcode, secret, g.now(), g.opts.Options)
+	if !ok {
+		return 0, ErrInvalidCode
+	}
+	// 记录保留到该时间步的验证码失效之后
+	o := g.opts.Options.withDefaults()
+	ttl := time.Duration(int64(o.Skew)*2+2) * time.Duration(o.Period) * time.Second
+	used, err := g.store.UseStep(ctx, account, step, ttl)
+	if err != nil {
+		return 0, err
+	}
+	if !used {
+		return 0, ErrReplayed
+	}
+
+	if err = g.store.Reset(ctx, keys[0]); err != nil {
+		return 0, err
+	}
+	for _, key := range keys[1:] {
+		if err = g.store.Undo(ctx, key); err != nil {
+			return 0, err
+		}
+	}
+	for _, key := range locked {
+		if err = g.store.Unlock(ctx, key); err != nil {
+			return 0, err
+		}
+	}
+	return step, nil
+}
+
+// checkLocked 任一 key 被锁定时返回 *LockedError
+func (g *Guard) checkLocked(ctx context.Context, keys []string) error {
+	var retryAfter time.Duration
+	for _, key := range keys {
+		d, err := g.store.LockedFor(ctx, key)
+		if err != nil {
+			return err
+		}
+		retryAfter = max(retryAfter, d)
+	}
+	if retryAfter > 0 {
+		return &LockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// lockout 第 n 次失败的锁定时长, 按超出次数指数增加
+func (g *Guard) lockout(n int64, limit int) time.Duration {
+	d := g.opts.MaxLockout
+	if shift := n - int64(limit); shift < 32 {
+		d = min(g.opts.Lockout<<shift, g.opts.MaxLockout)
+	}
+	if d <= 0 {
+		d = g.opts.MaxLockout
+	}
+	return d
+}
+
+// RedisStore 基于 redis 的存储, 同时实现 Store 和 RecoveryStore
+type RedisStore struct {
+	cache *redis.Cache
+}
+
+// NewRedisStore 创建 redis 存储, cache 为 nil 时使用 redis.New(), 使用的 key: totp.step.<account>、totp.fail.<key>、totp.lock.<key>、totp.recovery.<account>
+func NewRedisStore(cache *redis.Cache) *RedisStore {
+	if cache == nil {
+		cache = redis.New()
+	}
+	return &RedisStore{cache: cache}
+}
+
+func (s *RedisStore) UseStep(ctx context.Context, account string, step int64, ttl time.Duration) (bool, error) {
+	return s.cache.WithContext(ctx).SetMax("totp.step."+account, step, ttl)
+}
+
+func (s *RedisStore) Fail(ctx context.Context, key string, window time.Duration) (int64, error) {
+	return s.cache.WithContext(ctx).IncrEX("totp.fail."+key, window)
+}
+
+func (s *RedisStore) Undo(ctx context.Context, key string) error {
+	_, err := s.cache.WithContext(ctx).DecrIfPositive("totp.fail." + key)
+	return err
+}
+
+func (s *RedisStore) Reset(ctx context.Context, key string) error {
+	return s.cache.WithContext(ctx).Del("totp.fail." + key)
+}
+
+func (s *RedisStore) Lock(ctx context.Context, key string, d time.Duration) (bool, error) {
+	return s.cache.WithContext(ctx).SetNX("totp.lock."+key, 1, d)
+}
+
+func (s *RedisStore) Unlock(ctx context.Context, key string) error {
+	return s.cache.WithContext(ctx).Del("totp.lock." + key)
+}
+
+func (s *RedisStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	d, err := s.cache.WithContext(ctx).PTTL("totp.lock." + key)
+	if err != nil || d < 0 {
+		return 0, err
+	}
+	return d, nil
+}
+
+// MemoryStore 内存存储, 同时实现 Store 和 RecoveryStore, 用于测试及单实例
+type MemoryStore struct {
+	mu    sync.Mutex
+	steps map[string]memoryEntry
+	fails map[string]memoryEntry
+	locks map[string]memoryEntry
+	now   func() time.Time
+
+	recovery map[string]map[string]struct{}
+}
+
+type memoryEntry struct {
+	value    int64
+	expireAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		steps: map[string]memoryEntry{},
+		fails: map[string]memoryEntry{},
+		locks: map[string]memoryEntry{},
+		now:   time.Now,
+
+		recovery: map[string]map[string]struct{}{},
+	}
+}
+
+// get 返回未过期的记录, 调用方需持有 s.mu
+func (s *MemoryStore) get(m map[string]memoryEntry, key string) (memoryEntry, bool) {
+	e, ok := m[key]
+	if ok && !s.now().Before(e.expireAt) {
+		delete(m, key)
+		return e, false
+	}
+	return e, ok
+}
+
+func (s *MemoryStore) UseStep(ctx context.Context, account string, step int64, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.get(s.steps, account); ok && e.value >= step {
+		return false, nil
+	}
+	s.steps[account] = memoryEntry{value: step, expireAt: s.now().Add(ttl)}
+	return true, nil
+}
+
+func (s *MemoryStore) Fail(ctx context.Context, key string, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.get(s.fails, key)
+	if !ok {
+		e = memoryEntry{expireAt: s.now().Add(window)}
+	}
+	e.value++
+	s.fails[key] = e
+	return e.value, nil
+}
+
+func (s *MemoryStore) Undo(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.get(s.fails, key); ok && e.value > 0 {
+		e.value--
+		s.fails[key] = e
+	}
+	return nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.fails, key)
+	return nil
+}
+
+func (s *MemoryStore) Lock(ctx context.Context, key string, d time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.get(s.locks, key); ok {
+		return false, nil
+	}
+	s.locks[key] = memoryEntry{value: 1, expireAt: s.now().Add(d)}
+	return true, nil
+}
+
+func (s *MemoryStore) Unlock(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.locks, key)
+	return nil
+}
+
+func (s *MemoryStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.get(s.locks, key)
+	if !ok {
+		return 0, nil
+	}
+	return e.expireAt.Sub(s.now()), nil
+}
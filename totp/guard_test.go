@@ -0,0 +1,119 @@
+package totp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/scrawld/library/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func testGuard(t *testing.T, store Store, now *time.Time) {
+	secret, _, err := Generate("ziy", "ziy@163.com")
+	require.NoError(t, err)
+	g := NewGuard(store, GuardOptions{MaxFailures: 3, IPMaxFailures: 4, Lockout: time.Minute})
+	g.now = func() time.Time { return *now }
+	ctx := context.Background()
+
+	code, err := GenerateCodeAt(secret, *now, nil)
+	require.NoError(t, err)
+	step, err := g.Validate(ctx, "u1", "1.1.1.1", code, secret)
+	require.NoError(t, err)
+	require.Equal(t, Step(*now, nil), step)
+	_, err = g.Validate(ctx, "u1", "1.1.1.1", code, secret)
+	require.ErrorIs(t, err, ErrReplayed)
+
+	// 上一个时间步的验证码在窗口内但早于已通过的时间步
+	prev, err := GenerateCodeAt(secret, now.Add(-30*time.Second), nil)
+	require.NoError(t, err)
+	_, err = g.Validate(ctx, "u1", "1.1.1.1", prev, secret)
+	require.ErrorIs(t, err, ErrReplayed)
+
+	for i := 0; i < 3; i++ {
+		_, err = g.Validate(ctx, "u2", "2.2.2.2", "000000", secret)
+		require.ErrorIs(t, err, ErrInvalidCode)
+	}
+	_, err = g.Validate(ctx, "u2", "2.2.2.2", code, secret)
+	var locked *LockedError
+	require.ErrorAs(t, err, &locked)
+	require.ErrorIs(t, err, ErrLocked)
+	require.Equal(t, time.Minute, locked.RetryAfter)
+
+	// 锁定结束后再次失败, 锁定时间翻倍
+	*now = now.Add(time.Minute)
+	advance(store, time.Minute)
+	_, err = g.Validate(ctx, "u2", "2.2.2.2", "000000", secret)
+	require.ErrorIs(t, err, ErrInvalidCode)
+	_, err = g.Validate(ctx, "u2", "2.2.2.2", "000000", secret)
+	require.ErrorAs(t, err, &locked)
+	require.Equal(t, 2*time.Minute, locked.RetryAfter)
+
+	// IP 被锁定后其他账号同样被拒绝
+	_, err = g.Validate(ctx, "u3", "2.2.2.2", "000000", secret)
+	require.ErrorIs(t, err, ErrLocked)
+}
+
+func advance(store Store, d time.Duration) {
+	switch s := store.(type) {
+	case *MemoryStore:
+		now := s.now()
+		s.now = func() time.Time { return now.Add(d) }
+	case *RedisStore:
+		s.cache.Client().(*redis.MemoryClient).Advance(d)
+	}
+}
+
+func TestGuardMemoryStore(t *testing.T) {
+	now := time.Date(2024, 3, 6, 10, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	testGuard(t, s, &now)
+}
+
+func TestGuardRedisStore(t *testing.T) {
+	now := time.Date(2024, 3, 6, 10, 0, 0, 0, time.UTC)
+	mc := redis.NewMemoryClient()
+	mc.SetTime(now)
+	testGuard(t, NewRedisStore(redis.New().WithClient(mc)), &now)
+	require.False(t, errors.Is(&LockedError{}, ErrInvalidCode))
+}
+
+func TestGuardParallelFailures(t *testing.T) {
+	mc := redis.NewMemoryClient()
+	for name, store := range map[string]Store{
+		"memory": NewMemoryStore(),
+		"redis":  NewRedisStore(redis.New().WithClient(mc)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			secret, _, err := Generate("ziy", "ziy@163.com")
+			require.NoError(t, err)
+			g := NewGuard(store, GuardOptions{MaxFailures: 3})
+
+			// 并发猜测只有 MaxFailures 次会被验证, 其余直接拒绝
+			var (
+				wg      sync.WaitGroup
+				mu      sync.Mutex
+				invalid int
+			)
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := g.Validate(context.Background(), "u1", "", "000000", secret)
+					if errors.Is(err, ErrInvalidCode) {
+						mu.Lock()
+						invalid++
+						mu.Unlock()
+					} else {
+						require.ErrorIs(t, err, ErrLocked)
+					}
+				}()
+			}
+			wg.Wait()
+			require.Equal(t, 3, invalid)
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package totp
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+)
+
+// GenerateHOTP 生成基于计数器的 HOTP 秘钥, 返回秘钥及 otpauth://hotp 地址, opts 中的 Period 和 Skew 不使用
+func GenerateHOTP(issuer, accountName string, opts *Options) (string, string, error) {
+	o := opts.withDefaults()
+	key, err := hotp.Generate(hotp.GenerateOpts{
+		Issuer:      issuer,
+		AccountName: accountName,
+		SecretSize:  o.SecretSize,
+		Digits:      otp.Digits(o.Digits),
+		Algorithm:   o.Algorithm,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return key.Secret(), key.URL(), nil
+}
+
+// GenerateHOTPCode 使用计数器生成 HOTP 令牌
+func GenerateHOTPCode(secret string, counter uint64, opts *Options) (string, error) {
+	o := opts.withDefaults()
+	return hotp.GenerateCodeCustom(secret, counter, hotp.ValidateOpts{
+		Digits:    otp.Digits(o.Digits),
+		Algorithm: o.Algorithm,
+	})
+}
+
+/**
+ * ValidateHOTP 从 counter 开始向后检查 lookAhead 个计数器, 通过时返回下一次应使用的计数器
+ * 调用方需保存返回的计数器, 已使用过的计数器不会再次通过
+ *
+ * Example:
+ *
+ * next, ok := totp.ValidateHOTP(code, secret, user.Counter, 10, nil)
+ * if !ok {
+ * 	return errors.New("invalid code")
+ * }
+ * user.Counter = next
+ */
+func ValidateHOTP(passcode, secret string, counter uint64, lookAhead int, opts *Options) (uint64, bool) {
+	i, ok := matchHOTP(passcode, secret, counter, lookAhead, opts)
+	if !ok {
+		return counter, false
+	}
+	return i + 1, true
+}
+
+// ResyncHOTP 硬件令牌计数器偏离较多时, 用户连续输入两个令牌, 在 counter 之后 window 个计数器内查找连续匹配的位置
+// 通过时返回下一次应使用的计数器
+func ResyncHOTP(passcode1, passcode2, secret string, counter uint64, window int, opts *Options) (uint64, bool) {
+	for window >= 0 {
+		i, ok := matchHOTP(passcode1, secret, counter, window, opts)
+		if !ok {
+			return counter, false
+		}
+		if _, ok = matchHOTP(passcode2, secret, i+1, 0, opts); ok {
+			return i + 2, true
+		}
+		// 继续在之后的位置查找第一个令牌
+		window -= int(i - counter + 1)
+		counter = i + 1
+	}
+	return counter, false
+}
+
+// matchHOTP 返回 [counter, counter+lookAhead] 中第一个匹配的计数器
+func matchHOTP(passcode, secret string, counter uint64, lookAhead int, opts *Options) (uint64, bool) {
+	passcode = strings.TrimSpace(passcode)
+	if len(passcode) != opts.withDefaults().Digits {
+		return 0, false
+	}
+	for i := 0; i <= lookAhead; i++ {
+		code, err := GenerateHOTPCode(secret, counter+uint64(i), opts)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(code), []byte(passcode)) == 1 {
+			return counter + uint64(i), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,41 @@
+package totp
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQRCode(t *testing.T) {
+	_, url, err := Generate("ziy", "ziy@163.com")
+	require.NoError(t, err)
+
+	b, err := QRCodePNG(url, &QROptions{Size: 200, Level: QRLevelH})
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(b))
+	require.NoError(t, err)
+	require.Equal(t, 200, img.Bounds().Dx())
+	// 留白为白色, 定位图案左上角为黑色
+	r, _, _, _ := img.At(0, 0).RGBA()
+	require.Equal(t, uint32(0xffff), r)
+	_, _, offset, err := qrModules(url, (&QROptions{Size: 200, Level: QRLevelH}).withDefaults())
+	require.NoError(t, err)
+	require.Equal(t, color.GrayModel.Convert(color.Black), color.GrayModel.Convert(img.At(offset, offset)))
+	require.Equal(t, color.GrayModel.Convert(color.White), color.GrayModel.Convert(img.At(offset-1, offset-1)))
+
+	svg, err := QRCodeSVG(url, nil)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(svg), "<svg "))
+	require.Contains(t, string(svg), `width="256"`)
+
+	uri, err := QRCodeDataURI(url, nil)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(uri, "data:image/png;base64,"))
+
+	_, err = QRCodePNG(url, &QROptions{Size: 20})
+	require.Error(t, err)
+}
@@ -0,0 +1,154 @@
+package totp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ErrRecoveryCodeInvalid 恢复码错误或已使用
+var ErrRecoveryCodeInvalid = errors.New("totp: invalid recovery code")
+
+// 恢复码字符集, 去掉了易混淆的 0、1、i、l、o
+const recoveryAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+
+// RecoveryStore 恢复码存储, 只保存哈希
+type RecoveryStore interface {
+	// ReplaceRecoveryCodes 用 hashes 替换账号的全部恢复码, 需保证原子性
+	ReplaceRecoveryCodes(ctx context.Context, account string, hashes []string) error
+	// ConsumeRecoveryCode 删除恢复码, 返回是否存在, 需保证同一恢复码只能成功一次
+	ConsumeRecoveryCode(ctx context.Context, account string, hash string) (bool, error)
+	// RemainingRecoveryCodes 返回剩余恢复码数量
+	RemainingRecoveryCodes(ctx context.Context, account string) (int64, error)
+}
+
+// RecoveryHasher 以服务端 pepper 计算恢复码的 HMAC-SHA256, 并绑定账号, 数据库泄露后无法离线穷举
+type RecoveryHasher struct {
+	pepper []byte
+}
+
+// NewRecoveryHasher 创建恢复码哈希器, pepper 至少 16 字节, 应与数据库分开保存(例如配置中心、KMS), 更换后已有恢复码全部失效
+func NewRecoveryHasher(pepper []byte) (*RecoveryHasher, error) {
+	if len(pepper) < 16 {
+		return nil, fmt.Errorf("totp: recovery pepper must be at least 16 bytes, got %d", len(pepper))
+	}
+	return &RecoveryHasher{pepper: append([]byte(nil), pepper...)}, nil
+}
+
+// Hash 返回账号恢复码的哈希, 忽略大小写、空格和连字符
+func (h *RecoveryHasher) Hash(account, code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	mac := hmac.New(sha256.New, h.pepper)
+	mac.Write([]byte(account))
+	mac.Write([]byte{0})
+	mac.Write([]byte(code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GenerateRecoveryCodes 为账号生成 n 个 xxxxx-xxxxx 格式的恢复码(约 49 位熵), 返回明文及对应的哈希
+func (h *RecoveryHasher) GenerateRecoveryCodes(account string, n int) ([]string, []string, error) {
+	codes := make([]string, 0, n)
+	hashes := make([]string, 0, n)
+	size := big.NewInt(int64(len(recoveryAlphabet)))
+	for i := 0; i < n; i++ {
+		b := make([]byte, 0, 11)
+		for j := 0; j < 10; j++ {
+			if j == 5 {
+				b = append(b, '-')
+			}
+			k, err := rand.Int(rand.Reader, size)
+			if err != nil {
+				return nil, nil, err
+			}
+			b = append(b, recoveryAlphabet[k.Int64()])
+		}
+		codes = append(codes, string(b))
+		hashes = append(hashes, h.Hash(account, string(b)))
+	}
+	return codes, hashes, nil
+}
+
+/**
+ * RegenerateRecoveryCodes 为账号生成 n 个新的恢复码并替换旧的, 返回的明文只展示给用户一次
+ *
+ * Example:
+ *
+ * hasher, err := totp.NewRecoveryHasher(pepper) // pepper 来自配置, 不保存在数据库中
+ * store := totp.NewRedisStore(nil)
+ * codes, err := hasher.RegenerateRecoveryCodes(ctx, store, userId, 10)
+ *
+ * // 用户丢失设备时
+ * remaining, err := hasher.UseRecoveryCode(ctx, store, userId, input)
+ * if errors.Is(err, totp.ErrRecoveryCodeInvalid) {
+ * 	return errors.New("恢复码错误")
+ * }
+ */
+func (h *RecoveryHasher) RegenerateRecoveryCodes(ctx context.Context, store RecoveryStore, account string, n int) ([]string, error) {
+	codes, hashes, err := h.GenerateRecoveryCodes(account, n)
+	if err != nil {
+		return nil, err
+	}
+	if err = store.ReplaceRecoveryCodes(ctx, account, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode 消费恢复码, 返回剩余数量; 恢复码错误或已使用时返回 ErrRecoveryCodeInvalid
+func (h *RecoveryHasher) UseRecoveryCode(ctx context.Context, store RecoveryStore, account, code string) (int64, error) {
+	ok, err := store.ConsumeRecoveryCode(ctx, account, h.Hash(account, code))
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, ErrRecoveryCodeInvalid
+	}
+	return store.RemainingRecoveryCodes(ctx, account)
+}
+
+func (s *RedisStore) ReplaceRecoveryCodes(ctx context.Context, account string, hashes []string) error {
+	return s.cache.WithContext(ctx).SReplace("totp.recovery."+account, hashes, 0)
+}
+
+func (s *RedisStore) ConsumeRecoveryCode(ctx context.Context, account string, hash string) (bool, error) {
+	n, err := s.cache.WithContext(ctx).SRem("totp.recovery."+account, hash)
+	return n > 0, err
+}
+
+func (s *RedisStore) RemainingRecoveryCodes(ctx context.Context, account string) (int64, error) {
+	return s.cache.WithContext(ctx).SCard("totp.recovery." + account)
+}
+
+func (s *MemoryStore) ReplaceRecoveryCodes(ctx context.Context, account string, hashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	set := make(map[string]struct{}, len(hashes))
+	for _, h := range hashes {
+		set[h] = struct{}{}
+	}
+	s.recovery[account] = set
+	return nil
+}
+
+func (s *MemoryStore) ConsumeRecoveryCode(ctx context.Context, account string, hash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.recovery[account][hash]; !ok {
+		return false, nil
+	}
+	delete(s.recovery[account], hash)
+	return true, nil
+}
+
+func (s *MemoryStore) RemainingRecoveryCodes(ctx context.Context, account string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int64(len(s.recovery[account])), nil
+}
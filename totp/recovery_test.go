@@ -0,0 +1,77 @@
+package totp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/scrawld/library/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+	ctx := context.Background()
+	_, err := NewRecoveryHasher([]byte("short"))
+	require.Error(t, err)
+	h, err := NewRecoveryHasher([]byte("0123456789abcdef"))
+	require.NoError(t, err)
+	other, err := NewRecoveryHasher([]byte("fedcba9876543210"))
+	require.NoError(t, err)
+
+	// 哈希依赖 pepper 和账号
+	require.Equal(t, h.Hash("u1", "abcde-fghjk"), h.Hash("u1", "ABCDE FGHJK"))
+	require.NotEqual(t, h.Hash("u1", "abcde-fghjk"), h.Hash("u2", "abcde-fghjk"))
+	require.NotEqual(t, h.Hash("u1", "abcde-fghjk"), other.Hash("u1", "abcde-fghjk"))
+
+	for _, store := range []RecoveryStore{NewMemoryStore(), NewRedisStore(redis.New().WithClient(redis.NewMemoryClient()))} {
+		codes, err := h.RegenerateRecoveryCodes(ctx, store, "u1", 5)
+		require.NoError(t, err)
+		require.Len(t, codes, 5)
+		require.Len(t, codes[0], 11)
+
+		// 其他 pepper 计算的哈希不匹配
+		_, err = other.UseRecoveryCode(ctx, store, "u1", codes[0])
+		require.ErrorIs(t, err, ErrRecoveryCodeInvalid)
+
+		n, err := h.UseRecoveryCode(ctx, store, "u1", strings.ToUpper(strings.ReplaceAll(codes[0], "-", " ")))
+		require.NoError(t, err)
+		require.Equal(t, int64(4), n)
+		_, err = h.UseRecoveryCode(ctx, store, "u1", codes[0])
+		require.ErrorIs(t, err, ErrRecoveryCodeInvalid)
+
+		// 重新生成后旧恢复码失效
+		_, err = h.RegenerateRecoveryCodes(ctx, store, "u1", 3)
+		require.NoError(t, err)
+		_, err = h.UseRecoveryCode(ctx, store, "u1", codes[1])
+		require.ErrorIs(t, err, ErrRecoveryCodeInvalid)
+		n, err = store.RemainingRecoveryCodes(ctx, "u1")
+		require.NoError(t, err)
+		require.Equal(t, int64(3), n)
+	}
+}
+
+func TestHOTP(t *testing.T) {
+	secret, url, err := GenerateHOTP("ziy", "ziy@163.com", nil)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(url, "otpauth://hotp/"))
+
+	code, err := GenerateHOTPCode(secret, 5, nil)
+	require.NoError(t, err)
+	next, ok := ValidateHOTP(code, secret, 3, 2, nil)
+	require.True(t, ok)
+	require.Equal(t, uint64(6), next)
+	_, ok = ValidateHOTP(code, secret, next, 10, nil)
+	require.False(t, ok)
+	_, ok = ValidateHOTP(code, secret, 0, 2, nil)
+	require.False(t, ok)
+
+	c1, err := GenerateHOTPCode(secret, 50, nil)
+	require.NoError(t, err)
+	c2, err := GenerateHOTPCode(secret, 51, nil)
+	require.NoError(t, err)
+	next, ok = ResyncHOTP(c1, c2, secret, 6, 100, nil)
+	require.True(t, ok)
+	require.Equal(t, uint64(52), next)
+	_, ok = ResyncHOTP(c2, c1, secret, 6, 100, nil)
+	require.False(t, ok)
+}
@@ -0,0 +1,208 @@
+package totp
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/scrawld/library/crypto"
+
+	"gorm.io/gorm"
+)
+
+// SecretBox 加密保存 TOTP 秘钥, 密文绑定账号, 不能挪用到其他账号
+type SecretBox struct {
+	keyring *crypto.Keyring
+}
+
+/**
+ * NewSecretBox 创建秘钥加密器, 使用 keyring 的当前 key 加密
+ *
+ * Example:
+ *
+ * kr, _ := crypto.NewKeyring("k2", map[string][]byte{"k1": oldKey, "k2": newKey})
+ * box := totp.NewSecretBox(kr)
+ *
+ * account := strconv.FormatInt(user.Id, 10) // 与 ReencryptOptions.AccountColumn 对应的列值
+ * sealed, url, err := box.Generate("ziy", user.Email, account, nil) // sealed 保存到数据库
+ * step, ok, err := box.ValidateAt(code, account, sealed, time.Now(), nil)
+ * step, err = guard.ValidateSealed(ctx, box, account, ip, code, sealed)
+ */
+func NewSecretBox(keyring *crypto.Keyring) *SecretBox {
+	return &SecretBox{keyring: keyring}
+}
+
+// Seal 加密账号的秘钥
+func (b *SecretBox) Seal(account, secret string) (string, error) {
+	return b.keyring.Encrypt([]byte(secret), []byte(account))
+}
+
+// Open 解密账号的秘钥
+func (b *SecretBox) Open(account, sealed string) (string, error) {
+	secret, err := b.keyring.Decrypt(sealed, []byte(account))
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// Generate 生成新秘钥并加密, 返回密文及 otpauth:// 地址
+// accountName 为验证器中显示的名称, account 为加密绑定的账号, 应使用不会变化的值(例如用户 ID), 需与 Open 及 Reencrypt 一致
+func (b *SecretBox) Generate(issuer, accountName, account string, opts *Options) (string, string, error) {
+	secret, url, err := GenerateWithOptions(issuer, accountName, opts)
+	if err != nil {
+		return "", "", err
+	}
+	sealed, err := b.Seal(account, secret)
+	if err != nil {
+		return "", "", err
+	}
+	return sealed, url, nil
+}
+
+// ValidateAt 解密后使用指定时间验证TOTP, 返回匹配的时间步
+func (b *SecretBox) ValidateAt(passcode, account, sealed string, t time.Time, opts *Options) (int64, bool, error) {
+	secret, err := b.Open(account, sealed)
+	if err != nil {
+		return 0, false, err
+	}
+	step, ok := ValidateAt(passcode, secret, t, opts)
+	return step, ok, nil
+}
+
+// ValidateSealed 解密秘钥后调用 Validate
+func (g *Guard) ValidateSealed(ctx context.Context, box *SecretBox, account, ip, passcode, sealed string) (int64, error) {
+	secret, err := box.Open(account, sealed)
+	if err != nil {
+		return 0, err
+	}
+	return g.Validate(ctx, account, ip, passcode, secret)
+}
+
+// ReencryptOptions 批量重新加密的配置
+type ReencryptOptions struct {
+	Table         string // 表名
+	IdColumn      string // 自增主键列, 默认 id
+	AccountColumn string // 加密绑定的账号列, 默认与 IdColumn 相同, 需与 Seal 时传入的 account 一致
+	SecretColumn  string // 秘钥列, 默认 totp_secret
+	BatchSize     int    // 每批处理的行数, 默认 500
+}
+
+/**
+ * Reencrypt 按主键分批遍历表, 将明文秘钥加密, 将旧 key 加密的秘钥用当前 key 重新加密, 返回更新的行数
+ * 更新时以原值为条件, 并发修改过的行会被跳过; 可重复执行
+ *
+ * Example:
+ *
+ * n, err := box.Reencrypt(ctx, db, totp.ReencryptOptions{Table: "users", AccountColumn: "username"})
+ */
+func (b *SecretBox) Reencrypt(ctx context.Context, db *gorm.DB, opts ReencryptOptions) (int64, error) {
+	if opts.IdColumn == "" {
+		opts.IdColumn = "id"
+	}
+	if opts.AccountColumn == "" {
+		opts.AccountColumn = opts.IdColumn
+	}
+	if opts.SecretColumn == "" {
+		opts.SecretColumn = "totp_secret"
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	db = db.WithContext(ctx)
+
+	var (
+		total  int64
+		lastId int64
+	)
+	for {
+		var rows []map[string]interface{}
+		err := db.Table(opts.Table).
+			Select(opts.IdColumn, opts.AccountColumn, opts.SecretColumn).
+			Where(fmt.Sprintf("%s > ? AND %s <> ''", opts.IdColumn, opts.SecretColumn), lastId).
+			Order(opts.IdColumn).
+			Limit(opts.BatchSize).
+			Find(&rows).Error
+		if err != nil {
+			return total, fmt.Errorf("query %s error: %s", opts.Table, err)
+		}
+		if len(rows) == 0 {
+			return total, nil
+		}
+		var updated int64
+		err = db.Transaction(func(tx *gorm.DB) error {
+			for _, row := range rows {
+				id, err := toInt64(row[opts.IdColumn])
+				if err != nil {
+					return err
+				}
+				lastId = id
+				old := toString(row[opts.SecretColumn])
+				if !b.keyring.NeedsRotation(old) {
+					continue
+				}
+				account := toString(row[opts.AccountColumn])
+				secret := old
+				// 没有 key ID 的视为明文
+				if _, ok := b.keyring.KeyId(old); ok {
+					if secret, err = b.Open(account, old); err != nil {
+						return fmt.Errorf("decrypt %s %d error: %s", opts.Table, id, err)
+					}
+				}
+				sealed, err := b.Seal(account, secret)
+				if err != nil {
+					return err
+				}
+				res := tx.Table(opts.Table).
+					Where(fmt.Sprintf("%s = ? AND %s = ?", opts.IdColumn, opts.SecretColumn), id, old).
+					Update(opts.SecretColumn, sealed)
+				if res.Error != nil {
+					return fmt.Errorf("update %s %d error: %s", opts.Table, id, res.Error)
+				}
+				updated += res.RowsAffected
+			}
+			return nil
+		})
+		if err != nil {
+			return total, err
+		}
+		total += updated
+		if len(rows) < opts.BatchSize {
+			return total, nil
+		}
+	}
+}
+
+func toInt64(v interface{}) (int64, error) {
+	switch n := v.(type) {
+	case int64:
+		return n, nil
+	case int32:
+		return int64(n), nil
+	case int:
+		return int64(n), nil
+	case uint64:
+		return int64(n), nil
+	case uint32:
+		return int64(n), nil
+	case uint:
+		return int64(n), nil
+	case []byte:
+		var id int64
+		_, err := fmt.Sscan(string(n), &id)
+		return id, err
+	}
+	return 0, fmt.Errorf("unsupported id type %T", v)
+}
+
+func toString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,115 @@
+package totp
+
+import (
+	"context"
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/scrawld/library/crypto"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestSecretBox(t *testing.T) {
+	kr, err := crypto.NewKeyring("k1", map[string][]byte{"k1": []byte("examplekey123456")})
+	require.NoError(t, err)
+	box := NewSecretBox(kr)
+
+	sealed, url, err := box.Generate("ziy", "ziy@163.com", "42", nil)
+	require.NoError(t, err)
+	require.Contains(t, url, "issuer=ziy")
+	require.Contains(t, url, "ziy@163.com")
+	require.NotContains(t, url, sealed)
+
+	// 密文绑定 account 而不是显示名称
+	_, err = box.Open("ziy@163.com", sealed)
+	require.ErrorIs(t, err, crypto.ErrInvalidCiphertext)
+	secret, err := box.Open("42", sealed)
+	require.NoError(t, err)
+	now := time.Now()
+	code, err := GenerateCodeAt(secret, now, nil)
+	require.NoError(t, err)
+	step, ok, err := box.ValidateAt(code, "42", sealed, now, nil)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, Step(now, nil), step)
+
+	// 密文不能用于其他账号
+	_, _, err = box.ValidateAt(code, "other", sealed, now, nil)
+	require.ErrorIs(t, err, crypto.ErrInvalidCiphertext)
+}
+
+// sealedArg 匹配由当前 key 加密、绑定 account 且明文为 secret 的密文
+type sealedArg struct {
+	box     *SecretBox
+	account string
+	secret  string
+}
+
+func (a sealedArg) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	if !ok || a.box.keyring.NeedsRotation(s) {
+		return false
+	}
+	secret, err := a.box.Open(a.account, s)
+	return err == nil && secret == a.secret
+}
+
+func TestSecretBoxReencrypt(t *testing.T) {
+	oldKr, err := crypto.NewKeyring("k1", map[string][]byte{"k1": []byte("examplekey123456")})
+	require.NoError(t, err)
+	kr, err := crypto.NewKeyring("k2", map[string][]byte{
+		"k1": []byte("examplekey123456"),
+		"k2": []byte("examplekey654321"),
+	})
+	require.NoError(t, err)
+	oldBox, box := NewSecretBox(oldKr), NewSecretBox(kr)
+
+	old2, err := oldBox.Seal("u2", "SECRET2")
+	require.NoError(t, err)
+	cur3, err := box.Seal("u3", "SECRET3")
+	require.NoError(t, err)
+	old4, err := oldBox.Seal("u4", "SECRET4")
+	require.NoError(t, err)
+
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}), &gorm.Config{
+		Logger: logger.Discard,
+	})
+	require.NoError(t, err)
+
+	query := regexp.QuoteMeta("SELECT id,username,totp_secret FROM `users` WHERE id > ? AND totp_secret <> '' ORDER BY id LIMIT ?")
+	update := regexp.QuoteMeta("UPDATE `users` SET `totp_secret`=? WHERE id = ? AND totp_secret = ?")
+	columns := []string{"id", "username", "totp_secret"}
+
+	// 第一批: 明文及旧 key 加密的秘钥
+	mock.ExpectQuery(query).WithArgs(0, 2).WillReturnRows(sqlmock.NewRows(columns).
+		AddRow(int64(1), "u1", "SECRET1").
+		AddRow(int64(2), "u2", old2))
+	mock.ExpectBegin()
+	mock.ExpectExec(update).WithArgs(sealedArg{box, "u1", "SECRET1"}, 1, "SECRET1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(update).WithArgs(sealedArg{box, "u2", "SECRET2"}, 2, old2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// 第二批: 当前 key 加密的跳过, 并发修改过的行不计数
+	mock.ExpectQuery(query).WithArgs(2, 2).WillReturnRows(sqlmock.NewRows(columns).
+		AddRow(int64(3), "u3", cur3).
+		AddRow(int64(4), "u4", old4))
+	mock.ExpectBegin()
+	mock.ExpectExec(update).WithArgs(sealedArg{box, "u4", "SECRET4"}, 4, old4).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	mock.ExpectQuery(query).WithArgs(4, 2).WillReturnRows(sqlmock.NewRows(columns))
+
+	n, err := box.Reencrypt(context.Background(), db, ReencryptOptions{Table: "users", AccountColumn: "username", BatchSize: 2})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), n)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
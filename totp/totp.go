@@ -1,16 +1,76 @@
 package totp
 
 import (
+	"crypto/subtle"
+	"strings"
 	"time"
 
+	"github.com/pquerna/otp"
 	"github.com/pquerna/otp/totp"
 )
 
+// 签名算法
+const (
+	AlgorithmSHA1   = otp.AlgorithmSHA1
+	AlgorithmSHA256 = otp.AlgorithmSHA256
+	AlgorithmSHA512 = otp.AlgorithmSHA512
+)
+
+// Options TOTP 选项, 零值字段使用默认值, 默认值与 Google Authenticator 兼容
+type Options struct {
+	Digits     int           // 验证码位数, 6 或 8, 默认 6
+	Period     uint          // 时间步长(秒), 默认 30
+	Algorithm  otp.Algorithm // 签名算法, 默认 AlgorithmSHA1
+	SecretSize uint          // 秘钥字节数, 默认 20
+	Skew       int           // 允许前后偏移的时间步数, 默认 1, 小于 0 表示不允许偏移
+}
+
+// withDefaults 返回填充默认值后的选项
+func (o *Options) withDefaults() Options {
+	var r Options
+	if o != nil {
+		r = *o
+	}
+	if r.Digits == 0 {
+		r.Digits = 6
+	}
+	if r.Period == 0 {
+		r.Period = 30
+	}
+	if r.SecretSize == 0 {
+		r.SecretSize = 20
+	}
+	if r.Skew == 0 {
+		r.Skew = 1
+	} else if r.Skew < 0 {
+		r.Skew = 0
+	}
+	return r
+}
+
+func (o Options) validateOpts() totp.ValidateOpts {
+	return totp.ValidateOpts{
+		Period:    o.Period,
+		Digits:    otp.Digits(o.Digits),
+		Algorithm: o.Algorithm,
+	}
+}
+
 // Generate 生成新秘钥
 func Generate(issuer, accountName string) (string, string, error) {
+	return GenerateWithOptions(issuer, accountName, nil)
+}
+
+// GenerateWithOptions 按选项生成新秘钥, 返回秘钥及 otpauth:// 地址, opts 为 nil 时使用默认值
+func GenerateWithOptions(issuer, accountName string, opts *Options) (string, string, error) {
+	o := opts.withDefaults()
 	key, err := totp.Generate(totp.GenerateOpts{
 		Issuer:      issuer,
 		AccountName: accountName,
+		Period:      o.Period,
+		SecretSize:  o.SecretSize,
+		Digits:      otp.Digits(o.Digits),
+		Algorithm:   o.Algorithm,
 	})
 	if err != nil {
 		return "", "", err
@@ -20,10 +80,62 @@ func Generate(issuer, accountName string) (string, string, error) {
 
 // GenerateCode 使用当前时间创建TOTP令牌
 func GenerateCode(secret string) (string, error) {
-	return totp.GenerateCode(secret, time.Now().UTC())
+	return GenerateCodeAt(secret, time.Now(), nil)
+}
+
+// GenerateCodeAt 使用指定时间创建TOTP令牌, opts 为 nil 时使用默认值
+func GenerateCodeAt(secret string, t time.Time, opts *Options) (string, error) {
+	o := opts.withDefaults()
+	return totp.GenerateCodeCustom(secret, t.UTC(), o.validateOpts())
 }
 
 // Validate 使用当前时间验证TOTP
 func Validate(passcode string, secret string) bool {
-	return totp.Validate(passcode, secret)
+	_, ok := ValidateAt(passcode, secret, time.Now(), nil)
+	return ok
+}
+
+/**
+ * ValidateAt 使用指定时间验证TOTP, 返回匹配的时间步, 秘钥无效时返回 false
+ * 调用方可记录上次通过的时间步, 拒绝不大于它的时间步以防止重放
+ *
+ * Example:
+ *
+ * step, ok := totp.ValidateAt(code, secret, time.Now(), &totp.Options{Skew: 2})
+ * if !ok || step <= user.LastStep {
+ * 	return errors.New("invalid code")
+ * }
+ * user.LastStep = step
+ */
+func ValidateAt(passcode string, secret string, t time.Time, opts *Options) (int64, bool) {
+	o := opts.withDefaults()
+	passcode = strings.TrimSpace(passcode)
+	if len(passcode) != o.Digits {
+		return 0, false
+	}
+	current := Step(t, &o)
+	// 先检查当前时间步, 再由近及远检查偏移
+	steps := []int64{current}
+	for i := 1; i <= o.Skew; i++ {
+		steps = append(steps, current-int64(i), current+int64(i))
+	}
+	for _, step := range steps {
+		if step < 0 {
+			continue
+		}
+		code, err := totp.GenerateCodeCustom(secret, time.Unix(step*int64(o.Period), 0).UTC(), o.validateOpts())
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(code), []byte(passcode)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// Step 返回指定时间所在的时间步
+func Step(t time.Time, opts *Options) int64 {
+	o := opts.withDefaults()
+	return t.Unix() / int64(o.Period)
 }
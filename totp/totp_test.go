@@ -2,6 +2,7 @@ package totp
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -18,3 +19,38 @@ func TestGenerateAndValidateTOTP(t *testing.T) {
 	valid := Validate(passcode, secret)
 	require.True(t, valid)
 }
+
+func TestOptionsAndValidateAt(t *testing.T) {
+	opts := &Options{Digits: 8, Period: 60, Algorithm: AlgorithmSHA256, SecretSize: 32, Skew: 2}
+	secret, url, err := GenerateWithOptions("ziy", "ziy@163.com", opts)
+	require.NoError(t, err)
+	require.Equal(t, 52, len(secret))
+	require.Contains(t, url, "algorithm=SHA256")
+	require.Contains(t, url, "digits=8")
+	require.Contains(t, url, "period=60")
+
+	now := time.Date(2024, 3, 6, 10, 0, 0, 0, time.UTC)
+	code, err := GenerateCodeAt(secret, now, opts)
+	require.NoError(t, err)
+	require.Len(t, code, 8)
+
+	step, ok := ValidateAt(code, secret, now, opts)
+	require.True(t, ok)
+	require.Equal(t, Step(now, opts), step)
+
+	step, ok = ValidateAt(code, secret, now.Add(2*time.Minute), opts)
+	require.True(t, ok)
+	require.Equal(t, Step(now, opts), step)
+	_, ok = ValidateAt(code, secret, now.Add(3*time.Minute), opts)
+	require.False(t, ok)
+
+	// 默认选项与原有函数一致
+	code, err = GenerateCodeAt(secret, now, nil)
+	require.NoError(t, err)
+	_, ok = ValidateAt(code, secret, now.Add(30*time.Second), nil)
+	require.True(t, ok)
+	_, ok = ValidateAt(code, secret, now.Add(60*time.Second), nil)
+	require.False(t, ok)
+	_, ok = ValidateAt(code, secret, now.Add(30*time.Second), &Options{Skew: -1})
+	require.False(t, ok)
+}
@@ -57,7 +57,7 @@ func SliceShuffle[T any](slice []T) {
 }
 
 // SliceChunk 函数把一个数组分割为新的数组块
-func SliceChunk[T comparable](slice []T, size int) (r [][]T) {
+func SliceChunk[T any](slice []T, size int) (r [][]T) {
 	if size <= 0 || len(slice) == 0 {
 		return nil
 	}